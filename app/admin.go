@@ -0,0 +1,75 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/projecteru2/barrel/cni"
+	"github.com/projecteru2/barrel/cni/subhandler"
+	barrelHttp "github.com/projecteru2/barrel/http"
+	"github.com/projecteru2/barrel/metrics"
+	"github.com/projecteru2/barrel/service"
+)
+
+// adminService serves operational endpoints which shall not be exposed with the docker api
+type adminService struct {
+	barrelHttp.Server
+	address string
+}
+
+func newAdminService(address string, probes []probe, probeTimeout time.Duration) adminService {
+	health := newHealthHandler(probes, probeTimeout)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", health.healthz)
+	mux.HandleFunc("/readyz", health.readyz)
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return adminService{
+		Server:  barrelHttp.NewServer(mux),
+		address: address,
+	}
+}
+
+func (service adminService) Serve(ctx context.Context) (service.Disposable, error) {
+	ch := make(chan error, 1)
+	go func() {
+		ch <- service.ServeHTTP(service.address)
+	}()
+
+	select {
+	case err := <-ch:
+		return service, err
+	case <-ctx.Done():
+		return service, nil
+	}
+}
+
+func (service adminService) Dispose(ctx context.Context) error {
+	return service.Close(ctx)
+}
+
+func registerCNIOutcomes(cniBase *subhandler.Base) error {
+	return metrics.RegisterCNIOutcomes(func() ([]metrics.CNIOutcome, error) {
+		var (
+			outcomes []cni.Outcome
+			err      error
+		)
+		if outcomes, err = cniBase.Outcomes(); err != nil {
+			return nil, err
+		}
+		cniOutcomes := make([]metrics.CNIOutcome, 0, len(outcomes))
+		for _, outcome := range outcomes {
+			cniOutcomes = append(cniOutcomes, metrics.CNIOutcome(outcome))
+		}
+		return cniOutcomes, nil
+	})
+}
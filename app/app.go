@@ -1,6 +1,9 @@
 package app
 
 import (
+	"context"
+	"io"
+	"net/http"
 	"os"
 	"os/signal"
 	"os/user"
@@ -16,38 +19,72 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/projecteru2/barrel/cni/subhandler"
+	"github.com/projecteru2/barrel/docker/watcher"
 	"github.com/projecteru2/barrel/driver"
 	calicoDriver "github.com/projecteru2/barrel/driver/calico"
 	fixedIPDriver "github.com/projecteru2/barrel/driver/fixedip"
 	barrelEtcd "github.com/projecteru2/barrel/etcd"
+	"github.com/projecteru2/barrel/events"
 	barrelHttp "github.com/projecteru2/barrel/http"
+	"github.com/projecteru2/barrel/proxy"
+	"github.com/projecteru2/barrel/proxy/admission"
+	"github.com/projecteru2/barrel/proxy/audit"
 	"github.com/projecteru2/barrel/proxy/docker"
+	"github.com/projecteru2/barrel/proxy/management"
+	"github.com/projecteru2/barrel/proxy/policy"
+	"github.com/projecteru2/barrel/proxy/rewrite"
 	"github.com/projecteru2/barrel/service"
 	"github.com/projecteru2/barrel/store"
+	"github.com/projecteru2/barrel/store/bolt"
 	"github.com/projecteru2/barrel/store/etcd"
 	"github.com/projecteru2/barrel/vessel"
+	"github.com/projecteru2/barrel/vessel/codecs"
 )
 
 // Application .
 type Application struct {
-	Hostname               string
-	Mode                   string
-	DockerDaemonUnixSocket string
-	DockerAPIVersion       string
-	Hosts                  []string
-	DriverName             string
-	IpamDriverName         string
-	DialTimeout            time.Duration
-	RequestTimeout         time.Duration
-	CertFile               string
-	KeyFile                string
-	ShutdownTimeout        time.Duration
-	EnableCNMAgent         bool
-	CNIBase                *subhandler.Base
+	Hostname              string
+	Mode                  string
+	Dockerd               docker.Upstream
+	DockerAPIVersion      string
+	Hosts                 []string
+	DriverName            string
+	IpamDriverName        string
+	DialTimeout           time.Duration
+	RequestTimeout        time.Duration
+	CertFile              string
+	KeyFile               string
+	ClientCAFile          string
+	ClientAuth            string
+	ShutdownTimeout       time.Duration
+	EnableCNMAgent        bool
+	EnableEventsWatcher   bool
+	EnableReconciler      bool
+	ReconcileInterval     time.Duration
+	ReconcileMode         string
+	FixedIPRetention      time.Duration
+	FixedIPReservationTTL time.Duration
+	HostLivenessTTL       time.Duration
+	AdminListen           string
+	StoreType             string
+	StorePath             string
+	KeyPrefix             string
+	EventsLog             bool
+	EventsFile            string
+	EventsWebhook         events.WebhookConfig
+	Audit                 audit.Config
+	PolicyFile            string
+	ProfilesFile          string
+	RewriteRules          string
+	AdmissionConfig       string
+	CNIBase               *subhandler.Base
 }
 
 // Run .
 func (app Application) Run() error {
+	if err := codecs.Init(app.KeyPrefix); err != nil {
+		return err
+	}
 	switch app.Mode {
 	case "default":
 		log.Info("Running in default mode")
@@ -83,16 +120,42 @@ func (app Application) getAPIConfig() (*apiconfig.CalicoAPIConfig, error) {
 	return apiconfig.LoadClientConfig("")
 }
 
-func (app Application) getDockerClient() (*dockerClient.Client, error) {
-	return dockerClient.NewClient(app.DockerDaemonUnixSocket, app.DockerAPIVersion, nil, nil)
+// tlsConfig requires verified client certificates when the client ca is given without client auth
+func (app Application) tlsConfig() barrelHttp.TLSConfig {
+	config := barrelHttp.TLSConfig{
+		CertFile:     app.CertFile,
+		KeyFile:      app.KeyFile,
+		ClientCAFile: app.ClientCAFile,
+		ClientAuth:   app.ClientAuth,
+	}
+	if config.ClientAuth == "" && config.ClientCAFile != "" {
+		config.ClientAuth = barrelHttp.ClientAuthRequired
+	}
+	return config
 }
 
-func (app Application) getEtcdClient(apiConfig *apiconfig.CalicoAPIConfig) (store.Store, error) {
-	cli, err := barrelEtcd.NewClient(apiConfig)
-	if err != nil {
-		return nil, err
+// getDockerClient returns the docker client sharing the transport with the proxy
+func (app Application) getDockerClient(transport *http.Transport) (*dockerClient.Client, error) {
+	return dockerClient.NewClient(app.Dockerd.Host, app.DockerAPIVersion, &http.Client{Transport: transport}, nil)
+}
+
+func (app Application) getStore(apiConfig *apiconfig.CalicoAPIConfig) (store.Store, error) {
+	switch app.StoreType {
+	case "", "etcd":
+		cli, err := barrelEtcd.NewClient(apiConfig)
+		if err != nil {
+			return nil, err
+		}
+		return store.Instrument(etcd.NewEtcdStore(cli)), nil
+	case "bolt":
+		stor, err := bolt.NewBoltStore(app.StorePath, app.DialTimeout)
+		if err != nil {
+			return nil, err
+		}
+		return store.Instrument(stor), nil
+	default:
+		return nil, errors.Errorf("Unrecognized store %s, support only [ --store etcd | bolt ]", app.StoreType)
 	}
-	return etcd.NewEtcdStore(cli), nil
 }
 
 func (app Application) getCalicoClient(apiConfig *apiconfig.CalicoAPIConfig) (calicov3.Interface, error) {
@@ -103,6 +166,7 @@ func (app Application) defaultMode() ([]service.Service, error) {
 	var (
 		apiConfig *apiconfig.CalicoAPIConfig
 		client    clientv3.Interface
+		transport *http.Transport
 		dockerCli *dockerClient.Client
 		vess      vessel.Helper
 		stor      store.Store
@@ -117,28 +181,112 @@ func (app Application) defaultMode() ([]service.Service, error) {
 	if client, err = app.getCalicoClient(apiConfig); err != nil {
 		return nil, err
 	}
-	if dockerCli, err = app.getDockerClient(); err != nil {
+	if transport, err = app.Dockerd.NewTransport(); err != nil {
 		return nil, err
 	}
-	if stor, err = app.getEtcdClient(apiConfig); err != nil {
+	if dockerCli, err = app.getDockerClient(transport); err != nil {
+		return nil, err
+	}
+	if stor, err = app.getStore(apiConfig); err != nil {
 		return nil, err
 	}
 	if gid, err = getDockerGid(); err != nil {
 		return nil, err
 	}
-	vess = vessel.NewHelper(vessel.NewVessel(app.Hostname, client, dockerCli, app.DriverName, stor), stor)
+	if bus, err := app.getEventBus(); err != nil {
+		return nil, err
+	} else if bus != nil {
+		events.Init(bus)
+		services = append(services, bus)
+	}
+	vess = vessel.NewHelper(
+		vessel.NewVessel(app.Hostname, client, dockerCli, app.DriverName, stor), stor,
+	).WithFixedIPRetention(app.FixedIPRetention).WithFixedIPReservation(app.FixedIPReservationTTL)
+	if err = app.recoverJournal(vess); err != nil {
+		return nil, err
+	}
+	services = append(services, vessel.NewHostLiveness(vess, app.HostLivenessTTL))
 	if app.EnableCNMAgent {
-		agent := vessel.NewAgent(vess, vessel.AgentConfig{})
-		services = append(services, agent)
+		cnmAgent := vessel.NewAgent(vess, dockerCli, vessel.AgentConfig{HostName: app.Hostname})
+		agent = cnmAgent
+		services = append(services, cnmAgent)
+	}
+	if app.EnableEventsWatcher {
+		services = append(services, watcher.NewEventsWatcher(dockerCli, vess, app.CNIBase, app.RequestTimeout))
+	}
+	if app.EnableReconciler {
+		var mode vessel.ReconcileMode
+		if mode, err = vessel.ParseReconcileMode(app.ReconcileMode); err != nil {
+			return nil, err
+		}
+		services = append(services, vessel.NewReconciler(vess, dockerCli, vessel.ReconcilerConfig{
+			Mode:     mode,
+			Interval: app.ReconcileInterval,
+			Timeout:  app.RequestTimeout,
+		}))
 	}
+	if app.FixedIPRetention > 0 || app.FixedIPReservationTTL > 0 {
+		services = append(services, vessel.NewFixedIPSweeper(vess, 0, app.RequestTimeout))
+	}
+	if app.AdminListen != "" {
+		if app.CNIBase != nil && app.CNIBase.Enabled() {
+			if err = registerCNIOutcomes(app.CNIBase); err != nil {
+				return nil, err
+			}
+		}
+		services = append(services, newAdminService(app.AdminListen, []probe{
+			dockerProbe(docker.NewHTTPClient(transport)),
+			storeProbe(stor),
+			calicoProbe(client),
+			unixSocketProbe("network-plugin", driver.PluginSocketPath(app.DriverName)),
+			unixSocketProbe("ipam-plugin", driver.PluginSocketPath(app.IpamDriverName)),
+		}, app.RequestTimeout))
+	}
+	var (
+		accessPolicy *policy.Policy
+		handlers     []proxy.RequestHandler
+		closers      []io.Closer
+	)
+	if accessPolicy, err = app.getPolicy(); err != nil {
+		return nil, err
+	}
+	if handlers, closers, err = app.accessHandlers(accessPolicy); err != nil {
+		return nil, err
+	}
+	var profiles *docker.Profiles
+	if app.ProfilesFile != "" {
+		if profiles, err = docker.LoadProfiles(app.ProfilesFile); err != nil {
+			return nil, err
+		}
+	}
+	var rewriteRules *rewrite.Rules
+	if app.RewriteRules != "" {
+		if rewriteRules, err = rewrite.Load(app.RewriteRules); err != nil {
+			return nil, err
+		}
+	}
+	var admissionController *admission.Controller
+	if app.AdmissionConfig != "" {
+		if admissionController, err = admission.Load(app.AdmissionConfig); err != nil {
+			return nil, err
+		}
+	}
+	handler := docker.NewHandler(
+		transport,
+		app.CNIBase,
+		vess,
+		profiles,
+		rewriteRules,
+		admissionController,
+		accessPolicy,
+		append(handlers, proxy.WithName("management", management.NewHandler(vess, profiles, rewriteRules))),
+	)
 	services = append(services, proxyService{
-		Server: barrelHttp.NewServer(docker.NewHandler(app.DockerDaemonUnixSocket, app.DialTimeout, app.CNIBase, vess)),
-		gid:    gid,
-		tlsConfig: barrelHttp.TLSConfig{
-			CertFile: app.CertFile,
-			KeyFile:  app.KeyFile,
-		},
-		hosts: app.Hosts,
+		Server:    barrelHttp.NewServer(handler),
+		gid:       gid,
+		tlsConfig: app.tlsConfig(),
+		hosts:     app.Hosts,
+		closers:   closers,
 	},
 		pluginService{
 			ipam:   fixedIPDriver.NewIpam(vess.FixedIPAllocator(), app.RequestTimeout),
@@ -150,23 +298,44 @@ func (app Application) defaultMode() ([]service.Service, error) {
 
 func (app Application) proxyOnlyMode() ([]service.Service, error) {
 	var (
-		gid int
-		err error
+		transport    *http.Transport
+		gid          int
+		accessPolicy *policy.Policy
+		handlers     []proxy.RequestHandler
+		closers      []io.Closer
+		err          error
 	)
+	// create bodies are forwarded as is in proxy-only mode
+	if app.ProfilesFile != "" || app.RewriteRules != "" || app.AdmissionConfig != "" {
+		return nil, errors.New("profiles, rewrite rules and admission webhooks are not supported in proxy-only mode")
+	}
+	if transport, err = app.Dockerd.NewTransport(); err != nil {
+		return nil, err
+	}
 	if gid, err = getDockerGid(); err != nil {
 		return nil, err
 	}
-	return []service.Service{
+	if accessPolicy, err = app.getPolicy(); err != nil {
+		return nil, err
+	}
+	if handlers, closers, err = app.accessHandlers(accessPolicy); err != nil {
+		return nil, err
+	}
+	services := []service.Service{
 		proxyService{
-			Server: barrelHttp.NewServer(docker.NewSimpleHandler(app.DockerDaemonUnixSocket, app.DialTimeout)),
-			gid:    gid,
-			tlsConfig: barrelHttp.TLSConfig{
-				CertFile: app.CertFile,
-				KeyFile:  app.KeyFile,
-			},
-			hosts: app.Hosts,
+			Server:    barrelHttp.NewServer(docker.NewSimpleHandler(transport, handlers)),
+			gid:       gid,
+			tlsConfig: app.tlsConfig(),
+			hosts:     app.Hosts,
+			closers:   closers,
 		},
-	}, nil
+	}
+	if app.AdminListen != "" {
+		services = append(services, newAdminService(app.AdminListen, []probe{
+			dockerProbe(docker.NewHTTPClient(transport)),
+		}, app.RequestTimeout))
+	}
+	return services, nil
 }
 
 // we will only launch calico plugin here, and fixed ip is not enabled
@@ -174,6 +343,7 @@ func (app Application) networkPluginOnlyMode() ([]service.Service, error) {
 	var (
 		apiConfig *apiconfig.CalicoAPIConfig
 		client    clientv3.Interface
+		transport *http.Transport
 		dockerCli *dockerClient.Client
 		allocator vessel.CalicoIPAllocator
 		err       error
@@ -184,17 +354,94 @@ func (app Application) networkPluginOnlyMode() ([]service.Service, error) {
 	if client, err = app.getCalicoClient(apiConfig); err != nil {
 		return nil, err
 	}
-	if dockerCli, err = app.getDockerClient(); err != nil {
+	if transport, err = app.Dockerd.NewTransport(); err != nil {
+		return nil, err
+	}
+	if dockerCli, err = app.getDockerClient(transport); err != nil {
 		return nil, err
 	}
 	allocator = vessel.NewCalicoIPAllocator(client, app.Hostname)
-	return []service.Service{
+	services := []service.Service{
 		pluginService{
 			ipam:   calicoDriver.NewIpam(allocator, app.RequestTimeout),
 			driver: calicoDriver.NewDriver(client, dockerCli, app.Hostname, app.RequestTimeout),
 			server: driver.NewPluginServer(app.DriverName, app.IpamDriverName),
 		},
-	}, nil
+	}
+	if app.AdminListen != "" {
+		services = append(services, newAdminService(app.AdminListen, []probe{
+			calicoProbe(client),
+			unixSocketProbe("network-plugin", driver.PluginSocketPath(app.DriverName)),
+			unixSocketProbe("ipam-plugin", driver.PluginSocketPath(app.IpamDriverName)),
+		}, app.RequestTimeout))
+	}
+	return services, nil
+}
+
+// accessHandlers returns the configured audit and policy handlers, they're served ahead of other handlers,
+// the audit handler goes first so that denied requests are audited too,
+// closers returned should be closed after the proxy is shut down
+func (app Application) accessHandlers(accessPolicy *policy.Policy) ([]proxy.RequestHandler, []io.Closer, error) {
+	var (
+		handlers []proxy.RequestHandler
+		closers  []io.Closer
+	)
+	if app.Audit.Path != "" {
+		handler, err := audit.NewHandler(app.Audit)
+		if err != nil {
+			return nil, nil, err
+		}
+		handlers = append(handlers, proxy.WithName("audit", handler))
+		closers = append(closers, handler)
+	}
+	if accessPolicy != nil {
+		handlers = append(handlers, proxy.WithName("policy", policy.NewHandler(accessPolicy)))
+	}
+	return handlers, closers, nil
+}
+
+// getPolicy returns nil when no policy file is configured
+func (app Application) getPolicy() (*policy.Policy, error) {
+	if app.PolicyFile == "" {
+		return nil, nil
+	}
+	return policy.Load(app.PolicyFile)
+}
+
+// getEventBus returns nil when no sink is configured
+func (app Application) getEventBus() (*events.Bus, error) {
+	var sinks []events.Sink
+	if app.EventsLog {
+		sinks = append(sinks, events.NewLogSink())
+	}
+	if app.EventsFile != "" {
+		sink, err := events.NewFileSink(app.EventsFile)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if app.EventsWebhook.URL != "" {
+		sinks = append(sinks, events.NewWebhookSink(app.EventsWebhook))
+	}
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+	return events.NewBus(app.Hostname, 0, sinks...), nil
+}
+
+// recoverJournal finishes fixed ip operations interrupted by the last run before serving
+func (app Application) recoverJournal(vess vessel.Helper) error {
+	ctx, cancel := context.WithTimeout(context.Background(), app.RequestTimeout)
+	defer cancel()
+
+	recovered, err := vess.RecoverJournal(ctx)
+	if err != nil {
+		log.WithError(err).Error("Recover journal error")
+		return err
+	}
+	log.Infof("%d unfinished fixed ip operations are recovered", recovered)
+	return nil
 }
 
 func getDockerGid() (int, error) {
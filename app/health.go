@@ -0,0 +1,179 @@
+package app
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/projectcalico/libcalico-go/lib/clientv3"
+	"github.com/projectcalico/libcalico-go/lib/options"
+
+	barrelHttp "github.com/projecteru2/barrel/http"
+	"github.com/projecteru2/barrel/store"
+	"github.com/projecteru2/barrel/utils"
+	"github.com/projecteru2/barrel/vessel/codecs"
+)
+
+const defaultProbeTimeout = 5 * time.Second
+
+// probe checks whether a dependency of barrel is available
+type probe struct {
+	name  string
+	check func(context.Context) error
+}
+
+// DependencyStatus .
+type DependencyStatus struct {
+	Name    string
+	Healthy bool
+	Error   string `json:",omitempty"`
+	Latency string
+}
+
+// ReadinessResponseBody .
+type ReadinessResponseBody struct {
+	Ready        bool
+	Dependencies []DependencyStatus
+}
+
+type healthHandler struct {
+	utils.LoggerFactory
+	probes  []probe
+	timeout time.Duration
+}
+
+func newHealthHandler(probes []probe, timeout time.Duration) healthHandler {
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+	return healthHandler{
+		LoggerFactory: utils.NewObjectLogger("healthHandler"),
+		probes:        probes,
+		timeout:       timeout,
+	}
+}
+
+// healthz only tells the process is alive
+func (handler healthHandler) healthz(res http.ResponseWriter, _ *http.Request) {
+	handler.writeJSON(res, http.StatusOK, utils.HTTPSimpleMessageResponseBody{Message: "ok"})
+}
+
+// readyz probes all dependencies concurrently, any failure makes barrel unready
+func (handler healthHandler) readyz(res http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), handler.timeout)
+	defer cancel()
+
+	body := ReadinessResponseBody{
+		Ready:        true,
+		Dependencies: make([]DependencyStatus, len(handler.probes)),
+	}
+	wg := sync.WaitGroup{}
+	for i, p := range handler.probes {
+		wg.Add(1)
+		go func(i int, p probe) {
+			defer wg.Done()
+			body.Dependencies[i] = runProbe(ctx, p)
+		}(i, p)
+	}
+	wg.Wait()
+
+	code := http.StatusOK
+	for _, status := range body.Dependencies {
+		if !status.Healthy {
+			body.Ready = false
+			code = http.StatusServiceUnavailable
+			handler.Logger("readyz").Warnf("dependency %s is unhealthy, cause = %s", status.Name, status.Error)
+		}
+	}
+	handler.writeJSON(res, code, body)
+}
+
+func (handler healthHandler) writeJSON(res http.ResponseWriter, code int, body interface{}) {
+	if err := utils.WriteHTTPJSONResponse(res, code, nil, body); err != nil {
+		handler.Logger("writeJSON").Errorf("write response failed %v", err)
+	}
+}
+
+// runProbe gives up waiting when ctx is done, as some clients don't respect ctx
+func runProbe(ctx context.Context, p probe) DependencyStatus {
+	start := time.Now()
+	ch := make(chan error, 1)
+	go func() {
+		ch <- p.check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-ch:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	status := DependencyStatus{
+		Name:    p.name,
+		Healthy: err == nil,
+		Latency: time.Since(start).String(),
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	return status
+}
+
+func dockerProbe(client barrelHttp.Client) probe {
+	return probe{
+		name: "dockerd",
+		check: func(ctx context.Context) error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/_ping", nil)
+			if err != nil {
+				return err
+			}
+			resp, err := client.Request(req)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return errors.Errorf("ping dockerd responses %d", resp.StatusCode)
+			}
+			return nil
+		},
+	}
+}
+
+func storeProbe(stor store.Store) probe {
+	return probe{
+		name: "store",
+		check: func(ctx context.Context) error {
+			if err := stor.Get(ctx, &codecs.HealthCheckCodec{}); store.ErrButOtherThenKVUnexistsErr(err) {
+				return err
+			}
+			return nil
+		},
+	}
+}
+
+func calicoProbe(client clientv3.Interface) probe {
+	return probe{
+		name: "calico",
+		check: func(ctx context.Context) error {
+			_, err := client.IPPools().List(ctx, options.ListOptions{})
+			return err
+		},
+	}
+}
+
+func unixSocketProbe(name string, path string) probe {
+	return probe{
+		name: name,
+		check: func(ctx context.Context) error {
+			conn, err := (&net.Dialer{}).DialContext(ctx, "unix", path)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		},
+	}
+}
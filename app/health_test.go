@@ -0,0 +1,40 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadinessReportsDependencies(t *testing.T) {
+	healthy := probe{name: "healthy", check: func(context.Context) error { return nil }}
+	broken := probe{name: "broken", check: func(context.Context) error { return errors.New("connection refused") }}
+	hanging := probe{name: "hanging", check: func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}}
+
+	res := httptest.NewRecorder()
+	newHealthHandler([]probe{healthy}, time.Second).readyz(res, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	res = httptest.NewRecorder()
+	newHealthHandler([]probe{healthy, broken, hanging}, 100*time.Millisecond).readyz(res, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+
+	var body ReadinessResponseBody
+	assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &body))
+	assert.False(t, body.Ready)
+	assert.Equal(t, 3, len(body.Dependencies))
+	assert.True(t, body.Dependencies[0].Healthy)
+	assert.False(t, body.Dependencies[1].Healthy)
+	assert.Equal(t, "connection refused", body.Dependencies[1].Error)
+	assert.False(t, body.Dependencies[2].Healthy)
+	assert.Equal(t, context.DeadlineExceeded.Error(), body.Dependencies[2].Error)
+}
@@ -2,6 +2,7 @@ package app
 
 import (
 	"context"
+	"io"
 	"strings"
 
 	"github.com/juju/errors"
@@ -24,6 +25,8 @@ type proxyService struct {
 	gid       int
 	tlsConfig barrelHttp.TLSConfig
 	hosts     []string
+	// closed after the server is shut down, e.g. the audit log
+	closers []io.Closer
 }
 
 func (service proxyService) Serve(ctx context.Context) (service.Disposable, error) {
@@ -49,7 +52,13 @@ func (service proxyService) Serve(ctx context.Context) (service.Disposable, erro
 }
 
 func (service proxyService) Dispose(ctx context.Context) error {
-	return service.Close(ctx)
+	err := service.Close(ctx)
+	for _, closer := range service.closers {
+		if e := closer.Close(); e != nil {
+			log.WithError(e).Error("Close proxy resource error")
+		}
+	}
+	return err
 }
 
 func (service proxyService) serveHost(address string) error {
@@ -88,5 +97,16 @@ func checkTLSConfig(config barrelHttp.TLSConfig) error {
 	} else if !exists {
 		return errors.New("Key-file not exists")
 	}
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if config.ClientCAFile != "" {
+		if exists, err := os.FileExists(config.ClientCAFile); err != nil {
+			log.WithError(err).Error("Check client ca file error")
+			return err
+		} else if !exists {
+			return errors.New("Client-ca-file not exists")
+		}
+	}
 	return nil
 }
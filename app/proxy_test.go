@@ -185,3 +185,14 @@ func doTestProxyServiceError(t *testing.T) {
 
 	co.Await()
 }
+
+func TestProxyOnlyModeRejectsEditingConfigs(t *testing.T) {
+	for _, app := range []Application{
+		{ProfilesFile: "/etc/barrel/profiles.yaml"},
+		{RewriteRules: "/etc/barrel/rewrite.yaml"},
+		{AdmissionConfig: "/etc/barrel/admission.yaml"},
+	} {
+		_, err := app.proxyOnlyMode()
+		assert.Error(t, err)
+	}
+}
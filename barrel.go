@@ -17,9 +17,13 @@ import (
 	"github.com/projecteru2/barrel/cni/store/filesystem"
 	"github.com/projecteru2/barrel/cni/subhandler"
 	"github.com/projecteru2/barrel/driver"
+	"github.com/projecteru2/barrel/events"
+	"github.com/projecteru2/barrel/proxy/audit"
+	"github.com/projecteru2/barrel/proxy/docker"
 	"github.com/projecteru2/barrel/resources"
 	"github.com/projecteru2/barrel/utils"
 	"github.com/projecteru2/barrel/versioninfo"
+	"github.com/projecteru2/barrel/vessel/codecs"
 	cniapp "github.com/projecteru2/docker-cni/app"
 	"github.com/projecteru2/docker-cni/config"
 )
@@ -75,21 +79,62 @@ func run(c *cli.Context) (err error) {
 		}
 	}
 
+	webhook := events.WebhookConfig{
+		URL:     c.String("events-webhook"),
+		Timeout: c.Duration("events-webhook-timeout"),
+		Retries: c.Int("events-webhook-retries"),
+	}
+
+	auditConfig := audit.Config{
+		Path:       c.String("audit-log"),
+		MaxSize:    c.Int64("audit-log-max-size") * 1024 * 1024,
+		MaxBackups: c.Int("audit-log-max-backups"),
+	}
+
+	dockerd := docker.Upstream{
+		Host:        dockerdPath,
+		CertFile:    c.String("dockerd-tls-cert"),
+		KeyFile:     c.String("dockerd-tls-key"),
+		CAFile:      c.String("dockerd-tls-ca"),
+		DialTimeout: time.Duration(6) * time.Second,
+	}
+
 	barrel := app.Application{
-		Hostname:               hostname,
-		Mode:                   strings.ToLower(c.String("mode")),
-		DockerDaemonUnixSocket: dockerdPath,
-		DockerAPIVersion:       "1.32",
-		Hosts:                  hostEnvVars,
-		DriverName:             driver.DriverName,
-		IpamDriverName:         driver.DriverName + driver.IpamSuffix,
-		DialTimeout:            time.Duration(6) * time.Second,
-		RequestTimeout:         c.Duration("request-timeout"),
-		CertFile:               c.String("tls-cert"),
-		KeyFile:                c.String("tls-key"),
-		ShutdownTimeout:        time.Duration(30) * time.Second,
-		EnableCNMAgent:         c.Bool("enable-cnm-agent"),
-		CNIBase:                subhandler.NewBase(cniConf, cniStore),
+		Hostname:              hostname,
+		Mode:                  strings.ToLower(c.String("mode")),
+		Dockerd:               dockerd,
+		DockerAPIVersion:      "1.32",
+		Hosts:                 hostEnvVars,
+		DriverName:            driver.DriverName,
+		IpamDriverName:        driver.DriverName + driver.IpamSuffix,
+		DialTimeout:           time.Duration(6) * time.Second,
+		RequestTimeout:        c.Duration("request-timeout"),
+		CertFile:              c.String("tls-cert"),
+		KeyFile:               c.String("tls-key"),
+		ClientCAFile:          c.String("tls-client-ca"),
+		ClientAuth:            c.String("tls-client-auth"),
+		ShutdownTimeout:       time.Duration(30) * time.Second,
+		EnableCNMAgent:        c.Bool("enable-cnm-agent"),
+		EnableEventsWatcher:   c.Bool("enable-events-watcher"),
+		EnableReconciler:      c.Bool("enable-reconciler"),
+		ReconcileInterval:     c.Duration("reconcile-interval"),
+		ReconcileMode:         strings.ToLower(c.String("reconcile-mode")),
+		FixedIPRetention:      c.Duration("fixed-ip-retention"),
+		FixedIPReservationTTL: c.Duration("fixed-ip-reservation-ttl"),
+		HostLivenessTTL:       c.Duration("host-liveness-ttl"),
+		AdminListen:           c.String("admin-listen"),
+		StoreType:             strings.ToLower(c.String("store")),
+		StorePath:             c.String("store-path"),
+		KeyPrefix:             c.String("key-prefix"),
+		EventsLog:             c.Bool("events-log"),
+		EventsFile:            c.String("events-file"),
+		EventsWebhook:         webhook,
+		Audit:                 auditConfig,
+		PolicyFile:            c.String("policy-file"),
+		ProfilesFile:          c.String("profiles-file"),
+		RewriteRules:          c.String("rewrite-rules"),
+		AdmissionConfig:       c.String("admission-config"),
+		CNIBase:               subhandler.NewBase(cniConf, cniStore),
 	}
 	return barrel.Run()
 }
@@ -136,9 +181,24 @@ func main() {
 					Name:    "dockerd-path",
 					Aliases: []string{"D"},
 					Value:   "unix:///var/run/docker.sock",
-					Usage:   "dockerd path",
+					Usage:   "dockerd path, unix://, tcp:// or https://",
 					EnvVars: []string{"BARREL_DOCKERD_PATH"},
 				},
+				&cli.StringFlag{
+					Name:    "dockerd-tls-cert",
+					Usage:   "client certificate presented to dockerd over tls",
+					EnvVars: []string{"BARREL_DOCKERD_TLS_CERT"},
+				},
+				&cli.StringFlag{
+					Name:    "dockerd-tls-key",
+					Usage:   "key of the client certificate presented to dockerd",
+					EnvVars: []string{"BARREL_DOCKERD_TLS_KEY"},
+				},
+				&cli.StringFlag{
+					Name:    "dockerd-tls-ca",
+					Usage:   "ca verifying dockerd over tls, system roots are used when blank",
+					EnvVars: []string{"BARREL_DOCKERD_TLS_CA"},
+				},
 				&cli.StringSliceFlag{
 					Name:    "host",
 					Aliases: []string{"H"},
@@ -163,6 +223,16 @@ func main() {
 					Usage:   "tls-key-file-path",
 					EnvVars: []string{"BARREL_TLS_KEY_FILE_PATH"},
 				},
+				&cli.StringFlag{
+					Name:    "tls-client-ca",
+					Usage:   "ca bundle verifying client certificates of https hosts",
+					EnvVars: []string{"BARREL_TLS_CLIENT_CA_FILE_PATH"},
+				},
+				&cli.StringFlag{
+					Name:    "tls-client-auth",
+					Usage:   "client certificate verification of https hosts, [ none | optional | required ], required when tls-client-ca is given and none otherwise by default",
+					EnvVars: []string{"BARREL_TLS_CLIENT_AUTH"},
+				},
 				&cli.IntFlag{
 					Name:    "buffer-size",
 					Usage:   "set buffer size",
@@ -191,6 +261,144 @@ func main() {
 					Usage:   "enable cnm agent",
 					EnvVars: []string{"BARREL_ENABLE_CNM_AGENT"},
 				},
+				&cli.BoolFlag{
+					Name:    "enable-events-watcher",
+					Value:   false,
+					Usage:   "release resources of containers removed without barrel by watching docker events",
+					EnvVars: []string{"BARREL_ENABLE_EVENTS_WATCHER"},
+				},
+				&cli.BoolFlag{
+					Name:    "enable-reconciler",
+					Value:   false,
+					Usage:   "enable fixed-ip reconciler",
+					EnvVars: []string{"BARREL_ENABLE_RECONCILER"},
+				},
+				&cli.DurationFlag{
+					Name:    "reconcile-interval",
+					Value:   time.Minute * 5,
+					Usage:   "interval between fixed-ip reconcile rounds",
+					EnvVars: []string{"BARREL_RECONCILE_INTERVAL"},
+				},
+				&cli.StringFlag{
+					Name:    "reconcile-mode",
+					Value:   "repair",
+					Usage:   "repair | dry-run | report-only",
+					EnvVars: []string{"BARREL_RECONCILE_MODE"},
+				},
+				&cli.DurationFlag{
+					Name:    "fixed-ip-retention",
+					Value:   0,
+					Usage:   "keep released fixed-ip for return of the container with the same name on the host during the duration, 0 to unalloc at once",
+					EnvVars: []string{"BARREL_FIXED_IP_RETENTION"},
+				},
+				&cli.DurationFlag{
+					Name:    "fixed-ip-reservation-ttl",
+					Value:   5 * time.Minute,
+					Usage:   "unalloc fixed-ip requested by container creating when the container isn't recorded during the duration, 0 to disable",
+					EnvVars: []string{"BARREL_FIXED_IP_RESERVATION_TTL"},
+				},
+				&cli.DurationFlag{
+					Name:    "host-liveness-ttl",
+					Value:   30 * time.Second,
+					Usage:   "ttl of the liveness key of the host, which expires after barrel is gone",
+					EnvVars: []string{"BARREL_HOST_LIVENESS_TTL"},
+				},
+				&cli.BoolFlag{
+					Name:    "events-log",
+					Value:   false,
+					Usage:   "log fixed-ip and container record events",
+					EnvVars: []string{"BARREL_EVENTS_LOG"},
+				},
+				&cli.StringFlag{
+					Name:    "events-file",
+					Value:   "",
+					Usage:   "append fixed-ip and container record events to the file as json lines, disabled when blank",
+					EnvVars: []string{"BARREL_EVENTS_FILE"},
+				},
+				&cli.StringFlag{
+					Name:    "events-webhook",
+					Value:   "",
+					Usage:   "post fixed-ip and container record events to the url as json, disabled when blank",
+					EnvVars: []string{"BARREL_EVENTS_WEBHOOK"},
+				},
+				&cli.DurationFlag{
+					Name:    "events-webhook-timeout",
+					Value:   5 * time.Second,
+					Usage:   "timeout of each post to the events webhook",
+					EnvVars: []string{"BARREL_EVENTS_WEBHOOK_TIMEOUT"},
+				},
+				&cli.IntFlag{
+					Name:    "events-webhook-retries",
+					Value:   5,
+					Usage:   "retries with exponential backoff before an event is given up by the webhook",
+					EnvVars: []string{"BARREL_EVENTS_WEBHOOK_RETRIES"},
+				},
+				&cli.StringFlag{
+					Name:    "audit-log",
+					Value:   "",
+					Usage:   "record docker api calls other than GET to the file as json lines, disabled when blank",
+					EnvVars: []string{"BARREL_AUDIT_LOG"},
+				},
+				&cli.Int64Flag{
+					Name:    "audit-log-max-size",
+					Value:   100,
+					Usage:   "the audit log is rotated when it exceeds the size in megabytes",
+					EnvVars: []string{"BARREL_AUDIT_LOG_MAX_SIZE"},
+				},
+				&cli.IntFlag{
+					Name:    "audit-log-max-backups",
+					Value:   5,
+					Usage:   "rotated audit logs kept",
+					EnvVars: []string{"BARREL_AUDIT_LOG_MAX_BACKUPS"},
+				},
+				&cli.StringFlag{
+					Name:    "policy-file",
+					Value:   "",
+					Usage:   "yaml policy authorizing docker api calls through barrel, disabled when blank",
+					EnvVars: []string{"BARREL_POLICY_FILE"},
+				},
+				&cli.StringFlag{
+					Name:    "profiles-file",
+					Value:   "",
+					Usage:   "yaml profiles applied to containers labeled barrel.profile=<name>, disabled when blank, unsupported in proxy-only mode",
+					EnvVars: []string{"BARREL_PROFILES_FILE"},
+				},
+				&cli.StringFlag{
+					Name:    "rewrite-rules",
+					Value:   "",
+					Usage:   "yaml rules rewriting container create requests, disabled when blank, unsupported in proxy-only mode",
+					EnvVars: []string{"BARREL_REWRITE_RULES"},
+				},
+				&cli.StringFlag{
+					Name:    "admission-config",
+					Value:   "",
+					Usage:   "yaml config of webhooks admitting container create requests, disabled when blank, unsupported in proxy-only mode",
+					EnvVars: []string{"BARREL_ADMISSION_CONFIG"},
+				},
+				&cli.StringFlag{
+					Name:    "admin-listen",
+					Value:   "",
+					Usage:   "tcp address serving /metrics, /healthz, /readyz and /debug/pprof, e.g. 127.0.0.1:9310, disabled when empty",
+					EnvVars: []string{"BARREL_ADMIN_LISTEN"},
+				},
+				&cli.StringFlag{
+					Name:    "store",
+					Value:   "etcd",
+					Usage:   "etcd | bolt, where barrel keeps fixed-ip and container records, calico is still used for ipam",
+					EnvVars: []string{"BARREL_STORE"},
+				},
+				&cli.StringFlag{
+					Name:    "store-path",
+					Value:   "/var/lib/barrel/barrel.db",
+					Usage:   "path of the bolt file when --store=bolt",
+					EnvVars: []string{"BARREL_STORE_PATH"},
+				},
+				&cli.StringFlag{
+					Name:    "key-prefix",
+					Value:   codecs.DefaultPrefix,
+					Usage:   "namespace of barrel keys in the store, so that multiple barrel clusters can share one etcd",
+					EnvVars: []string{"BARREL_KEY_PREFIX"},
+				},
 				&cli.BoolFlag{
 					Name:    "enable-cni",
 					Value:   false,
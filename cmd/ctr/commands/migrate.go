@@ -0,0 +1,63 @@
+package commands
+
+import (
+	"github.com/juju/errors"
+	cli "github.com/urfave/cli/v2"
+
+	ctrtypes "github.com/projecteru2/barrel/cmd/ctr/types"
+	"github.com/projecteru2/barrel/ctr"
+)
+
+// Migrate .
+type Migrate struct {
+	c          ctr.Ctr
+	dryRunFlag bool
+}
+
+// MigrateCommand .
+func MigrateCommand(_ *ctrtypes.Flags) *cli.Command {
+	migrate := Migrate{}
+
+	return &cli.Command{
+		Name:      "migrate",
+		Usage:     "rewrite barrel records to the latest schema version",
+		ArgsUsage: " ",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:        "dry-run",
+				Usage:       "only print records to migrate",
+				Destination: &migrate.dryRunFlag,
+			},
+		},
+		Before: migrate.init,
+		Action: migrate.run,
+	}
+}
+
+func (migrate *Migrate) init(ctx *cli.Context) error {
+	return ctr.InitCtr(&migrate.c, func(init *ctr.Init) {
+		init.InitEtcd()
+	})
+}
+
+func (migrate *Migrate) run(ctx *cli.Context) error {
+	result, err := migrate.c.Migrate(ctx.Context, migrate.dryRunFlag)
+	if err != nil {
+		return err
+	}
+	for _, key := range result.Migrated {
+		ctr.Fprintlnf("%s", key)
+	}
+	if migrate.dryRunFlag {
+		ctr.Fprintlnf("%d records to migrate", len(result.Migrated))
+	} else {
+		ctr.Fprintlnf("%d records migrated", len(result.Migrated))
+	}
+	for key, err := range result.Failed {
+		ctr.Ferrorlnf("migrate %s failed, cause = %v", key, err)
+	}
+	if len(result.Failed) > 0 {
+		return errors.Errorf("%d records are not migrated", len(result.Failed))
+	}
+	return nil
+}
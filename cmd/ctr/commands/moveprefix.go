@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"github.com/juju/errors"
+	cli "github.com/urfave/cli/v2"
+
+	ctrtypes "github.com/projecteru2/barrel/cmd/ctr/types"
+	"github.com/projecteru2/barrel/ctr"
+	"github.com/projecteru2/barrel/vessel/codecs"
+)
+
+// MovePrefix .
+type MovePrefix struct {
+	c        ctr.Ctr
+	fromFlag string
+	toFlag   string
+}
+
+// MovePrefixCommand .
+func MovePrefixCommand(_ *ctrtypes.Flags) *cli.Command {
+	move := MovePrefix{}
+
+	return &cli.Command{
+		Name:      "move-prefix",
+		Usage:     "move barrel keys to a new namespace, barrel daemons should be stopped before moving",
+		ArgsUsage: " ",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "from",
+				Usage:       "key prefix barrel keys are under",
+				Value:       codecs.DefaultPrefix,
+				Destination: &move.fromFlag,
+			},
+			&cli.StringFlag{
+				Name:        "to",
+				Usage:       "key prefix barrel keys will be moved to",
+				Destination: &move.toFlag,
+				Required:    true,
+			},
+		},
+		Before: move.init,
+		Action: move.run,
+	}
+}
+
+func (move *MovePrefix) init(ctx *cli.Context) error {
+	return ctr.InitCtr(&move.c, func(init *ctr.Init) {
+		init.InitEtcd()
+	})
+}
+
+func (move *MovePrefix) run(ctx *cli.Context) error {
+	result, err := move.c.MovePrefix(ctx.Context, move.fromFlag, move.toFlag)
+	if err != nil {
+		return err
+	}
+	ctr.Fprintlnf("%d keys moved from %s to %s", result.Moved, move.fromFlag, move.toFlag)
+	for _, key := range result.Skipped {
+		ctr.Ferrorlnf("skipped %s, it's modified during moving or already exists under %s", key, move.toFlag)
+	}
+	if len(result.Skipped) > 0 {
+		return errors.Errorf("%d keys are not moved", len(result.Skipped))
+	}
+	return nil
+}
@@ -16,6 +16,7 @@ func ReleaseCommands(flags *ctrtypes.Flags) *cli.Command {
 			release.BlockCommand(flags),
 			release.BlocksCommand(flags),
 			release.IPCommand(flags),
+			release.KeyCommand(flags),
 			release.WEPCommand(flags),
 			// release.WEPSCommand(flags),
 		},
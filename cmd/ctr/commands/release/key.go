@@ -0,0 +1,57 @@
+package release
+
+import (
+	"github.com/juju/errors"
+	cli "github.com/urfave/cli/v2"
+
+	ctrtypes "github.com/projecteru2/barrel/cmd/ctr/types"
+	"github.com/projecteru2/barrel/ctr"
+)
+
+// DelKey .
+type DelKey struct {
+	*ctrtypes.Flags
+	c           ctr.Ctr
+	networkFlag string
+	keyArg      string
+}
+
+// KeyCommand .
+func KeyCommand(flags *ctrtypes.Flags) *cli.Command {
+	delKey := DelKey{
+		Flags: flags,
+	}
+
+	return &cli.Command{
+		Name:      "key",
+		Usage:     "release fixed-ip key, fixed ips bound to the key will be returned to calico",
+		ArgsUsage: "KEY",
+		Action:    delKey.run,
+		Before:    delKey.init,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "network",
+				Usage:       "docker network name the key is bound on",
+				Required:    true,
+				Destination: &delKey.networkFlag,
+			},
+		},
+	}
+}
+
+func (d *DelKey) init(ctx *cli.Context) error {
+	d.keyArg = ctx.Args().First()
+	if d.keyArg == "" {
+		return errors.New("must provide fixed-ip key")
+	}
+	return ctr.InitCtr(&d.c, func(init *ctr.Init) {
+		init.InitPoolManager()
+	})
+}
+
+func (d *DelKey) run(ctx *cli.Context) error {
+	if err := d.c.ReleaseFixedIPKey(ctx.Context, d.networkFlag, d.keyArg); err != nil {
+		return err
+	}
+	return ctr.Fprintln("release fixed-ip key success")
+}
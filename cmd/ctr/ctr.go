@@ -11,6 +11,7 @@ import (
 	"github.com/projecteru2/barrel/cmd/ctr/commands"
 	ctrtypes "github.com/projecteru2/barrel/cmd/ctr/types"
 	"github.com/projecteru2/barrel/versioninfo"
+	"github.com/projecteru2/barrel/vessel/codecs"
 )
 
 const envETCDEndpoints = "ETCD_ENDPOINTS"
@@ -21,12 +22,18 @@ func main() {
 	}
 
 	flags := ctrtypes.Flags{}
-	var etcdEndpoints string
+	var (
+		etcdEndpoints string
+		keyPrefix     string
+	)
 
 	app := &cli.App{
 		Name:    "eru-barrel-utils",
 		Version: versioninfo.VERSION,
 		Before: func(c *cli.Context) error {
+			if err := codecs.Init(keyPrefix); err != nil {
+				return err
+			}
 			if os.Getenv(envETCDEndpoints) != "" {
 				return nil
 			}
@@ -43,6 +50,8 @@ func main() {
 			commands.DiagCommands(&flags),
 			commands.InspectCommands(&flags),
 			commands.ListCommands(&flags),
+			commands.MigrateCommand(&flags),
+			commands.MovePrefixCommand(&flags),
 		},
 		Flags: []cli.Flag{
 			&cli.StringFlag{
@@ -51,6 +60,13 @@ func main() {
 				Value:       "http://127.0.0.1:2379",
 				Destination: &etcdEndpoints,
 			},
+			&cli.StringFlag{
+				Name:        "key-prefix",
+				Usage:       "namespace of barrel keys in etcd",
+				Value:       codecs.DefaultPrefix,
+				EnvVars:     []string{"BARREL_KEY_PREFIX"},
+				Destination: &keyPrefix,
+			},
 			&cli.StringFlag{
 				Name:        "docker-host",
 				Usage:       "docker host",
@@ -13,6 +13,7 @@ import (
 func (h *BarrelHandler) HandleCNIConfig(config []byte) (newConfig []byte, err error) {
 	cniArgs := os.Getenv("CNI_ARGS")
 	ippool := ""
+	ippool6 := ""
 	for _, args := range strings.Split(cniArgs, ";") {
 		if args == "" {
 			continue
@@ -21,12 +22,15 @@ func (h *BarrelHandler) HandleCNIConfig(config []byte) (newConfig []byte, err er
 		if len(parts) != 2 {
 			return nil, fmt.Errorf("invalid CNI_ARGS: '%s'", cniArgs)
 		}
-		if parts[0] == "IPPOOL" {
+		switch parts[0] {
+		case "IPPOOL":
 			ippool = parts[1]
+		case "IPPOOL6":
+			ippool6 = parts[1]
 		}
 	}
 
-	if ippool == "" {
+	if ippool == "" && ippool6 == "" {
 		return config, nil
 	}
 
@@ -35,6 +39,17 @@ func (h *BarrelHandler) HandleCNIConfig(config []byte) (newConfig []byte, err er
 		return nil, err
 	}
 
-	cniConfig.IPAM.IPv4Pools = []string{ippool}
+	if ippool != "" {
+		cniConfig.IPAM.IPv4Pools = []string{ippool}
+	} else {
+		// ipv6 only network
+		assignIPv4 := "false"
+		cniConfig.IPAM.AssignIpv4 = &assignIPv4
+	}
+	if ippool6 != "" {
+		assignIPv6 := "true"
+		cniConfig.IPAM.AssignIpv6 = &assignIPv6
+		cniConfig.IPAM.IPv6Pools = []string{ippool6}
+	}
 	return json.Marshal(cniConfig)
 }
@@ -9,6 +9,7 @@ import (
 // HandleCreate handles oci create
 func (h *BarrelHandler) HandleCreate(conf config.Config, meta *oci.ContainerMeta) (err error) {
 	containerMeta := &cni.ContainerMeta{Meta: *meta}
-	subhandler := h.getSubhandler(conf, containerMeta)
+	name, subhandler := h.getSubhandler(conf, containerMeta)
+	defer func() { h.recordOutcome(name, "create", err) }()
 	return subhandler.HandleCreate(containerMeta)
 }
@@ -9,6 +9,7 @@ import (
 // HandleDelete handles oci delete
 func (h *BarrelHandler) HandleDelete(conf config.Config, meta *oci.ContainerMeta) (err error) {
 	containerMeta := &cni.ContainerMeta{Meta: *meta}
-	subhandler := h.getSubhandler(conf, containerMeta)
+	name, subhandler := h.getSubhandler(conf, containerMeta)
+	defer func() { h.recordOutcome(name, "delete", err) }()
 	return subhandler.HandleDelete(containerMeta)
 }
@@ -1,6 +1,8 @@
 package handler
 
 import (
+	log "github.com/sirupsen/logrus"
+
 	barrelcni "github.com/projecteru2/barrel/cni"
 	"github.com/projecteru2/barrel/cni/store"
 	"github.com/projecteru2/barrel/cni/subhandler"
@@ -19,15 +21,26 @@ func NewBarrelHandler(store store.Store) *BarrelHandler {
 	}
 }
 
-func (h *BarrelHandler) getSubhandler(conf config.Config, containerMeta *barrelcni.ContainerMeta) subhandler.Subhandler {
+func (h *BarrelHandler) getSubhandler(conf config.Config, containerMeta *barrelcni.ContainerMeta) (string, subhandler.Subhandler) {
 	if containerMeta.RequiresFixedIP() && !containerMeta.RequiresSpecificIP() {
-		return subhandler.NewFixed(conf, h.store)
+		return "fixed", subhandler.NewFixed(conf, h.store)
 	}
 	if containerMeta.RequiresFixedIP() && containerMeta.RequiresSpecificIP() {
-		return subhandler.NewFixedSpecific(conf, h.store)
+		return "fixed-specific", subhandler.NewFixedSpecific(conf, h.store)
 	}
 	if !containerMeta.RequiresFixedIP() && containerMeta.RequiresSpecificIP() {
-		return subhandler.NewSpecific(conf, h.store)
+		return "specific", subhandler.NewSpecific(conf, h.store)
+	}
+	return "super", subhandler.NewSuper(conf, h.store)
+}
+
+// recordOutcome never fails the oci hook, outcomes are only for metrics
+func (h *BarrelHandler) recordOutcome(name, phase string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	if e := h.store.RecordOutcome(name, phase, result); e != nil {
+		log.Warnf("failed to record outcome of %s %s: %+v", name, phase, e)
 	}
-	return subhandler.NewSuper(conf, h.store)
 }
@@ -9,6 +9,7 @@ import (
 // HandleStart handles oci start
 func (h *BarrelHandler) HandleStart(conf config.Config, meta *oci.ContainerMeta) (err error) {
 	containerMeta := &cni.ContainerMeta{Meta: *meta}
-	subhandler := h.getSubhandler(conf, containerMeta)
+	name, subhandler := h.getSubhandler(conf, containerMeta)
+	defer func() { h.recordOutcome(name, "start", err) }()
 	return subhandler.HandleStart(containerMeta)
 }
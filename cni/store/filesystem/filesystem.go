@@ -2,6 +2,7 @@ package filesystem
 
 import (
 	"io/ioutil"
+	"net"
 	"os"
 	"path"
 	"path/filepath"
@@ -46,34 +47,56 @@ func (s FSStore) GetNetEndpointByID(id string) (*cni.NetEndpoint, error) {
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
-	owner, err := ioutil.ReadFile(s.ownerPath(filepath.Base(netnsPath)))
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
-	return &cni.NetEndpoint{
-		IPv4:  filepath.Base(netnsPath),
-		Netns: netnsPath,
-		Owner: string(owner),
-	}, nil
+	return s.getNetEndpoint(filepath.Base(netnsPath), netnsPath)
 }
 
-// GetNetEndpointByIP .
+// GetNetEndpointByIP finds the nep by either of its addresses
 func (s FSStore) GetNetEndpointByIP(ip string) (nep *cni.NetEndpoint, err error) {
-	if _, err := os.Stat(s.netnsPath(ip)); err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil
+	key := ip
+	if _, err := os.Stat(s.netnsPath(key)); err != nil {
+		if !os.IsNotExist(err) {
+			return nil, errors.WithStack(err)
+		}
+		// dual-stack nep is keyed by its ipv4
+		ipv4, err := ioutil.ReadFile(s.ipv4Path(ip))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, nil
+			}
+			return nil, errors.WithStack(err)
+		}
+		key = string(ipv4)
+		if _, err := os.Stat(s.netnsPath(key)); err != nil {
+			if os.IsNotExist(err) {
+				return nil, nil
+			}
+			return nil, errors.WithStack(err)
 		}
-		return nil, errors.WithStack(err)
 	}
-	owner, err := ioutil.ReadFile(s.ownerPath(ip))
+	return s.getNetEndpoint(key, s.netnsPath(key))
+}
+
+// getNetEndpoint assembles the nep keyed by ipv4, or by ipv6 for ipv6 only nep
+func (s FSStore) getNetEndpoint(key, netnsPath string) (*cni.NetEndpoint, error) {
+	owner, err := ioutil.ReadFile(s.ownerPath(key))
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
-	return &cni.NetEndpoint{
-		IPv4:  ip,
-		Netns: s.netnsPath(ip),
+	nep := &cni.NetEndpoint{
+		Netns: netnsPath,
 		Owner: string(owner),
-	}, nil
+	}
+	if ip := net.ParseIP(key); ip != nil && ip.To4() == nil {
+		nep.IPv6 = key
+		return nep, nil
+	}
+	nep.IPv4 = key
+	ipv6, err := ioutil.ReadFile(s.ipv6Path(key))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.WithStack(err)
+	}
+	nep.IPv6 = string(ipv6)
+	return nep, nil
 }
 
 // ConnectNetEndpoint .
@@ -93,15 +116,19 @@ func (s FSStore) DisconnectNetEndpoint(containerID string, nep *cni.NetEndpoint)
 }
 
 // CreateNetEndpoint .
-func (s FSStore) CreateNetEndpoint(netns, id, ipv4 string) (nep *cni.NetEndpoint, err error) {
-	file, err := os.OpenFile(s.ownerPath(ipv4), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+func (s FSStore) CreateNetEndpoint(netns, id, ipv4, ipv6 string) (nep *cni.NetEndpoint, err error) {
+	key := cni.NetEndpoint{IPv4: ipv4, IPv6: ipv6}.Key()
+	if key == "" {
+		return nep, errors.Errorf("no address probed for %s", id)
+	}
+	file, err := os.OpenFile(s.ownerPath(key), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
 	if err != nil {
 		return nep, errors.WithStack(err)
 	}
 	defer func() {
 		if err != nil {
-			if e := os.Remove(s.ownerPath(ipv4)); e != nil {
-				log.Errorf("failed to remove file: %s, %+v", ipv4, e)
+			if e := os.Remove(s.ownerPath(key)); e != nil {
+				log.Errorf("failed to remove file: %s, %+v", key, e)
 			}
 		}
 	}()
@@ -110,50 +137,85 @@ func (s FSStore) CreateNetEndpoint(netns, id, ipv4 string) (nep *cni.NetEndpoint
 		return nep, errors.WithStack(err)
 	}
 
-	if _, err := os.Create(s.netnsPath(ipv4)); err != nil {
+	if ipv4 != "" && ipv6 != "" {
+		if err = ioutil.WriteFile(s.ipv6Path(key), []byte(ipv6), 0644); err != nil {
+			return nep, errors.WithStack(err)
+		}
+		defer func() {
+			if err != nil {
+				if e := os.Remove(s.ipv6Path(key)); e != nil {
+					log.Errorf("failed to remove file: %s, %+v", s.ipv6Path(key), e)
+				}
+			}
+		}()
+		if err = ioutil.WriteFile(s.ipv4Path(ipv6), []byte(key), 0644); err != nil {
+			return nep, errors.WithStack(err)
+		}
+		defer func() {
+			if err != nil {
+				if e := os.Remove(s.ipv4Path(ipv6)); e != nil {
+					log.Errorf("failed to remove file: %s, %+v", s.ipv4Path(ipv6), e)
+				}
+			}
+		}()
+	}
+
+	if _, err := os.Create(s.netnsPath(key)); err != nil {
 		return nep, errors.WithStack(err)
 	}
 	defer func() {
 		if err != nil {
-			if e := os.Remove(s.netnsPath(nep.IPv4)); e != nil {
-				log.Errorf("failed to remove file: %s, %+v", s.netnsPath(nep.IPv4), e)
+			if e := os.Remove(s.netnsPath(key)); e != nil {
+				log.Errorf("failed to remove file: %s, %+v", s.netnsPath(key), e)
 			}
 		}
 	}()
 
-	if err = syscall.Mount(netns, s.netnsPath(ipv4), "none", syscall.MS_BIND, ""); err != nil {
+	if err = syscall.Mount(netns, s.netnsPath(key), "none", syscall.MS_BIND, ""); err != nil {
 		return nil, errors.WithStack(err)
 	}
 	return &cni.NetEndpoint{
 		IPv4:  ipv4,
-		Netns: s.netnsPath(ipv4),
+		IPv6:  ipv6,
+		Netns: s.netnsPath(key),
 		Owner: id,
 	}, nil
 }
 
 // DeleteNetEndpoint .
 func (s FSStore) DeleteNetEndpoint(nep *cni.NetEndpoint) (err error) {
-	if err = os.Remove(s.tenantPath(nep.IPv4)); err != nil {
-		log.Warnf("failed to remove tenant file %s: %+v", s.tenantPath(nep.IPv4), errors.WithStack(err))
+	key := nep.Key()
+	if err = os.Remove(s.tenantPath(key)); err != nil {
+		log.Warnf("failed to remove tenant file %s: %+v", s.tenantPath(key), errors.WithStack(err))
+	}
+	if err = os.Remove(s.ownerPath(key)); err != nil {
+		log.Warnf("failed to remove owner file %s: %+v", s.ownerPath(key), errors.WithStack(err))
 	}
-	if err = os.Remove(s.ownerPath(nep.IPv4)); err != nil {
-		log.Warnf("failed to remove owner file %s: %+v", s.ownerPath(nep.IPv4), errors.WithStack(err))
+	if err = os.Remove(s.ipv6Path(key)); err != nil && !os.IsNotExist(err) {
+		log.Warnf("failed to remove ipv6 file %s: %+v", s.ipv6Path(key), errors.WithStack(err))
+	}
+	pathfiles := []string{s.tenantPath(key), s.ownerPath(key), s.ipv6Path(key)}
+	if nep.IPv4 != "" && nep.IPv6 != "" {
+		if err = os.Remove(s.ipv4Path(nep.IPv6)); err != nil && !os.IsNotExist(err) {
+			log.Warnf("failed to remove ipv4 file %s: %+v", s.ipv4Path(nep.IPv6), errors.WithStack(err))
+		}
+		pathfiles = append(pathfiles, s.ipv4Path(nep.IPv6))
 	}
-	if err = os.Remove(s.flockPath(nep.IPv4)); err != nil {
-		log.Warnf("failed to remove flock file %s: %+v", s.flockPath(nep.IPv4), errors.WithStack(err))
+	if err = os.Remove(s.flockPath(key)); err != nil {
+		log.Warnf("failed to remove flock file %s: %+v", s.flockPath(key), errors.WithStack(err))
 	}
-	if err = syscall.Unmount(s.netnsPath(nep.IPv4), syscall.MNT_DETACH); err != nil {
-		log.Warnf("failed to umount netns file %s: %+v", s.netnsPath(nep.IPv4), errors.WithStack(err))
+	if err = syscall.Unmount(s.netnsPath(key), syscall.MNT_DETACH); err != nil {
+		log.Warnf("failed to umount netns file %s: %+v", s.netnsPath(key), errors.WithStack(err))
 	}
-	if err = os.Remove(s.netnsPath(nep.IPv4)); err != nil {
-		log.Warnf("failed to remove netns file %s: %+v", s.netnsPath(nep.IPv4), errors.WithStack(err))
+	if err = os.Remove(s.netnsPath(key)); err != nil {
+		log.Warnf("failed to remove netns file %s: %+v", s.netnsPath(key), errors.WithStack(err))
 	}
-	return assertFileNotExists(s.tenantPath(nep.IPv4), s.ownerPath(nep.IPv4), s.netnsPath(nep.IPv4), s.flockPath(nep.IPv4))
+	return assertFileNotExists(append(pathfiles, s.netnsPath(key), s.flockPath(key))...)
 }
 
 // OccupyNetEndpoint .
 func (s FSStore) OccupyNetEndpoint(containerID string, nep *cni.NetEndpoint) (err error) {
-	file, err := os.OpenFile(s.tenantPath(nep.IPv4), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	file, err := os.OpenFile(s.tenantPath(nep.Key()), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -163,17 +225,17 @@ func (s FSStore) OccupyNetEndpoint(containerID string, nep *cni.NetEndpoint) (er
 
 // FreeNetEndpoint .
 func (s FSStore) FreeNetEndpoint(containerID string, nep *cni.NetEndpoint) (err error) {
-	bs, err := ioutil.ReadFile(s.tenantPath(nep.IPv4))
+	bs, err := ioutil.ReadFile(s.tenantPath(nep.Key()))
 	if err != nil {
 		return errors.WithStack(err)
 	}
 	if string(bs) != containerID {
-		return errors.Errorf("invalid free request, id not match: %s, %s", nep.IPv4, containerID)
+		return errors.Errorf("invalid free request, id not match: %s, %s", nep.Key(), containerID)
 	}
-	if err = os.Remove(s.tenantPath(nep.IPv4)); err != nil {
-		log.Warnf("failed to remove tenant file %s: %+v", s.tenantPath(nep.IPv4), err)
+	if err = os.Remove(s.tenantPath(nep.Key())); err != nil {
+		log.Warnf("failed to remove tenant file %s: %+v", s.tenantPath(nep.Key()), err)
 	}
-	return assertFileNotExists(s.tenantPath(nep.IPv4))
+	return assertFileNotExists(s.tenantPath(nep.Key()))
 }
 
 // GetNetEndpointRefcount .
@@ -193,7 +255,7 @@ func (s FSStore) GetNetEndpointRefcount(nep *cni.NetEndpoint) (rc int, err error
 		}
 	}
 
-	if _, e := os.Stat(s.tenantPath(nep.IPv4)); e == nil {
+	if _, e := os.Stat(s.tenantPath(nep.Key())); e == nil {
 		rc++
 	}
 
@@ -0,0 +1,76 @@
+package filesystem
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/projecteru2/barrel/cni"
+)
+
+func newTestStore(t *testing.T) (*FSStore, string) {
+	dir := t.TempDir()
+	store, err := NewStore(filepath.Join(dir, "store"))
+	assert.NoError(t, err)
+	// a regular file is bind mounted in place of the netns of container
+	netns := filepath.Join(dir, "netns")
+	assert.NoError(t, ioutil.WriteFile(netns, nil, 0644))
+	if err := syscall.Mount(netns, netns, "none", syscall.MS_BIND, ""); err != nil {
+		t.Skipf("bind mount isn't permitted: %v", err)
+	}
+	assert.NoError(t, syscall.Unmount(netns, syscall.MNT_DETACH))
+	return store, netns
+}
+
+func TestNetEndpointKeyedByIPv4(t *testing.T) {
+	for _, ipv6 := range []string{"", "fd00::10"} {
+		store, netns := newTestStore(t)
+
+		nep, err := store.CreateNetEndpoint(netns, "owner", "10.10.10.10", ipv6)
+		assert.NoError(t, err)
+		assert.Equal(t, "10.10.10.10", nep.Key())
+		assert.NoError(t, store.ConnectNetEndpoint("containerID", nep))
+
+		got, err := store.GetNetEndpointByID("containerID")
+		assert.NoError(t, err)
+		assert.Equal(t, nep, got)
+		got, err = store.GetNetEndpointByIP("10.10.10.10")
+		assert.NoError(t, err)
+		assert.Equal(t, nep, got)
+		if ipv6 != "" {
+			// dual-stack nep is found by its ipv6 as well
+			got, err = store.GetNetEndpointByIP(ipv6)
+			assert.NoError(t, err)
+			assert.Equal(t, nep, got)
+		}
+
+		assert.NoError(t, store.DisconnectNetEndpoint("containerID", nep))
+		assert.NoError(t, store.DeleteNetEndpoint(nep))
+		got, err = store.GetNetEndpointByIP("10.10.10.10")
+		assert.NoError(t, err)
+		assert.Nil(t, got)
+		if ipv6 != "" {
+			got, err = store.GetNetEndpointByIP(ipv6)
+			assert.NoError(t, err)
+			assert.Nil(t, got)
+		}
+	}
+}
+
+func TestNetEndpointKeyedByIPv6(t *testing.T) {
+	store, netns := newTestStore(t)
+
+	nep, err := store.CreateNetEndpoint(netns, "owner", "", "fd00::10")
+	assert.NoError(t, err)
+	assert.Equal(t, "fd00::10", nep.Key())
+	got, err := store.GetNetEndpointByIP("fd00::10")
+	assert.NoError(t, err)
+	assert.Equal(t, &cni.NetEndpoint{IPv6: "fd00::10", Netns: nep.Netns, Owner: "owner"}, got)
+	assert.NoError(t, store.DeleteNetEndpoint(nep))
+
+	_, err = store.CreateNetEndpoint(netns, "owner", "", "")
+	assert.Error(t, err)
+}
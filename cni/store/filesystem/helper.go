@@ -19,10 +19,23 @@ func (s FSStore) ownerPath(ip string) string {
 	return filepath.Join(s.root, ip+"-owner")
 }
 
+func (s FSStore) ipv6Path(ip string) string {
+	return filepath.Join(s.root, ip+"-ipv6")
+}
+
+// ipv4Path indexes the ipv6 of dual-stack nep to the ipv4 it's keyed by
+func (s FSStore) ipv4Path(ipv6 string) string {
+	return filepath.Join(s.root, ipv6+"-ipv4")
+}
+
 func (s FSStore) flockPath(ip string) string {
 	return filepath.Join(s.root, ip+"-flock")
 }
 
+func (s FSStore) outcomesPath() string {
+	return filepath.Join(s.root, outcomesFile)
+}
+
 func assertFileNotExists(pathfiles ...string) (err error) {
 	for _, pathfile := range pathfiles {
 		if _, err := os.Stat(pathfile); err == nil {
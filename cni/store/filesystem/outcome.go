@@ -0,0 +1,78 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/projecteru2/barrel/cni"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	outcomesFile  = "outcomes.json"
+	outcomesFlock = "outcomes"
+)
+
+// RecordOutcome .
+func (s FSStore) RecordOutcome(subhandler, phase, result string) (err error) {
+	flock, err := s.GetFlock(outcomesFlock)
+	if err != nil {
+		return
+	}
+	if err = flock.Lock(); err != nil {
+		return
+	}
+	defer func() {
+		if e := flock.Unlock(); e != nil {
+			log.Errorf("failed to unlock outcomes: %+v", e)
+		}
+	}()
+
+	outcomes, err := s.readOutcomes()
+	if err != nil {
+		return
+	}
+	found := false
+	for i := range outcomes {
+		if outcomes[i].Subhandler == subhandler && outcomes[i].Phase == phase && outcomes[i].Result == result {
+			outcomes[i].Count++
+			found = true
+			break
+		}
+	}
+	if !found {
+		outcomes = append(outcomes, cni.Outcome{Subhandler: subhandler, Phase: phase, Result: result, Count: 1})
+	}
+	return s.writeOutcomes(outcomes)
+}
+
+// ListOutcomes .
+func (s FSStore) ListOutcomes() ([]cni.Outcome, error) {
+	return s.readOutcomes()
+}
+
+func (s FSStore) readOutcomes() (outcomes []cni.Outcome, err error) {
+	bs, err := ioutil.ReadFile(s.outcomesPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return outcomes, errors.WithStack(json.Unmarshal(bs, &outcomes))
+}
+
+// writeOutcomes replaces the file by rename, so readers without flock never see a partial write
+func (s FSStore) writeOutcomes(outcomes []cni.Outcome) error {
+	bs, err := json.Marshal(outcomes)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	tmp := s.outcomesPath() + ".tmp"
+	if err = ioutil.WriteFile(tmp, bs, 0644); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(tmp, s.outcomesPath()))
+}
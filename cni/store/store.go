@@ -14,8 +14,8 @@ type Store interface {
 	// DisconnectNetEndpoint unlinks a container to fixed-ip nep
 	DisconnectNetEndpoint(containerID string, _ *cni.NetEndpoint) error
 
-	// CreateNetEndpoint .
-	CreateNetEndpoint(netns, owner, ipv4 string) (*cni.NetEndpoint, error)
+	// CreateNetEndpoint creates a nep keyed by ipv4, or by ipv6 when ipv4 is blank
+	CreateNetEndpoint(netns, owner, ipv4, ipv6 string) (*cni.NetEndpoint, error)
 	// DeleteNetEndpoint .
 	DeleteNetEndpoint(*cni.NetEndpoint) error
 
@@ -29,6 +29,11 @@ type Store interface {
 
 	// GetFlock news a flock
 	GetFlock(ip string) (Flock, error)
+
+	// RecordOutcome increases the count of the subhandler phase result; multiprocess safe
+	RecordOutcome(subhandler, phase, result string) error
+	// ListOutcomes .
+	ListOutcomes() ([]cni.Outcome, error)
 }
 
 // Flock is a multiprocess mutex
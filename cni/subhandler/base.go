@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/projecteru2/barrel/cni"
@@ -17,13 +18,16 @@ import (
 type Base struct {
 	store store.Store
 	conf  config.Config
+	// serializes RemoveNetwork, which is called by both proxy and docker events watcher
+	removeMutex *sync.Mutex
 }
 
 // NewBase .
 func NewBase(conf config.Config, store store.Store) *Base {
 	return &Base{
-		conf:  conf,
-		store: store,
+		conf:        conf,
+		store:       store,
+		removeMutex: &sync.Mutex{},
 	}
 }
 
@@ -32,6 +36,11 @@ func (h *Base) Enabled() bool {
 	return h.conf != config.Config{}
 }
 
+// Outcomes lists outcomes recorded by barrel-cni
+func (h *Base) Outcomes() ([]cni.Outcome, error) {
+	return h.store.ListOutcomes()
+}
+
 // BorrowNetEndpoint will snatch the nep
 func (h *Base) BorrowNetEndpoint(containerMeta *cni.ContainerMeta, nep *cni.NetEndpoint) (err error) {
 	if err = h.store.OccupyNetEndpoint(containerMeta.ID(), nep); err != nil {
@@ -55,8 +64,14 @@ func (h *Base) CreateNetEndpoint(containerMeta *cni.ContainerMeta) (err error) {
 	if err != nil {
 		return
 	}
+	// ipv6 is best-effort, the nep is keyed by ipv4 when it's probed
+	ipv6, err := containerMeta.IPv6()
+	if err != nil {
+		log.Warnf("failed to probe ipv6 of %s: %+v", containerMeta.ID(), err)
+		ipv6, err = "", nil
+	}
 
-	nep, err := h.store.CreateNetEndpoint(containerMeta.Netns(), containerMeta.ID(), ipv4)
+	nep, err := h.store.CreateNetEndpoint(containerMeta.Netns(), containerMeta.ID(), ipv4, ipv6)
 	if err != nil {
 		return
 	}
@@ -84,7 +99,7 @@ func (h *Base) CreateNetEndpoint(containerMeta *cni.ContainerMeta) (err error) {
 
 // DeleteDanglingNetwork .
 func (h *Base) DeleteDanglingNetwork(nep *cni.NetEndpoint) (err error) {
-	return h.withFlock(nep.IPv4, func() (err error) {
+	return h.withFlock(nep.Key(), func() (err error) {
 		count, err := h.store.GetNetEndpointRefcount(nep)
 		if err != nil {
 			return
@@ -107,6 +122,9 @@ func (h *Base) DeleteDanglingNetwork(nep *cni.NetEndpoint) (err error) {
 
 // RemoveNetwork will be exposed to docker proxy in delete phase
 func (h *Base) RemoveNetwork(id string) (err error) {
+	h.removeMutex.Lock()
+	defer h.removeMutex.Unlock()
+
 	nep, err := h.store.GetNetEndpointByID(id)
 	if err != nil {
 		return
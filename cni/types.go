@@ -12,10 +12,27 @@ import (
 // NetEndpoint is the minimalist network unit
 type NetEndpoint struct {
 	IPv4  string
+	IPv6  string
 	Netns string
 	Owner string
 }
 
+// Key identifies the nep, ipv4 is preferred on dual-stack
+func (nep NetEndpoint) Key() string {
+	if nep.IPv4 != "" {
+		return nep.IPv4
+	}
+	return nep.IPv6
+}
+
+// Outcome counts results of a subhandler phase
+type Outcome struct {
+	Subhandler string
+	Phase      string
+	Result     string
+	Count      int64
+}
+
 // ContainerMeta .
 type ContainerMeta struct {
 	Meta oci.ContainerMeta
@@ -32,9 +49,23 @@ func (c ContainerMeta) RequiresFixedIP() bool {
 	return false
 }
 
-// SpecificIP .
+// SpecificIP returns the specific ipv4, or the specific ipv6 when ipv4 is not specified
 func (c ContainerMeta) SpecificIP() string {
-	return c.Meta.SpecificIP()
+	if ip := c.Meta.SpecificIP(); ip != "" {
+		return ip
+	}
+	return c.SpecificIPv6()
+}
+
+// SpecificIPv6 .
+func (c ContainerMeta) SpecificIPv6() string {
+	for _, env := range c.Meta.Spec.Process.Env {
+		parts := strings.SplitN(env, "=", 2)
+		if len(parts) == 2 && parts[0] == "IPV6" {
+			return parts[1]
+		}
+	}
+	return ""
 }
 
 // RequiresSpecificIP .
@@ -66,6 +97,11 @@ func (c ContainerMeta) IPv4() (ip string, err error) {
 	return utils.ProbeIPv4(c.Netns())
 }
 
+// IPv6 .
+func (c ContainerMeta) IPv6() (ip string, err error) {
+	return utils.ProbeIPv6(c.Netns())
+}
+
 // Save .
 func (c ContainerMeta) Save() error {
 	return c.Meta.Save()
@@ -8,7 +8,10 @@ import (
 	"github.com/projecteru2/barrel/utils"
 )
 
-var ipv4Pattern = regexp.MustCompile(`\d+\.\d+\.\d+\.\d+`)
+var (
+	ipv4Pattern = regexp.MustCompile(`\d+\.\d+\.\d+\.\d+`)
+	ipv6Pattern = regexp.MustCompile(`inet6\s+([0-9a-fA-F:]+)/\d+\s+scope global`)
+)
 
 // ProbeIPv4 investigate eth0 inside a netns
 func ProbeIPv4(netns string) (ip string, err error) {
@@ -22,3 +25,19 @@ func ProbeIPv4(netns string) (ip string, err error) {
 	}
 	return string(ipv4Pattern.Find(out)), nil
 }
+
+// ProbeIPv6 investigate global ipv6 address of eth0 inside a netns
+func ProbeIPv6(netns string) (ip string, err error) {
+	args := []string{"ip", "-6", "a", "sh", "eth0", "scope", "global"}
+	var out []byte
+	if err = utils.WithNetns(netns, func() error {
+		out, err = exec.Command(args[0], args[1:]...).Output() // nolint
+		return errors.WithStack(err)
+	}); err != nil {
+		return
+	}
+	if matches := ipv6Pattern.FindSubmatch(out); len(matches) == 2 {
+		return string(matches[1]), nil
+	}
+	return "", nil
+}
@@ -15,6 +15,7 @@ import (
 
 	"github.com/projecteru2/barrel/store"
 	"github.com/projecteru2/barrel/types"
+	"github.com/projecteru2/barrel/vessel"
 	"github.com/projecteru2/barrel/vessel/codecs"
 )
 
@@ -49,7 +50,7 @@ func (c *Ctr) InspectFixedIP(ctx context.Context, ip types.IP) (*types.IPInfo, b
 
 // ListFixedIP .
 func (c *Ctr) ListFixedIP(ctx context.Context, poolname string) ([]*types.IPInfo, error) {
-	codec := codecs.IPInfoMultiGetCodec{}
+	codec := codecs.IPInfoMultiGetCodec{PrefixKey: codecs.IPInfoPrefix(poolname)}
 	if err := c.store.GetMulti(ctx, &codec); err != nil {
 		return nil, err
 	}
@@ -272,3 +273,8 @@ type ListBlockOpt interface {
 	IPPool(context.Context, clientv3.IPPoolInterface) (*v3.IPPool, error)
 	CheckAffinity(*model.AllocationBlock) bool
 }
+
+// ReleaseFixedIPKey .
+func (c *Ctr) ReleaseFixedIPKey(ctx context.Context, network string, key string) error {
+	return vessel.ReleaseFixedIPKey(ctx, c.store, c.ipPool, network, key)
+}
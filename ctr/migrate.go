@@ -0,0 +1,72 @@
+package ctr
+
+import (
+	"context"
+
+	etcd "github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/juju/errors"
+
+	"github.com/projecteru2/barrel/vessel/codecs"
+)
+
+const migrateRetryMaxCount = 3
+
+// MigrateResult .
+type MigrateResult struct {
+	Migrated []string
+	// keys failed to migrate, with the cause
+	Failed map[string]error
+}
+
+// Migrate rewrites barrel records to the latest schema version,
+// each record is rewritten only when it's not modified since read
+func (c *Ctr) Migrate(ctx context.Context, dryRun bool) (MigrateResult, error) {
+	result := MigrateResult{Failed: make(map[string]error)}
+	resp, err := c.etcd.Get(ctx, codecs.Prefix()+"/", etcd.WithPrefix())
+	if err != nil {
+		return result, err
+	}
+	for _, kv := range resp.Kvs {
+		key := string(kv.Key)
+		migrated, err := c.migrateRecord(ctx, kv, dryRun)
+		if err != nil {
+			result.Failed[key] = err
+			continue
+		}
+		if migrated {
+			result.Migrated = append(result.Migrated, key)
+		}
+	}
+	return result, nil
+}
+
+func (c *Ctr) migrateRecord(ctx context.Context, kv *mvccpb.KeyValue, dryRun bool) (bool, error) {
+	key := string(kv.Key)
+	for cnt := 0; cnt < migrateRetryMaxCount; cnt++ {
+		value, migrated, err := codecs.MigrateRecord(key, string(kv.Value))
+		if err != nil || !migrated || dryRun {
+			return migrated, err
+		}
+		txnResp, err := c.etcd.Txn(ctx).If(
+			etcd.Compare(etcd.ModRevision(key), "=", kv.ModRevision),
+		).Then(
+			etcd.OpPut(key, value, etcd.WithLease(etcd.LeaseID(kv.Lease))),
+		).Else(
+			etcd.OpGet(key),
+		).Commit()
+		if err != nil {
+			return false, err
+		}
+		if txnResp.Succeeded {
+			return true, nil
+		}
+		kvs := txnResp.Responses[0].GetResponseRange().Kvs
+		if len(kvs) == 0 {
+			// deleted in the meantime
+			return false, nil
+		}
+		kv = kvs[0]
+	}
+	return false, errors.Errorf("record is modified during migrating for %d times", migrateRetryMaxCount)
+}
@@ -0,0 +1,67 @@
+package ctr
+
+import (
+	"context"
+	"strings"
+
+	etcd "github.com/coreos/etcd/clientv3"
+	"github.com/juju/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/projecteru2/barrel/vessel/codecs"
+)
+
+// MovePrefixResult .
+type MovePrefixResult struct {
+	Moved int
+	// keys modified during moving, or already existing under the new prefix
+	Skipped []string
+}
+
+// MovePrefix moves barrel keys under from to the same relative path under to,
+// each key is moved in a transaction, so it's either moved or kept as is,
+// barrel daemons using the old prefix should be stopped before moving
+func (c *Ctr) MovePrefix(ctx context.Context, from string, to string) (MovePrefixResult, error) {
+	var (
+		result MovePrefixResult
+		err    error
+	)
+	if from, err = codecs.NormalizePrefix(from); err != nil {
+		return result, err
+	}
+	if to, err = codecs.NormalizePrefix(to); err != nil {
+		return result, err
+	}
+	if strings.HasPrefix(to+"/", from+"/") || strings.HasPrefix(from+"/", to+"/") {
+		return result, errors.Errorf("prefix %s and %s are overlapped", from, to)
+	}
+
+	resp, err := c.etcd.Get(ctx, from+"/", etcd.WithPrefix())
+	if err != nil {
+		return result, err
+	}
+	for _, kv := range resp.Kvs {
+		var (
+			key    = string(kv.Key)
+			newKey = to + strings.TrimPrefix(key, from)
+		)
+		txnResp, err := c.etcd.Txn(ctx).If(
+			etcd.Compare(etcd.ModRevision(key), "=", kv.ModRevision),
+			etcd.Compare(etcd.CreateRevision(newKey), "=", 0),
+		).Then(
+			// keys attached to leases, e.g. retentions, keep expiring under the new prefix
+			etcd.OpPut(newKey, string(kv.Value), etcd.WithLease(etcd.LeaseID(kv.Lease))),
+			etcd.OpDelete(key),
+		).Commit()
+		if err != nil {
+			return result, err
+		}
+		if !txnResp.Succeeded {
+			log.WithField("Receiver", "Ctr").WithField("Method", "MovePrefix").Warnf("skip %s", key)
+			result.Skipped = append(result.Skipped, key)
+			continue
+		}
+		result.Moved++
+	}
+	return result, nil
+}
@@ -4,9 +4,16 @@ import (
 	"context"
 
 	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
 )
 
 // Client .
 type Client interface {
 	ContainerList(context.Context, dockerTypes.ContainerListOptions) ([]dockerTypes.Container, error)
 }
+
+// EventsClient .
+type EventsClient interface {
+	Events(context.Context, dockerTypes.EventsOptions) (<-chan events.Message, <-chan error)
+	ContainerInspect(context.Context, string) (dockerTypes.ContainerJSON, error)
+}
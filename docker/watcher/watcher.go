@@ -0,0 +1,227 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	dockerClient "github.com/docker/docker/client"
+
+	"github.com/projecteru2/barrel/cni/subhandler"
+	"github.com/projecteru2/barrel/docker"
+	"github.com/projecteru2/barrel/service"
+	"github.com/projecteru2/barrel/store"
+	"github.com/projecteru2/barrel/types"
+	"github.com/projecteru2/barrel/utils"
+	"github.com/projecteru2/barrel/vessel"
+	"github.com/projecteru2/barrel/vessel/codecs"
+)
+
+const (
+	actionDestroy    = "destroy"
+	actionDisconnect = "disconnect"
+
+	minReconnectInterval = time.Second
+	maxReconnectInterval = 30 * time.Second
+)
+
+type eventsWatcher struct {
+	utils.LoggerFactory
+	client  docker.EventsClient
+	cniBase *subhandler.Base
+	vessel.Helper
+	timeout time.Duration
+	cursor  types.EventCursor
+}
+
+// NewEventsWatcher watches dockerd events and releases resources of containers
+// which are removed without barrel proxy
+func NewEventsWatcher(client docker.EventsClient, vess vessel.Helper, cniBase *subhandler.Base, timeout time.Duration) service.Service {
+	return &eventsWatcher{
+		LoggerFactory: utils.NewObjectLogger("eventsWatcher"),
+		client:        client,
+		cniBase:       cniBase,
+		Helper:        vess,
+		timeout:       timeout,
+		cursor:        types.EventCursor{HostName: vess.Hostname()},
+	}
+}
+
+// Serve .
+func (w *eventsWatcher) Serve(ctx context.Context) (service.Disposable, error) {
+	logger := w.Logger("Serve")
+
+	w.loadCursor(ctx)
+	interval := minReconnectInterval
+	for {
+		received, err := w.watch(ctx)
+		if ctx.Err() != nil {
+			logger.Info("Done")
+			return w, nil
+		}
+		if received {
+			interval = minReconnectInterval
+		}
+		logger.Warnf("events stream broken, will reconnect in %v, cause=%v", interval, err)
+		select {
+		case <-ctx.Done():
+			logger.Info("Done")
+			return w, nil
+		case <-time.After(interval):
+		}
+		if interval *= 2; interval > maxReconnectInterval {
+			interval = maxReconnectInterval
+		}
+	}
+}
+
+// Dispose .
+func (w *eventsWatcher) Dispose(ctx context.Context) error {
+	return nil
+}
+
+func (w *eventsWatcher) loadCursor(ctx context.Context) {
+	logger := w.Logger("loadCursor")
+
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	err := w.Get(ctx, &codecs.EventCursorCodec{Cursor: &w.cursor})
+	if err == nil {
+		logger.Infof("resume from %v", time.Unix(0, w.cursor.TimeNano))
+		return
+	}
+	if store.ErrButOtherThenKVUnexistsErr(err) {
+		logger.Errorf("get events cursor error, will watch from now, cause=%v", err)
+	}
+	// there is no cursor, so we start from now and don't replay the whole history
+	w.saveCursor(ctx, time.Now().UnixNano())
+}
+
+func (w *eventsWatcher) saveCursor(ctx context.Context, timeNano int64) {
+	if timeNano <= w.cursor.TimeNano {
+		return
+	}
+	w.cursor.TimeNano = timeNano
+	if err := w.Put(ctx, &codecs.EventCursorCodec{Cursor: &w.cursor}); err != nil {
+		w.Logger("saveCursor").Errorf("save events cursor error, cause=%v", err)
+	}
+}
+
+func (w *eventsWatcher) watch(ctx context.Context) (bool, error) {
+	logger := w.Logger("watch")
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	options := dockerTypes.EventsOptions{
+		Since: formatTimeNano(w.cursor.TimeNano),
+		Filters: filters.NewArgs(
+			filters.Arg("type", events.ContainerEventType),
+			filters.Arg("type", events.NetworkEventType),
+			filters.Arg("event", actionDestroy),
+			filters.Arg("event", actionDisconnect),
+		),
+	}
+	logger.Infof("watching events since %s", options.Since)
+
+	received := false
+	msgs, errs := w.client.Events(ctx, options)
+	for {
+		select {
+		case msg := <-msgs:
+			// the stream is broken on failure, so the event is handled again after reconnected
+			if err := w.handle(ctx, msg); err != nil {
+				return received, err
+			}
+			received = true
+		case err := <-errs:
+			return received, err
+		}
+	}
+}
+
+// handle advances the cursor only after the event is handled,
+// handlers are all idempotent, so events are safe to be handled again
+func (w *eventsWatcher) handle(ctx context.Context, msg events.Message) error {
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	var err error
+	switch {
+	case msg.Type == events.ContainerEventType && msg.Action == actionDestroy:
+		err = w.handleContainerDestroy(ctx, msg.Actor.ID)
+	case msg.Type == events.NetworkEventType && msg.Action == actionDisconnect:
+		err = w.handleNetworkDisconnect(ctx, msg.Actor.Attributes["container"], msg.Actor.Attributes["name"])
+	}
+	if err != nil {
+		return err
+	}
+	w.saveCursor(ctx, msg.TimeNano)
+	return nil
+}
+
+// releases the same resources as containerDeleteHandler does,
+// both cni network removing and addresses releasing are idempotent
+func (w *eventsWatcher) handleContainerDestroy(ctx context.Context, containerID string) error {
+	logger := w.Logger("handleContainerDestroy")
+	logger.Infof("container(%s) destroyed", containerID)
+
+	var cniErr error
+	if w.cniBase != nil && w.cniBase.Enabled() {
+		if cniErr = w.cniBase.RemoveNetwork(containerID); cniErr != nil {
+			logger.Errorf("release CNI resources of container(%s) error, cause=%+v", containerID, cniErr)
+		}
+	}
+	if err := w.ReleaseContainerAddresses(ctx, containerID); err != nil {
+		logger.Errorf("release reserved IP of container(%s) error, cause=%v", containerID, err)
+		return err
+	}
+	return cniErr
+}
+
+// releases the same resources as networkDisconnectHandler does
+func (w *eventsWatcher) handleNetworkDisconnect(ctx context.Context, containerID string, networkName string) error {
+	logger := w.Logger("handleNetworkDisconnect")
+	if containerID == "" || networkName == "" {
+		return nil
+	}
+
+	container, err := w.client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		if dockerClient.IsErrNotFound(err) {
+			// the container is removed, resources will be released on destroy event
+			return nil
+		}
+		logger.Errorf("inspect container(%s) error, cause=%v", containerID, err)
+		return err
+	}
+	if container.NetworkSettings != nil {
+		if _, ok := container.NetworkSettings.Networks[networkName]; ok {
+			// the endpoint is left because of container stopping, network is still configured
+			return nil
+		}
+	}
+
+	pools, err := w.DockerNetworkManager().GetPoolsByNetworkName(ctx, networkName)
+	if err != nil {
+		if err != types.ErrUnsupervisedNetwork {
+			logger.Errorf("get pools of network(%s) error, cause=%v", networkName, err)
+			return err
+		}
+		return nil
+	}
+	logger.Infof("container(%s) disconnected from network(%s)", containerID, networkName)
+	if err := w.ReleaseContainerAddressesByIPPools(ctx, containerID, pools); err != nil {
+		logger.Errorf("release container(%s) reserved address error, cause=%v", containerID, err)
+		return err
+	}
+	return nil
+}
+
+func formatTimeNano(timeNano int64) string {
+	return fmt.Sprintf("%d.%09d", timeNano/int64(time.Second), timeNano%int64(time.Second))
+}
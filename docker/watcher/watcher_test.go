@@ -0,0 +1,279 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/network"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/projecteru2/barrel/store"
+	"github.com/projecteru2/barrel/store/memory"
+	"github.com/projecteru2/barrel/types"
+	"github.com/projecteru2/barrel/vessel"
+	"github.com/projecteru2/barrel/vessel/codecs"
+	"github.com/projecteru2/barrel/vessel/mocks"
+	"github.com/projecteru2/barrel/vessel/vesseltest"
+)
+
+type eventStream struct {
+	msgs chan events.Message
+	errs chan error
+}
+
+// fakeEventsClient serves an event stream for each call of Events
+type fakeEventsClient struct {
+	mutex      sync.Mutex
+	streams    []eventStream
+	options    []dockerTypes.EventsOptions
+	containers map[string]dockerTypes.ContainerJSON
+}
+
+func newFakeEventsClient(streams int) *fakeEventsClient {
+	client := &fakeEventsClient{containers: make(map[string]dockerTypes.ContainerJSON)}
+	for i := 0; i < streams; i++ {
+		client.streams = append(client.streams, eventStream{msgs: make(chan events.Message), errs: make(chan error, 1)})
+	}
+	return client
+}
+
+func (c *fakeEventsClient) Events(ctx context.Context, options dockerTypes.EventsOptions) (<-chan events.Message, <-chan error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.options = append(c.options, options)
+	if len(c.options) > len(c.streams) {
+		c.streams = append(c.streams, eventStream{msgs: make(chan events.Message), errs: make(chan error, 1)})
+	}
+	stream := c.streams[len(c.options)-1]
+	// the stream is broken when ctx is done, as dockerd client does
+	go func() {
+		<-ctx.Done()
+		select {
+		case stream.errs <- ctx.Err():
+		default:
+		}
+	}()
+	return stream.msgs, stream.errs
+}
+
+func (c *fakeEventsClient) ContainerInspect(ctx context.Context, id string) (dockerTypes.ContainerJSON, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	container, ok := c.containers[id]
+	if !ok {
+		return container, notFoundError{}
+	}
+	return container, nil
+}
+
+func (c *fakeEventsClient) calls() []dockerTypes.EventsOptions {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return append([]dockerTypes.EventsOptions{}, c.options...)
+}
+
+type notFoundError struct{}
+
+func (notFoundError) Error() string {
+	return "no such container"
+}
+
+func (notFoundError) NotFound() {}
+
+func newTestWatcher(client *fakeEventsClient, stor store.Store, dockerNetworkManager vessel.DockerNetworkManager) *eventsWatcher {
+	calicoIPAllocator := &mocks.CalicoIPAllocator{}
+	calicoIPAllocator.On("UnallocIP", mock.Anything, mock.Anything).Return(nil)
+	helper := vesseltest.NewHelper(calicoIPAllocator, dockerNetworkManager, stor)
+	return NewEventsWatcher(client, helper, nil, time.Second).(*eventsWatcher)
+}
+
+func TestHandleEvents(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(6)*time.Second)
+	defer cancel()
+
+	var (
+		stor    = memory.NewMemoryStore()
+		address = types.IP{PoolID: "pool1", Address: "10.10.10.10"}
+		kept    = types.IP{PoolID: "pool2", Address: "10.10.20.10"}
+		ipInfo  = types.IPInfo{PoolID: address.PoolID, Address: address.Address, Attrs: &types.IPAttributes{}}
+	)
+	dockerNetworkManager := &mocks.DockerNetworkManager{}
+	dockerNetworkManager.On("GetPoolsByNetworkName", mock.Anything, "net1").Return([]types.Pool{{Name: "pool1"}}, nil)
+
+	client := newFakeEventsClient(0)
+	client.containers["running"] = dockerTypes.ContainerJSON{NetworkSettings: &dockerTypes.NetworkSettings{
+		Networks: map[string]*network.EndpointSettings{"net1": {}},
+	}}
+	client.containers["disconnected"] = dockerTypes.ContainerJSON{NetworkSettings: &dockerTypes.NetworkSettings{}}
+	w := newTestWatcher(client, stor, dockerNetworkManager)
+
+	for _, id := range []string{"destroyed", "running", "disconnected"} {
+		record := types.ContainerInfo{Container: types.Container{ID: id, HostName: "localhost"}, Addresses: []types.IP{address, kept}}
+		assert.NoError(t, stor.Put(ctx, &codecs.ContainerInfoCodec{Info: &record}))
+		ipInfo.Attrs.Borrowers = append(ipInfo.Attrs.Borrowers, record.Container)
+	}
+	ipInfo.Status.Mark(types.IPStatusInUse)
+	assert.NoError(t, stor.Put(ctx, &codecs.IPInfoCodec{IPInfo: &ipInfo}))
+	getBorrowers := func() []string {
+		ipInfo := types.IPInfo{PoolID: address.PoolID, Address: address.Address}
+		assert.NoError(t, stor.Get(ctx, &codecs.IPInfoCodec{IPInfo: &ipInfo}))
+		var borrowers []string
+		for _, borrower := range ipInfo.Attrs.Borrowers {
+			borrowers = append(borrowers, borrower.ID)
+		}
+		return borrowers
+	}
+	getAddresses := func(id string) []types.IP {
+		record := types.ContainerInfo{Container: types.Container{ID: id, HostName: "localhost"}}
+		if err := stor.Get(ctx, &codecs.ContainerInfoCodec{Info: &record}); err != nil {
+			return nil
+		}
+		return record.Addresses
+	}
+
+	// addresses of the destroyed container are all released with its record
+	assert.NoError(t, w.handle(ctx, events.Message{
+		Type:     events.ContainerEventType,
+		Action:   actionDestroy,
+		Actor:    events.Actor{ID: "destroyed"},
+		TimeNano: 100,
+	}))
+	assert.Nil(t, getAddresses("destroyed"))
+	assert.Equal(t, []string{"running", "disconnected"}, getBorrowers())
+
+	// the endpoint of the running container is left on stopping, the network is kept
+	assert.NoError(t, w.handle(ctx, events.Message{
+		Type:     events.NetworkEventType,
+		Action:   actionDisconnect,
+		Actor:    events.Actor{Attributes: map[string]string{"container": "running", "name": "net1"}},
+		TimeNano: 200,
+	}))
+	assert.Equal(t, []types.IP{address, kept}, getAddresses("running"))
+	assert.Equal(t, []string{"running", "disconnected"}, getBorrowers())
+
+	// only addresses of the disconnected network are released
+	assert.NoError(t, w.handle(ctx, events.Message{
+		Type:     events.NetworkEventType,
+		Action:   actionDisconnect,
+		Actor:    events.Actor{Attributes: map[string]string{"container": "disconnected", "name": "net1"}},
+		TimeNano: 300,
+	}))
+	assert.Equal(t, []types.IP{kept}, getAddresses("disconnected"))
+	assert.Equal(t, []string{"running"}, getBorrowers())
+
+	// events of removed containers are skipped
+	assert.NoError(t, w.handle(ctx, events.Message{
+		Type:     events.NetworkEventType,
+		Action:   actionDisconnect,
+		Actor:    events.Actor{Attributes: map[string]string{"container": "removed", "name": "net1"}},
+		TimeNano: 400,
+	}))
+
+	cursor := types.EventCursor{HostName: "localhost"}
+	assert.NoError(t, stor.Get(ctx, &codecs.EventCursorCodec{Cursor: &cursor}))
+	assert.Equal(t, int64(400), cursor.TimeNano)
+}
+
+func TestReconnectAfterStreamError(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(6)*time.Second)
+	defer cancel()
+
+	stor := memory.NewMemoryStore()
+	client := newFakeEventsClient(2)
+	w := newTestWatcher(client, stor, &mocks.DockerNetworkManager{})
+
+	// the cursor of last run is resumed
+	start := time.Now().UnixNano()
+	assert.NoError(t, stor.Put(ctx, &codecs.EventCursorCodec{Cursor: &types.EventCursor{HostName: "localhost", TimeNano: start}}))
+
+	serveCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := w.Serve(serveCtx)
+		assert.NoError(t, err)
+	}()
+
+	client.streams[0].msgs <- events.Message{Type: events.ContainerEventType, Action: actionDestroy, Actor: events.Actor{ID: "unknown"}, TimeNano: start + 1}
+	client.streams[0].errs <- errors.New("unexpected EOF")
+
+	assert.Eventually(t, func() bool { return len(client.calls()) == 2 }, 3*time.Second, 50*time.Millisecond)
+	calls := client.calls()
+	assert.Equal(t, formatTimeNano(start), calls[0].Since)
+	// events handled before the stream broken are not replayed
+	assert.Equal(t, formatTimeNano(start+1), calls[1].Since)
+
+	stop()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("watcher isn't stopped after ctx is canceled")
+	}
+}
+
+func TestFailedEventHandledAgainAfterReconnected(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(6)*time.Second)
+	defer cancel()
+
+	var (
+		stor    = memory.NewMemoryStore()
+		address = types.IP{PoolID: "pool1", Address: "10.10.10.10"}
+		record  = types.ContainerInfo{Container: types.Container{ID: "disconnected", HostName: "localhost"}, Addresses: []types.IP{address}}
+	)
+	dockerNetworkManager := &mocks.DockerNetworkManager{}
+	dockerNetworkManager.On("GetPoolsByNetworkName", mock.Anything, "net1").Return(nil, errors.New("etcdserver: request timed out")).Once()
+	dockerNetworkManager.On("GetPoolsByNetworkName", mock.Anything, "net1").Return([]types.Pool{{Name: "pool1"}}, nil)
+
+	client := newFakeEventsClient(2)
+	client.containers["disconnected"] = dockerTypes.ContainerJSON{NetworkSettings: &dockerTypes.NetworkSettings{}}
+	w := newTestWatcher(client, stor, dockerNetworkManager)
+	assert.NoError(t, stor.Put(ctx, &codecs.ContainerInfoCodec{Info: &record}))
+
+	start := time.Now().UnixNano()
+	assert.NoError(t, stor.Put(ctx, &codecs.EventCursorCodec{Cursor: &types.EventCursor{HostName: "localhost", TimeNano: start}}))
+
+	serveCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := w.Serve(serveCtx)
+		assert.NoError(t, err)
+	}()
+
+	msg := events.Message{
+		Type:     events.NetworkEventType,
+		Action:   actionDisconnect,
+		Actor:    events.Actor{Attributes: map[string]string{"container": "disconnected", "name": "net1"}},
+		TimeNano: start + 1,
+	}
+	client.streams[0].msgs <- msg
+
+	// the cursor isn't advanced, so the failed event is replayed after reconnected
+	assert.Eventually(t, func() bool { return len(client.calls()) == 2 }, 3*time.Second, 50*time.Millisecond)
+	assert.Equal(t, formatTimeNano(start), client.calls()[1].Since)
+	client.streams[1].msgs <- msg
+
+	assert.Eventually(t, func() bool {
+		cursor := types.EventCursor{HostName: "localhost"}
+		return stor.Get(ctx, &codecs.EventCursorCodec{Cursor: &cursor}) == nil && cursor.TimeNano == start+1
+	}, 3*time.Second, 50*time.Millisecond)
+	released := types.ContainerInfo{Container: record.Container}
+	assert.NoError(t, stor.Get(ctx, &codecs.ContainerInfoCodec{Info: &released}))
+	assert.Empty(t, released.Addresses)
+
+	stop()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("watcher isn't stopped after ctx is canceled")
+	}
+}
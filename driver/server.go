@@ -1,6 +1,8 @@
 package driver
 
 import (
+	"path/filepath"
+
 	pluginIpam "github.com/docker/go-plugins-helpers/ipam"
 	pluginNetwork "github.com/docker/go-plugins-helpers/network"
 	log "github.com/sirupsen/logrus"
@@ -11,8 +13,15 @@ const (
 	IpamSuffix = "-ipam"
 	// DriverName .
 	DriverName = "calico"
+	// PluginSocketDir is where go-plugins-helpers creates plugin sockets
+	PluginSocketDir = "/run/docker/plugins"
 )
 
+// PluginSocketPath .
+func PluginSocketPath(name string) string {
+	return filepath.Join(PluginSocketDir, name+".sock")
+}
+
 // PluginServer .
 type PluginServer interface {
 	ServeIpam(pluginIpam.Ipam) error
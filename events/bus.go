@@ -0,0 +1,144 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/projecteru2/barrel/service"
+)
+
+const (
+	defaultBufferSize = 1024
+)
+
+// bus is set once on start, events are dropped when no bus is set
+var bus *Bus
+
+// Init sets the bus events are published to
+func Init(b *Bus) {
+	bus = b
+}
+
+// Publish sends the event to sinks of the bus, it never blocks,
+// the event is dropped when the bus is not served or a sink falls behind
+func Publish(event Event) {
+	if bus == nil {
+		return
+	}
+	bus.Publish(event)
+}
+
+// Bus delivers events to sinks, each sink is fed by its own queue,
+// so a slow sink never holds back the others
+type Bus struct {
+	hostname string
+	queues   []*queue
+	mutex    sync.RWMutex
+	closed   bool
+	wg       sync.WaitGroup
+	// sending outlives the serving ctx, so queued events are sent on dispose
+	sendCtx context.Context
+	cancel  context.CancelFunc
+}
+
+type queue struct {
+	sink   Sink
+	events chan Event
+}
+
+// NewBus .
+func NewBus(hostname string, bufferSize int, sinks ...Sink) *Bus {
+	if bufferSize <= 0 {
+		bufferSize = defaultBufferSize
+	}
+	b := &Bus{hostname: hostname}
+	b.sendCtx, b.cancel = context.WithCancel(context.Background())
+	for _, sink := range sinks {
+		b.queues = append(b.queues, &queue{sink: sink, events: make(chan Event, bufferSize)})
+	}
+	return b
+}
+
+// Publish .
+func (b *Bus) Publish(event Event) {
+	if event.HostName == "" {
+		event.HostName = b.hostname
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	if b.closed {
+		return
+	}
+	for _, q := range b.queues {
+		select {
+		case q.events <- event:
+		default:
+			b.logger("Publish").Warnf("queue of sink %s is full, event %s dropped", q.sink.Name(), event.Kind)
+		}
+	}
+}
+
+// Serve delivers events until ctx is done
+func (b *Bus) Serve(ctx context.Context) (service.Disposable, error) {
+	logger := b.logger("Serve")
+	logger.Infof("starting, %d sinks", len(b.queues))
+
+	for _, q := range b.queues {
+		b.wg.Add(1)
+		go func(q *queue) {
+			defer b.wg.Done()
+			for event := range q.events {
+				if err := q.sink.Send(b.sendCtx, event); err != nil {
+					logger.WithError(err).Errorf("send event %s to sink %s error", event.Kind, q.sink.Name())
+				}
+			}
+		}(q)
+	}
+	<-ctx.Done()
+	logger.Info("Done")
+	return b, nil
+}
+
+// Dispose stops accepting events, and closes sinks after queued events are sent or ctx is done
+func (b *Bus) Dispose(ctx context.Context) error {
+	b.mutex.Lock()
+	if !b.closed {
+		b.closed = true
+		for _, q := range b.queues {
+			close(q.events)
+		}
+	}
+	b.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		b.logger("Dispose").Warn("queued events are not all sent")
+		// sinks give up sending on cancel, so they are not closed while sending
+		b.cancel()
+		<-done
+	}
+	b.cancel()
+	for _, q := range b.queues {
+		if err := q.sink.Close(); err != nil {
+			b.logger("Dispose").WithError(err).Errorf("close sink %s error", q.sink.Name())
+		}
+	}
+	return nil
+}
+
+func (b *Bus) logger(method string) *log.Entry {
+	return log.WithField("Receiver", "Bus").WithField("Method", method)
+}
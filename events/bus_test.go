@@ -0,0 +1,117 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/projecteru2/barrel/types"
+)
+
+func serve(t *testing.T, bus *Bus) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		_, err := bus.Serve(ctx)
+		assert.NoError(t, err)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+		disposeCtx, disposeCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer disposeCancel()
+		assert.NoError(t, bus.Dispose(disposeCtx))
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	sink, err := NewFileSink(path)
+	assert.NoError(t, err)
+
+	bus := NewBus("localhost", 0, sink)
+	stop := serve(t, bus)
+	ip := types.IP{PoolID: "poolID", Address: "10.10.10.10"}
+	bus.Publish(FixedIPEvent(FixedIPAllocated, ip))
+	bus.Publish(ContainerEvent(ContainerCreated, types.ContainerInfo{
+		Container: types.Container{ID: "containerID", HostName: "localhost"},
+		Addresses: []types.IP{ip},
+	}))
+	stop()
+	// events published after disposed are dropped
+	bus.Publish(FixedIPEvent(FixedIPUnallocated, ip))
+
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	var received []Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event Event
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		received = append(received, event)
+	}
+	assert.Len(t, received, 2)
+	assert.Equal(t, FixedIPAllocated, received[0].Kind)
+	assert.Equal(t, "localhost", received[0].HostName)
+	assert.Equal(t, ip, *received[0].IP)
+	assert.False(t, received[0].Time.IsZero())
+	assert.Equal(t, ContainerCreated, received[1].Kind)
+	assert.Equal(t, "containerID", received[1].Container.ID)
+	assert.Equal(t, []types.IP{ip}, received[1].Addresses)
+}
+
+func TestWebhookSinkRetries(t *testing.T) {
+	var (
+		mutex    sync.Mutex
+		attempts int
+		received []Event
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if attempts++; attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var event Event
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		received = append(received, event)
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(WebhookConfig{URL: server.URL, Retries: 3, Backoff: 10 * time.Millisecond})
+	ip := types.IP{PoolID: "poolID", Address: "10.10.10.10"}
+	assert.NoError(t, sink.Send(context.Background(), BorrowerEvent(FixedIPBorrowed, ip, types.Container{ID: "containerID"})))
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, 3, attempts)
+	assert.Len(t, received, 1)
+	assert.Equal(t, FixedIPBorrowed, received[0].Kind)
+	assert.Equal(t, "containerID", received[0].Container.ID)
+}
+
+func TestWebhookSinkGivesUp(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(WebhookConfig{URL: server.URL, Retries: 2, Backoff: 10 * time.Millisecond})
+	assert.Error(t, sink.Send(context.Background(), FixedIPEvent(FixedIPAllocated, types.IP{Address: "10.10.10.10"})))
+	assert.Equal(t, 3, attempts)
+}
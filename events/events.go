@@ -0,0 +1,58 @@
+package events
+
+import (
+	"time"
+
+	"github.com/projecteru2/barrel/types"
+)
+
+// Kind .
+type Kind string
+
+const (
+	// FixedIPAllocated the fixed ip is allocated in calico and recorded
+	FixedIPAllocated Kind = "fixed-ip.allocated"
+	// FixedIPAssigned the fixed ip is assigned to a container
+	FixedIPAssigned Kind = "fixed-ip.assigned"
+	// FixedIPUnassigned the fixed ip is unassigned from its container
+	FixedIPUnassigned Kind = "fixed-ip.unassigned"
+	// FixedIPBorrowed the fixed ip is borrowed by a container
+	FixedIPBorrowed Kind = "fixed-ip.borrowed"
+	// FixedIPReturned the fixed ip is returned by a container
+	FixedIPReturned Kind = "fixed-ip.returned"
+	// FixedIPUnallocated the fixed ip record is removed and the ip is unallocated in calico
+	FixedIPUnallocated Kind = "fixed-ip.unallocated"
+	// ContainerCreated the container record is created
+	ContainerCreated Kind = "container.created"
+	// ContainerDeleted the container record is deleted
+	ContainerDeleted Kind = "container.deleted"
+)
+
+// Event .
+type Event struct {
+	Kind     Kind
+	HostName string
+	Time     time.Time
+	// the fixed ip of fixed-ip events
+	IP *types.IP `json:",omitempty"`
+	// the container of container events, and the borrower of borrow and return events
+	Container *types.Container `json:",omitempty"`
+	// addresses of the container record
+	Addresses []types.IP `json:",omitempty"`
+}
+
+// FixedIPEvent .
+func FixedIPEvent(kind Kind, ip types.IP) Event {
+	return Event{Kind: kind, IP: &ip}
+}
+
+// BorrowerEvent .
+func BorrowerEvent(kind Kind, ip types.IP, container types.Container) Event {
+	return Event{Kind: kind, IP: &ip, Container: &container}
+}
+
+// ContainerEvent .
+func ContainerEvent(kind Kind, info types.ContainerInfo) Event {
+	container := info.Container
+	return Event{Kind: kind, Container: &container, Addresses: info.Addresses}
+}
@@ -0,0 +1,180 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultWebhookTimeout    = 5 * time.Second
+	defaultWebhookBackoff    = 500 * time.Millisecond
+	defaultWebhookMaxBackoff = 30 * time.Second
+)
+
+// Sink .
+type Sink interface {
+	Name() string
+	// Send is called by one goroutine at a time
+	Send(context.Context, Event) error
+	Close() error
+}
+
+type logSink struct{}
+
+// NewLogSink logs events
+func NewLogSink() Sink {
+	return logSink{}
+}
+
+func (logSink) Name() string {
+	return "log"
+}
+
+func (logSink) Send(ctx context.Context, event Event) error {
+	entry := log.WithField("Kind", event.Kind).WithField("HostName", event.HostName)
+	if event.IP != nil {
+		entry = entry.WithField("IP", *event.IP)
+	}
+	if event.Container != nil {
+		entry = entry.WithField("Container", event.Container.ID)
+	}
+	if len(event.Addresses) > 0 {
+		entry = entry.WithField("Addresses", event.Addresses)
+	}
+	entry.Info("event")
+	return nil
+}
+
+func (logSink) Close() error {
+	return nil
+}
+
+type fileSink struct {
+	path    string
+	mutex   sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// NewFileSink appends events to the file as json lines
+func NewFileSink(path string) (Sink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{path: path, file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+func (s *fileSink) Name() string {
+	return "file:" + s.path
+}
+
+func (s *fileSink) Send(ctx context.Context, event Event) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.encoder.Encode(event)
+}
+
+func (s *fileSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.file.Close()
+}
+
+// WebhookConfig .
+type WebhookConfig struct {
+	URL string
+	// timeout of each attempt
+	Timeout time.Duration
+	// attempts after the first one failed
+	Retries int
+	// backoff before the first retry, doubled on each retry up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+type webhookSink struct {
+	config WebhookConfig
+	client *http.Client
+}
+
+// NewWebhookSink posts events to the url as json, retries with exponential backoff
+// when the request fails or the response status isn't 2xx
+func NewWebhookSink(config WebhookConfig) Sink {
+	if config.Timeout <= 0 {
+		config.Timeout = defaultWebhookTimeout
+	}
+	if config.Retries < 0 {
+		config.Retries = 0
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = defaultWebhookBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = defaultWebhookMaxBackoff
+	}
+	return &webhookSink{config: config, client: &http.Client{Timeout: config.Timeout}}
+}
+
+func (s *webhookSink) Name() string {
+	return "webhook:" + s.config.URL
+}
+
+func (s *webhookSink) Send(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	backoff := s.config.Backoff
+	for attempt := 0; ; attempt++ {
+		if err = s.post(ctx, body); err == nil {
+			return nil
+		}
+		if attempt >= s.config.Retries {
+			return errors.Annotatef(err, "give up after %d attempts", attempt+1)
+		}
+		s.logger("Send").WithError(err).Warnf("post event %s error, retry in %v", event.Kind, backoff)
+		select {
+		case <-ctx.Done():
+			return errors.Annotate(err, "canceled")
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > s.config.MaxBackoff {
+			backoff = s.config.MaxBackoff
+		}
+	}
+}
+
+func (s *webhookSink) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *webhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+func (s *webhookSink) logger(method string) *log.Entry {
+	return log.WithField("Receiver", "webhookSink").WithField("Method", method)
+}
@@ -0,0 +1,120 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+type (
+	peerCredKey struct{}
+	identityKey struct{}
+)
+
+// PeerCred is the credentials of the process connected over unix socket
+type PeerCred struct {
+	UID uint32
+	GID uint32
+	PID int32
+}
+
+// PeerCredFromContext returns the peer credentials of the connection serving the request
+func PeerCredFromContext(ctx context.Context) (PeerCred, bool) {
+	cred, ok := ctx.Value(peerCredKey{}).(PeerCred)
+	return cred, ok
+}
+
+// withPeerCred attaches credentials of the peer to the connection context by SO_PEERCRED,
+// connections other than unix socket are left untouched
+func withPeerCred(ctx context.Context, conn net.Conn) context.Context {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return ctx
+	}
+	rawConn, err := unixConn.SyscallConn()
+	if err != nil {
+		log.WithError(err).Warn("get raw conn of unix socket error")
+		return ctx
+	}
+	var (
+		ucred   *unix.Ucred
+		credErr error
+	)
+	if err = rawConn.Control(func(fd uintptr) {
+		ucred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err == nil {
+		err = credErr
+	}
+	if err != nil {
+		log.WithError(err).Warn("get peer credentials of unix socket error")
+		return ctx
+	}
+	return context.WithValue(ctx, peerCredKey{}, PeerCred{UID: ucred.Uid, GID: ucred.Gid, PID: ucred.Pid})
+}
+
+// Identity is the identity of the client of the request
+type Identity struct {
+	// credentials of the client connected over unix socket
+	Peer *PeerCred `json:",omitempty"`
+	// common name of the verified certificate of the client connected over tls
+	TLSClient string `json:",omitempty"`
+	// subject alternative names of the verified certificate, dns names, emails, ips and uris
+	TLSSANs []string `json:",omitempty"`
+}
+
+func (identity Identity) String() string {
+	switch {
+	case identity.Peer != nil:
+		return fmt.Sprintf("uid=%d,gid=%d,pid=%d", identity.Peer.UID, identity.Peer.GID, identity.Peer.PID)
+	case identity.TLSClient != "" || len(identity.TLSSANs) > 0:
+		return fmt.Sprintf("tls=%s,sans=%v", identity.TLSClient, identity.TLSSANs)
+	default:
+		return "anonymous"
+	}
+}
+
+// IdentityFromContext returns the identity of the client put by the server
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+// IdentityOf returns the identity of the client of the request
+func IdentityOf(req *http.Request) Identity {
+	if identity, ok := IdentityFromContext(req.Context()); ok {
+		return identity
+	}
+	return identityOf(req)
+}
+
+// identityOf reads the identity from the connection, certificates not verified are ignored
+func identityOf(req *http.Request) Identity {
+	identity := Identity{}
+	if cred, ok := PeerCredFromContext(req.Context()); ok {
+		identity.Peer = &cred
+	}
+	if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 && len(req.TLS.VerifiedChains[0]) > 0 {
+		cert := req.TLS.VerifiedChains[0][0]
+		identity.TLSClient = cert.Subject.CommonName
+		identity.TLSSANs = append(identity.TLSSANs, cert.DNSNames...)
+		identity.TLSSANs = append(identity.TLSSANs, cert.EmailAddresses...)
+		for _, ip := range cert.IPAddresses {
+			identity.TLSSANs = append(identity.TLSSANs, ip.String())
+		}
+		for _, uri := range cert.URIs {
+			identity.TLSSANs = append(identity.TLSSANs, uri.String())
+		}
+	}
+	return identity
+}
+
+// withIdentity puts the identity of the client into the request context
+func withIdentity(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		handler.ServeHTTP(res, req.WithContext(context.WithValue(req.Context(), identityKey{}, identityOf(req))))
+	})
+}
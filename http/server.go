@@ -2,6 +2,7 @@ package http
 
 import (
 	"context"
+	"crypto/tls"
 	"net"
 	"net/http"
 
@@ -10,12 +11,6 @@ import (
 	"github.com/docker/go-connections/sockets"
 )
 
-// TLSConfig .
-type TLSConfig struct {
-	CertFile string
-	KeyFile  string
-}
-
 // Server .
 type Server interface {
 	ServeHTTP(string) error
@@ -33,7 +28,8 @@ type httpServer struct {
 func NewServer(handler http.Handler) Server {
 	return &httpServer{
 		Server: http.Server{
-			Handler: handler,
+			Handler:     withIdentity(handler),
+			ConnContext: withPeerCred,
 		},
 	}
 }
@@ -84,16 +80,25 @@ func (server *httpServer) ServeHTTP(address string) error {
 
 func (server *httpServer) ServeHTTPS(address string, config TLSConfig) error {
 	var (
+		reloader *tlsReloader
 		listener net.Listener
 		err      error
 	)
+	if reloader, err = newTLSReloader(config); err != nil {
+		log.WithError(err).WithField(
+			"TLSConfig", config,
+		).Error("Load tls config for https server error")
+		return err
+	}
 	if listener, err = net.Listen("tcp", address); err != nil {
 		log.WithError(err).WithField(
 			"Address", address,
 		).Error("Create tcp socket listener for https server error")
 		return err
 	}
-	if err = server.ServeTLS(listener, config.CertFile, config.KeyFile); err != nil {
+	// certificates are reloaded on handshakes, so that they're renewed without restart
+	listener = tls.NewListener(listener, &tls.Config{GetConfigForClient: reloader.getConfigForClient})
+	if err = server.Serve(listener); err != nil {
 		log.WithError(err).WithField(
 			"Address", address,
 		).WithField(
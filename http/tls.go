@@ -0,0 +1,175 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ClientAuthNone doesn't ask clients for certificates
+	ClientAuthNone = "none"
+	// ClientAuthOptional verifies client certificates when given
+	ClientAuthOptional = "optional"
+	// ClientAuthRequired rejects clients without verified certificates
+	ClientAuthRequired = "required"
+)
+
+// files are checked for changes at most once in the interval
+var tlsReloadInterval = time.Second
+
+// TLSConfig .
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// ca bundle verifying client certificates
+	ClientCAFile string
+	// one of [ none | optional | required ], none when blank
+	ClientAuth string
+}
+
+// Validate .
+func (config TLSConfig) Validate() error {
+	switch config.ClientAuth {
+	case "", ClientAuthNone:
+		return nil
+	case ClientAuthOptional, ClientAuthRequired:
+		if config.ClientCAFile == "" {
+			return errors.Errorf("client ca is required by client auth %s", config.ClientAuth)
+		}
+		return nil
+	default:
+		return errors.Errorf(
+			"invalid client auth %q, support only [ %s | %s | %s ]",
+			config.ClientAuth, ClientAuthNone, ClientAuthOptional, ClientAuthRequired,
+		)
+	}
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// tlsReloader serves the tls config of handshakes, the config is reloaded when any file changes,
+// the last good config keeps serving when reloading fails
+type tlsReloader struct {
+	config  TLSConfig
+	mutex   sync.Mutex
+	checked time.Time
+	stamps  []fileStamp
+	current *tls.Config
+}
+
+func newTLSReloader(config TLSConfig) (*tlsReloader, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	reloader := &tlsReloader{config: config}
+	stamps, err := reloader.stat()
+	if err != nil {
+		return nil, err
+	}
+	if reloader.current, err = reloader.load(); err != nil {
+		return nil, err
+	}
+	reloader.stamps, reloader.checked = stamps, time.Now()
+	return reloader, nil
+}
+
+func (reloader *tlsReloader) files() []string {
+	files := []string{reloader.config.CertFile, reloader.config.KeyFile}
+	if reloader.config.ClientCAFile != "" {
+		files = append(files, reloader.config.ClientCAFile)
+	}
+	return files
+}
+
+func (reloader *tlsReloader) stat() ([]fileStamp, error) {
+	var stamps []fileStamp
+	for _, file := range reloader.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		stamps = append(stamps, fileStamp{modTime: info.ModTime(), size: info.Size()})
+	}
+	return stamps, nil
+}
+
+func (reloader *tlsReloader) load() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(reloader.config.CertFile, reloader.config.KeyFile)
+	if err != nil {
+		return nil, errors.Annotate(err, "load server certificate")
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		ClientAuth:   tls.NoClientCert,
+	}
+	switch reloader.config.ClientAuth {
+	case ClientAuthOptional:
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequired:
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if reloader.config.ClientCAFile != "" {
+		content, err := ioutil.ReadFile(reloader.config.ClientCAFile)
+		if err != nil {
+			return nil, errors.Annotate(err, "read client ca")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, errors.Errorf("no certificate found in client ca %s", reloader.config.ClientCAFile)
+		}
+		config.ClientCAs = pool
+	}
+	return config, nil
+}
+
+func (reloader *tlsReloader) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	logger := log.WithField("Receiver", "tlsReloader").WithField("Method", "getConfigForClient")
+
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+
+	if time.Since(reloader.checked) < tlsReloadInterval {
+		return reloader.current, nil
+	}
+	reloader.checked = time.Now()
+	stamps, err := reloader.stat()
+	if err != nil {
+		logger.WithError(err).Error("stat tls files error, keep serving the last config")
+		return reloader.current, nil
+	}
+	if equalStamps(stamps, reloader.stamps) {
+		return reloader.current, nil
+	}
+	config, err := reloader.load()
+	if err != nil {
+		// files may be in the middle of replacing, the change will be checked again
+		logger.WithError(err).Error("reload tls config error, keep serving the last config")
+		return reloader.current, nil
+	}
+	logger.Info("tls config is reloaded")
+	reloader.current, reloader.stamps = config, stamps
+	return config, nil
+}
+
+func equalStamps(a []fileStamp, b []fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].modTime.Equal(b[i].modTime) || a[i].size != b[i].size {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,155 @@
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "barrel-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return testCA{cert: cert, key: key}
+}
+
+// issue writes the certificate and key signed by the ca to dir, returns paths of them
+func (ca testCA) issue(t *testing.T, dir string, template *x509.Certificate) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore, template.NotAfter = time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+
+	certFile, keyFile := filepath.Join(dir, template.Subject.CommonName+".pem"), filepath.Join(dir, template.Subject.CommonName+".key")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, path string, blockType string, content []byte) {
+	assert.NoError(t, ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: content}), 0600))
+}
+
+func serverTemplate(name string) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	defer func(interval time.Duration) { tlsReloadInterval = interval }(tlsReloadInterval)
+	tlsReloadInterval = 0
+
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	caFile := filepath.Join(dir, "ca.pem")
+	writePEM(t, caFile, "CERTIFICATE", ca.cert.Raw)
+	certFile, keyFile := ca.issue(t, dir, serverTemplate("barrel"))
+	clientCertFile, clientKeyFile := ca.issue(t, dir, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "ci"},
+		DNSNames:    []string{"ci.example.com"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	reloader, err := newTLSReloader(TLSConfig{
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		ClientCAFile: caFile,
+		ClientAuth:   ClientAuthRequired,
+	})
+	assert.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := httptest.NewUnstartedServer(withIdentity(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.NoError(t, json.NewEncoder(res).Encode(IdentityOf(req)))
+	})))
+	server.Listener = tls.NewListener(listener, &tls.Config{GetConfigForClient: reloader.getConfigForClient})
+	server.Start()
+	defer server.Close()
+	url := "https://" + listener.Addr().String()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	clientCert, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+	assert.NoError(t, err)
+	request := func(certificates []tls.Certificate) (*http.Response, Identity, error) {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certificates},
+		}}
+		var identity Identity
+		resp, err := client.Get(url)
+		if err != nil {
+			return nil, identity, err
+		}
+		defer resp.Body.Close()
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&identity))
+		return resp, identity, nil
+	}
+
+	resp, identity, err := request([]tls.Certificate{clientCert})
+	assert.NoError(t, err)
+	assert.Equal(t, "ci", identity.TLSClient)
+	assert.Equal(t, []string{"ci.example.com"}, identity.TLSSANs)
+	assert.Equal(t, "barrel", resp.TLS.PeerCertificates[0].Subject.CommonName)
+
+	// clients without certificates are rejected
+	_, _, err = request(nil)
+	assert.Error(t, err)
+
+	// the renewed server certificate is served without restart
+	renewedCertFile, renewedKeyFile := ca.issue(t, dir, serverTemplate("barrel-renewed"))
+	for src, dst := range map[string]string{renewedCertFile: certFile, renewedKeyFile: keyFile} {
+		assert.NoError(t, os.Rename(src, dst))
+		future := time.Now().Add(time.Minute)
+		assert.NoError(t, os.Chtimes(dst, future, future))
+	}
+	resp, _, err = request([]tls.Certificate{clientCert})
+	assert.NoError(t, err)
+	assert.Equal(t, "barrel-renewed", resp.TLS.PeerCertificates[0].Subject.CommonName)
+}
+
+func TestValidateTLSConfig(t *testing.T) {
+	assert.NoError(t, TLSConfig{}.Validate())
+	assert.NoError(t, TLSConfig{ClientAuth: ClientAuthOptional, ClientCAFile: "ca.pem"}.Validate())
+	assert.Error(t, TLSConfig{ClientAuth: ClientAuthRequired}.Validate())
+	assert.Error(t, TLSConfig{ClientAuth: "always", ClientCAFile: "ca.pem"}.Validate())
+}
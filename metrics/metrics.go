@@ -0,0 +1,146 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	namespace = "barrel"
+
+	resultSuccess = "success"
+	resultFailure = "failure"
+)
+
+var (
+	proxyRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "proxy",
+		Name:      "requests_total",
+		Help:      "Requests served by the docker proxy, partitioned by matched handler and status code.",
+	}, []string{"handler", "code"})
+
+	proxyRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "proxy",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of requests served by the docker proxy, partitioned by matched handler.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"handler"})
+
+	fixedIPOperations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ipam",
+		Name:      "fixed_ip_operations_total",
+		Help:      "Fixed ip operations, partitioned by operation and result.",
+	}, []string{"operation", "result"})
+
+	casRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "store",
+		Name:      "cas_retries_total",
+		Help:      "Compare-and-swap updates retried because of conflicts, partitioned by operation.",
+	}, []string{"operation"})
+
+	casRetryExceeded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "store",
+		Name:      "cas_retry_exceeded_total",
+		Help:      "Compare-and-swap updates given up after max retry count exceeded, partitioned by operation.",
+	}, []string{"operation"})
+
+	storeOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "store",
+		Name:      "operation_duration_seconds",
+		Help:      "Latency of store operations, partitioned by operation and result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "result"})
+)
+
+// ObserveProxyRequest .
+func ObserveProxyRequest(handler string, code int, start time.Time) {
+	proxyRequests.WithLabelValues(handler, strconv.Itoa(code)).Inc()
+	proxyRequestDuration.WithLabelValues(handler).Observe(time.Since(start).Seconds())
+}
+
+// ObserveFixedIPOperation .
+func ObserveFixedIPOperation(operation string, err error) {
+	fixedIPOperations.WithLabelValues(operation, result(err)).Inc()
+}
+
+// ObserveCASRetry .
+func ObserveCASRetry(operation string) {
+	casRetries.WithLabelValues(operation).Inc()
+}
+
+// ObserveCASRetryExceeded .
+func ObserveCASRetryExceeded(operation string) {
+	casRetryExceeded.WithLabelValues(operation).Inc()
+}
+
+// ObserveStoreOperation .
+func ObserveStoreOperation(operation string, start time.Time, err error) {
+	storeOperationDuration.WithLabelValues(operation, result(err)).Observe(time.Since(start).Seconds())
+}
+
+// CNIOutcome counts outcomes of a cni subhandler phase
+type CNIOutcome struct {
+	Subhandler string
+	Phase      string
+	Result     string
+	Count      int64
+}
+
+// barrel-cni is short-lived, so cni outcomes are persisted by the cni store
+// and collected on scraping
+type cniOutcomesCollector struct {
+	desc *prometheus.Desc
+	list func() ([]CNIOutcome, error)
+}
+
+// RegisterCNIOutcomes registers collector of cni subhandler outcomes
+func RegisterCNIOutcomes(list func() ([]CNIOutcome, error)) error {
+	return prometheus.Register(cniOutcomesCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "cni", "subhandler_outcomes_total"),
+			"Outcomes of cni subhandlers, partitioned by subhandler, phase and result.",
+			[]string{"subhandler", "phase", "result"},
+			nil,
+		),
+		list: list,
+	})
+}
+
+// Describe .
+func (c cniOutcomesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect .
+func (c cniOutcomesCollector) Collect(ch chan<- prometheus.Metric) {
+	outcomes, err := c.list()
+	if err != nil {
+		log.WithField("Receiver", "cniOutcomesCollector").WithField("Method", "Collect").WithError(err).Error("list cni outcomes error")
+		return
+	}
+	for _, outcome := range outcomes {
+		ch <- prometheus.MustNewConstMetric(
+			c.desc,
+			prometheus.CounterValue,
+			float64(outcome.Count),
+			outcome.Subhandler, outcome.Phase, outcome.Result,
+		)
+	}
+}
+
+func result(err error) string {
+	if err != nil {
+		return resultFailure
+	}
+	return resultSuccess
+}
@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserveFixedIPOperation(t *testing.T) {
+	ObserveFixedIPOperation("alloc", nil)
+	ObserveFixedIPOperation("alloc", nil)
+	ObserveFixedIPOperation("alloc", errors.New("alloc failed"))
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(fixedIPOperations.WithLabelValues("alloc", resultSuccess)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(fixedIPOperations.WithLabelValues("alloc", resultFailure)))
+}
+
+func TestCNIOutcomesCollector(t *testing.T) {
+	collector := cniOutcomesCollector{
+		desc: prometheus.NewDesc(
+			"barrel_cni_subhandler_outcomes_total",
+			"Outcomes of cni subhandlers, partitioned by subhandler, phase and result.",
+			[]string{"subhandler", "phase", "result"},
+			nil,
+		),
+		list: func() ([]CNIOutcome, error) {
+			return []CNIOutcome{
+				{Subhandler: "fixed", Phase: "create", Result: resultSuccess, Count: 3},
+				{Subhandler: "super", Phase: "delete", Result: resultFailure, Count: 1},
+			}, nil
+		},
+	}
+	expected := `
+# HELP barrel_cni_subhandler_outcomes_total Outcomes of cni subhandlers, partitioned by subhandler, phase and result.
+# TYPE barrel_cni_subhandler_outcomes_total counter
+barrel_cni_subhandler_outcomes_total{phase="create",result="success",subhandler="fixed"} 3
+barrel_cni_subhandler_outcomes_total{phase="delete",result="failure",subhandler="super"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected)))
+}
@@ -0,0 +1,107 @@
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/juju/errors"
+	uuid "github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+
+	barrelHttp "github.com/projecteru2/barrel/http"
+)
+
+// Review is posted to webhooks as json
+type Review struct {
+	// unique id of the review, the same for all webhooks called for one request
+	UID    string
+	Caller barrelHttp.Identity
+	// name of the container, blank when not given
+	Name string `json:",omitempty"`
+	// the container create body, already patched by mutating webhooks called before
+	Body json.RawMessage
+}
+
+// Response is answered by webhooks as json
+type Response struct {
+	Allowed bool
+	// reason of the denial, returned to the docker client
+	Message string `json:",omitempty"`
+	// json patch (RFC 6902) applied to the create body, honored only for mutating webhooks
+	Patch json.RawMessage `json:",omitempty"`
+}
+
+// Rejection is the error returned when the request is not admitted
+type Rejection struct {
+	StatusCode int
+	Message    string
+}
+
+func (rejection *Rejection) Error() string {
+	return rejection.Message
+}
+
+// Controller calls mutating webhooks in order, then validating webhooks in order
+type Controller struct {
+	webhooks []*webhook
+}
+
+// Admit returns the create body patched by mutating webhooks, or a *Rejection when any webhook denies,
+// or fails under fail policy
+func (controller *Controller) Admit(req *http.Request, body []byte) ([]byte, error) {
+	logger := controller.logger("Admit")
+
+	review := Review{
+		UID:    uuid.NewV4().String(),
+		Caller: barrelHttp.IdentityOf(req),
+		Name:   req.URL.Query().Get("name"),
+	}
+	for _, hook := range controller.webhooks {
+		review.Body = body
+		response, err := hook.call(req.Context(), review)
+		if err == nil && response.Allowed && hook.Type == TypeMutating && len(response.Patch) > 0 {
+			var patched []byte
+			if patched, err = applyPatch(body, response.Patch); err == nil {
+				body = patched
+			}
+		}
+		if err != nil {
+			if hook.FailurePolicy == FailurePolicyIgnore {
+				logger.WithError(err).Warnf("admission webhook %s failed, ignored", hook.Name)
+				continue
+			}
+			logger.WithError(err).Errorf("admission webhook %s failed", hook.Name)
+			return nil, &Rejection{
+				StatusCode: http.StatusInternalServerError,
+				Message:    fmt.Sprintf("admission webhook %s failed: %v", hook.Name, err),
+			}
+		}
+		if !response.Allowed {
+			logger.Infof("container create review %s is denied by admission webhook %s, %s", review.UID, hook.Name, response.Message)
+			message := fmt.Sprintf("admission webhook %s denied the request", hook.Name)
+			if response.Message != "" {
+				message += ": " + response.Message
+			}
+			return nil, &Rejection{StatusCode: http.StatusForbidden, Message: message}
+		}
+	}
+	return body, nil
+}
+
+func (controller *Controller) logger(method string) *log.Entry {
+	return log.WithField("Receiver", "admission.Controller").WithField("Method", method)
+}
+
+func applyPatch(body []byte, content []byte) ([]byte, error) {
+	patch, err := jsonpatch.DecodePatch(content)
+	if err != nil {
+		return nil, errors.Annotate(err, "decode patch")
+	}
+	patched, err := patch.Apply(body)
+	if err != nil {
+		return nil, errors.Annotate(err, "apply patch")
+	}
+	return patched, nil
+}
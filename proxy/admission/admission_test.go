@@ -0,0 +1,141 @@
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newWebhookServer(t *testing.T, respond func(review Review) Response) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var review Review
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&review))
+		assert.NoError(t, json.NewEncoder(res).Encode(respond(review)))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newCreateRequest(body string) *http.Request {
+	return httptest.NewRequest(http.MethodPost, "/v1.41/containers/create?name=app", strings.NewReader(body))
+}
+
+func TestMutatingWebhooksRunBeforeValidating(t *testing.T) {
+	validating := newWebhookServer(t, func(review Review) Response {
+		// the validating webhook sees the patched body
+		assert.JSONEq(t, `{"Image": "busybox", "Labels": {"team": "infra"}}`, string(review.Body))
+		return Response{Allowed: true, Patch: json.RawMessage(`[{"op": "remove", "path": "/Labels"}]`)}
+	})
+	mutating := newWebhookServer(t, func(review Review) Response {
+		assert.Equal(t, "app", review.Name)
+		assert.NotEmpty(t, review.UID)
+		return Response{Allowed: true, Patch: json.RawMessage(`[{"op": "add", "path": "/Labels", "value": {"team": "infra"}}]`)}
+	})
+	controller, err := Parse([]byte(fmt.Sprintf(`
+webhooks:
+  - name: check
+    type: validating
+    url: %s
+  - name: label
+    type: mutating
+    url: %s
+`, validating.URL, mutating.URL)))
+	assert.NoError(t, err)
+
+	body, err := controller.Admit(newCreateRequest(`{"Image": "busybox"}`), []byte(`{"Image": "busybox"}`))
+	assert.NoError(t, err)
+	// patches of validating webhooks are ignored
+	assert.JSONEq(t, `{"Image": "busybox", "Labels": {"team": "infra"}}`, string(body))
+}
+
+func TestDeniedByWebhook(t *testing.T) {
+	server := newWebhookServer(t, func(review Review) Response {
+		return Response{Message: "image busybox is not signed"}
+	})
+	controller, err := Parse([]byte("webhooks:\n  - name: signature\n    type: validating\n    url: " + server.URL + "\n"))
+	assert.NoError(t, err)
+
+	_, err = controller.Admit(newCreateRequest(`{"Image": "busybox"}`), []byte(`{"Image": "busybox"}`))
+	rejection, ok := err.(*Rejection)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusForbidden, rejection.StatusCode)
+	assert.Equal(t, "admission webhook signature denied the request: image busybox is not signed", rejection.Message)
+}
+
+func TestFailurePolicy(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slow.Close()
+
+	for _, c := range []struct {
+		failurePolicy FailurePolicy
+		admitted      bool
+	}{
+		{FailurePolicyIgnore, true},
+		{FailurePolicyFail, false},
+	} {
+		controller, err := Parse([]byte(fmt.Sprintf(`
+webhooks:
+  - name: slow
+    type: mutating
+    url: %s
+    timeout: 50ms
+    failurePolicy: %s
+`, slow.URL, c.failurePolicy)))
+		assert.NoError(t, err)
+
+		body, err := controller.Admit(newCreateRequest(`{}`), []byte(`{}`))
+		if c.admitted {
+			assert.NoError(t, err)
+			assert.Equal(t, `{}`, string(body))
+		} else {
+			rejection, ok := err.(*Rejection)
+			assert.True(t, ok)
+			assert.Equal(t, http.StatusInternalServerError, rejection.StatusCode)
+		}
+	}
+}
+
+func TestWebhookOverUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "webhook.sock")
+	listener, err := net.Listen("unix", socket)
+	assert.NoError(t, err)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/admit", req.URL.Path)
+		assert.NoError(t, json.NewEncoder(res).Encode(Response{
+			Allowed: true,
+			Patch:   json.RawMessage(`[{"op": "add", "path": "/Env", "value": ["SIDECAR=1"]}]`),
+		}))
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	controller, err := Parse([]byte("webhooks:\n  - type: mutating\n    socket: " + socket + "\n    path: /admit\n"))
+	assert.NoError(t, err)
+	body, err := controller.Admit(newCreateRequest(`{}`), []byte(`{}`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"Env": ["SIDECAR=1"]}`, string(body))
+}
+
+func TestParseRejectsInvalidConfig(t *testing.T) {
+	for _, content := range []string{
+		"webhooks:\n  - type: watching\n    url: http://localhost\n",
+		"webhooks:\n  - type: mutating\n",
+		"webhooks:\n  - type: mutating\n    url: http://localhost\n    socket: /run/hook.sock\n",
+		"webhooks:\n  - type: mutating\n    url: ftp://localhost\n",
+		"webhooks:\n  - type: mutating\n    url: http://localhost\n    failurePolicy: retry\n",
+	} {
+		_, err := Parse([]byte(content))
+		assert.Error(t, err, content)
+	}
+}
@@ -0,0 +1,124 @@
+package admission
+
+import (
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/juju/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const defaultTimeout = 10 * time.Second
+
+// Type .
+type Type string
+
+const (
+	// TypeMutating webhooks may patch the create body, they're called before validating webhooks
+	TypeMutating Type = "mutating"
+	// TypeValidating webhooks may only allow or deny the create body
+	TypeValidating Type = "validating"
+)
+
+// FailurePolicy decides the request when the webhook can't be called or answers badly
+type FailurePolicy string
+
+const (
+	// FailurePolicyFail rejects the request, it's the default
+	FailurePolicyFail FailurePolicy = "fail"
+	// FailurePolicyIgnore skips the webhook
+	FailurePolicyIgnore FailurePolicy = "ignore"
+)
+
+// Config .
+type Config struct {
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+}
+
+// WebhookConfig .
+type WebhookConfig struct {
+	Name string `yaml:"name"`
+	Type Type   `yaml:"type"`
+	// http or https url of the webhook
+	URL string `yaml:"url"`
+	// unix socket of the webhook, requests are posted to Path over the socket, exclusive with URL
+	Socket string `yaml:"socket"`
+	Path   string `yaml:"path"`
+	// timeout of one call, 10s when zero
+	Timeout       time.Duration `yaml:"timeout"`
+	FailurePolicy FailurePolicy `yaml:"failurePolicy"`
+}
+
+// Load reads and validates the admission config file
+func Load(path string) (*Controller, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(content)
+}
+
+// Parse .
+func Parse(content []byte) (*Controller, error) {
+	config := Config{}
+	if err := yaml.UnmarshalStrict(content, &config); err != nil {
+		return nil, errors.Annotate(err, "parse admission config")
+	}
+	var mutating, validating []*webhook
+	for i := range config.Webhooks {
+		webhookConfig := &config.Webhooks[i]
+		if webhookConfig.Name == "" {
+			webhookConfig.Name = "#" + strconv.Itoa(i)
+		}
+		if err := webhookConfig.validate(); err != nil {
+			return nil, errors.Annotatef(err, "webhook %s", webhookConfig.Name)
+		}
+		if webhookConfig.Type == TypeMutating {
+			mutating = append(mutating, newWebhook(*webhookConfig))
+		} else {
+			validating = append(validating, newWebhook(*webhookConfig))
+		}
+	}
+	return &Controller{webhooks: append(mutating, validating...)}, nil
+}
+
+func (config *WebhookConfig) validate() error {
+	if config.Type != TypeMutating && config.Type != TypeValidating {
+		return errors.Errorf("invalid type %q, support only [ mutating | validating ]", config.Type)
+	}
+	if config.FailurePolicy == "" {
+		config.FailurePolicy = FailurePolicyFail
+	}
+	if config.FailurePolicy != FailurePolicyFail && config.FailurePolicy != FailurePolicyIgnore {
+		return errors.Errorf("invalid failure policy %q, support only [ fail | ignore ]", config.FailurePolicy)
+	}
+	if config.Timeout < 0 {
+		return errors.Errorf("invalid timeout %v", config.Timeout)
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultTimeout
+	}
+	if (config.URL == "") == (config.Socket == "") {
+		return errors.New("one of url and socket should be set")
+	}
+	if config.Socket != "" {
+		if !filepath.IsAbs(config.Socket) {
+			return errors.Errorf("socket %s should be absolute", config.Socket)
+		}
+		if config.Path == "" {
+			config.Path = "/"
+		}
+		return nil
+	}
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.Errorf("url %s should be http or https", config.URL)
+	}
+	return nil
+}
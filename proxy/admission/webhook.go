@@ -0,0 +1,69 @@
+package admission
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+
+	"github.com/juju/errors"
+)
+
+// maximum size of webhook responses read
+const maxResponseSize = 1 << 20
+
+type webhook struct {
+	WebhookConfig
+	url    string
+	client *http.Client
+}
+
+func newWebhook(config WebhookConfig) *webhook {
+	hook := &webhook{WebhookConfig: config, url: config.URL, client: &http.Client{}}
+	if config.Socket != "" {
+		hook.url = "http://unix" + config.Path
+		hook.client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", config.Socket)
+			},
+		}
+	}
+	return hook
+}
+
+// call posts the review to the webhook within the timeout
+func (hook *webhook) call(ctx context.Context, review Review) (Response, error) {
+	response := Response{}
+	content, err := json.Marshal(review)
+	if err != nil {
+		return response, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, hook.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.url, bytes.NewReader(content))
+	if err != nil {
+		return response, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := hook.client.Do(req)
+	if err != nil {
+		return response, err
+	}
+	defer resp.Body.Close()
+
+	if content, err = ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize)); err != nil {
+		return response, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return response, errors.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	if err = json.Unmarshal(content, &response); err != nil {
+		return response, errors.Annotate(err, "unmarshal webhook response")
+	}
+	return response, nil
+}
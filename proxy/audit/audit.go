@@ -0,0 +1,196 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	barrelHttp "github.com/projecteru2/barrel/http"
+	"github.com/projecteru2/barrel/proxy"
+	"github.com/projecteru2/barrel/types"
+)
+
+const redacted = "<redacted>"
+
+var (
+	regexContainerPath = regexp.MustCompile(`^(/v[0-9.]+)?/containers/([^/]+)`)
+	regexNetworkPath   = regexp.MustCompile(`^(/v[0-9.]+)?/networks/([^/]+)`)
+
+	// headers carrying credentials, e.g. registry auth of image pull and push
+	sensitiveHeaders = []string{"X-Registry-Auth", "X-Registry-Config", "Authorization", "Proxy-Authorization", "Cookie"}
+	// query parameters whose names contain any of the words are redacted,
+	// build args of image builds carry credentials often
+	sensitiveWords = []string{"auth", "password", "secret", "token", "buildargs"}
+	// path segments that aren't identifiers
+	reservedSegments = map[string]bool{"create": true, "prune": true, "json": true}
+)
+
+// Entry is one line of the audit log
+type Entry struct {
+	Time time.Time
+	// credentials of the caller connected over unix socket
+	Peer *barrelHttp.PeerCred `json:",omitempty"`
+	// common name and subject alternative names of the verified certificate of the caller connected over tls
+	TLSClient  string   `json:",omitempty"`
+	TLSSANs    []string `json:",omitempty"`
+	RemoteAddr string   `json:",omitempty"`
+	Method     string
+	Path       string
+	Query      url.Values  `json:",omitempty"`
+	Header     http.Header `json:",omitempty"`
+	// identifiers parsed from the path, replaced by full ids recorded by handlers
+	ContainerID string `json:",omitempty"`
+	NetworkID   string `json:",omitempty"`
+	// fixed ips assigned by the request, fixed ips released after containers are gone are published as events
+	FixedIPs []types.IP `json:",omitempty"`
+	Status   int
+}
+
+type entryKey struct{}
+
+func entryFromContext(ctx context.Context) *Entry {
+	entry, _ := ctx.Value(entryKey{}).(*Entry)
+	return entry
+}
+
+// RecordContainer records the full id of the container operated by the request
+func RecordContainer(ctx context.Context, id string) {
+	if entry := entryFromContext(ctx); entry != nil && id != "" {
+		entry.ContainerID = id
+	}
+}
+
+// RecordNetwork records the full id of the network operated by the request
+func RecordNetwork(ctx context.Context, id string) {
+	if entry := entryFromContext(ctx); entry != nil && id != "" {
+		entry.NetworkID = id
+	}
+}
+
+// RecordFixedIPs records fixed ips touched by the request
+func RecordFixedIPs(ctx context.Context, ips ...types.IP) {
+	if entry := entryFromContext(ctx); entry != nil {
+		entry.FixedIPs = append(entry.FixedIPs, ips...)
+	}
+}
+
+// Config .
+type Config struct {
+	// path of the json lines file
+	Path string
+	// the file is rotated when its size exceeds MaxSize bytes
+	MaxSize int64
+	// rotated files kept
+	MaxBackups int
+}
+
+// Handler .
+type Handler interface {
+	proxy.RequestHandler
+	// Close closes the audit log, it should be called after the proxy is shut down
+	Close() error
+}
+
+type auditHandler struct {
+	file *rotatingFile
+}
+
+// NewHandler records docker api calls other than GET, it should be served ahead of other handlers
+func NewHandler(config Config) (Handler, error) {
+	file, err := newRotatingFile(config.Path, config.MaxSize, config.MaxBackups)
+	if err != nil {
+		return nil, err
+	}
+	return auditHandler{file: file}, nil
+}
+
+func (handler auditHandler) Handle(ctx proxy.HandleContext, res http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		ctx.Next()
+		return
+	}
+	entry := newEntry(req)
+	ctx.Defer(func(status int) {
+		entry.Status = status
+		handler.write(entry)
+	})
+	ctx.NextWith(req.WithContext(context.WithValue(req.Context(), entryKey{}, entry)))
+}
+
+func (handler auditHandler) Close() error {
+	return handler.file.Close()
+}
+
+func (handler auditHandler) write(entry *Entry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		handler.logger("write").WithError(err).Error("marshal audit entry error")
+		return
+	}
+	if _, err = handler.file.Write(append(line, '\n')); err != nil {
+		handler.logger("write").WithError(err).Errorf("write audit entry of %s %s error", entry.Method, entry.Path)
+	}
+}
+
+func (handler auditHandler) logger(method string) *log.Entry {
+	return log.WithField("Receiver", "auditHandler").WithField("Method", method)
+}
+
+func newEntry(req *http.Request) *Entry {
+	entry := &Entry{
+		Time:       time.Now(),
+		RemoteAddr: req.RemoteAddr,
+		Method:     req.Method,
+		Path:       req.URL.Path,
+		Query:      redactQuery(req.URL.Query()),
+		Header:     redactHeader(req.Header),
+	}
+	identity := barrelHttp.IdentityOf(req)
+	entry.Peer, entry.TLSClient, entry.TLSSANs = identity.Peer, identity.TLSClient, identity.TLSSANs
+	entry.ContainerID = identifier(regexContainerPath, req.URL.Path)
+	entry.NetworkID = identifier(regexNetworkPath, req.URL.Path)
+	return entry
+}
+
+func identifier(regex *regexp.Regexp, path string) string {
+	matches := regex.FindStringSubmatch(path)
+	if len(matches) < 3 || reservedSegments[matches[2]] {
+		return ""
+	}
+	return matches[2]
+}
+
+func redactHeader(header http.Header) http.Header {
+	if len(header) == 0 {
+		return nil
+	}
+	redactedHeader := header.Clone()
+	for _, name := range sensitiveHeaders {
+		if redactedHeader.Get(name) != "" {
+			redactedHeader.Set(name, redacted)
+		}
+	}
+	return redactedHeader
+}
+
+func redactQuery(query url.Values) url.Values {
+	if len(query) == 0 {
+		return nil
+	}
+	for name := range query {
+		lower := strings.ToLower(name)
+		for _, word := range sensitiveWords {
+			if strings.Contains(lower, word) {
+				query[name] = []string{redacted}
+				break
+			}
+		}
+	}
+	return query
+}
@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/projecteru2/barrel/proxy"
+	"github.com/projecteru2/barrel/types"
+)
+
+type dockerStub struct{}
+
+func (dockerStub) Handle(ctx proxy.HandleContext, res http.ResponseWriter, req *http.Request) {
+	RecordContainer(req.Context(), "fullContainerID")
+	RecordFixedIPs(req.Context(), types.IP{PoolID: "poolID", Address: "10.10.10.10"})
+	res.WriteHeader(http.StatusCreated)
+}
+
+func readEntries(t *testing.T, path string) []Entry {
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry Entry
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestAuditMutatingCalls(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	handler, err := NewHandler(Config{Path: path})
+	assert.NoError(t, err)
+	proxyHandler := proxy.HTTPProxyHandler{Handlers: []proxy.RequestHandler{handler, dockerStub{}}}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1.41/containers/abc/start?password=secret&detachKeys=ctrl-p", nil)
+	req.Header.Set("X-Registry-Auth", "credentials")
+	req.Header.Set("User-Agent", "docker-cli")
+	proxyHandler.ServeHTTP(httptest.NewRecorder(), req)
+	// GET requests aren't audited
+	proxyHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1.41/containers/json", nil))
+
+	entries := readEntries(t, path)
+	assert.Len(t, entries, 1)
+	entry := entries[0]
+	assert.Equal(t, http.MethodPost, entry.Method)
+	assert.Equal(t, "/v1.41/containers/abc/start", entry.Path)
+	assert.Equal(t, http.StatusCreated, entry.Status)
+	assert.Equal(t, "fullContainerID", entry.ContainerID)
+	assert.Equal(t, []types.IP{{PoolID: "poolID", Address: "10.10.10.10"}}, entry.FixedIPs)
+	assert.Equal(t, redacted, entry.Query.Get("password"))
+	assert.Equal(t, "ctrl-p", entry.Query.Get("detachKeys"))
+	assert.Equal(t, redacted, entry.Header.Get("X-Registry-Auth"))
+	assert.Equal(t, "docker-cli", entry.Header.Get("User-Agent"))
+	// the request forwarded keeps the credentials
+	assert.Equal(t, "credentials", req.Header.Get("X-Registry-Auth"))
+}
+
+func TestRedactBuildArgs(t *testing.T) {
+	query := redactQuery(url.Values{"buildargs": {`{"NPM_TOKEN":"secret"}`}, "t": {"image:latest"}})
+	assert.Equal(t, redacted, query.Get("buildargs"))
+	assert.Equal(t, "image:latest", query.Get("t"))
+}
+
+func TestEntriesDroppedAfterClosed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	handler, err := NewHandler(Config{Path: path})
+	assert.NoError(t, err)
+	proxyHandler := proxy.HTTPProxyHandler{Handlers: []proxy.RequestHandler{handler, dockerStub{}}}
+
+	assert.NoError(t, handler.Close())
+	assert.NoError(t, handler.Close())
+	proxyHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1.41/containers/abc/start", nil))
+	assert.Empty(t, readEntries(t, path))
+}
+
+func TestIdentifiersFromPath(t *testing.T) {
+	entry := newEntry(httptest.NewRequest(http.MethodPost, "/v1.41/networks/net/connect", nil))
+	assert.Equal(t, "net", entry.NetworkID)
+	assert.Equal(t, "", entry.ContainerID)
+
+	entry = newEntry(httptest.NewRequest(http.MethodPost, "/containers/create?name=abc", nil))
+	assert.Equal(t, "", entry.ContainerID)
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	file, err := newRotatingFile(path, 10, 2)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := file.Write([]byte(line))
+		assert.NoError(t, err)
+	}
+	for suffix, expected := range map[string]string{"": "fourth\n", ".1": "third\n", ".2": "second\n"} {
+		content, err := os.ReadFile(path + suffix)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(content))
+	}
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
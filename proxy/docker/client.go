@@ -1,12 +1,9 @@
 package docker
 
 import (
-	"context"
-	"net"
 	"net/http"
 	"regexp"
 	"strings"
-	"time"
 
 	barrelHttp "github.com/projecteru2/barrel/http"
 	log "github.com/sirupsen/logrus"
@@ -16,14 +13,11 @@ type httpClient struct {
 	httpClient *http.Client
 }
 
-func newHTTPClient(dockerDaemonSocket string, dialTimeout time.Duration) barrelHttp.Client {
+// NewHTTPClient creates a client requesting dockerd over the transport of the upstream
+func NewHTTPClient(transport http.RoundTripper) barrelHttp.Client {
 	return httpClient{
 		httpClient: &http.Client{
-			Transport: &http.Transport{
-				DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
-					return net.DialTimeout("unix", strings.TrimPrefix(dockerDaemonSocket, "unix://"), dialTimeout)
-				},
-			},
+			Transport: transport,
 		},
 	}
 }
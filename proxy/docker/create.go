@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"regexp"
 	"strings"
@@ -12,6 +13,11 @@ import (
 	"github.com/projecteru2/barrel/cni/subhandler"
 	barrelHttp "github.com/projecteru2/barrel/http"
 	"github.com/projecteru2/barrel/proxy"
+	"github.com/projecteru2/barrel/proxy/admission"
+	"github.com/projecteru2/barrel/proxy/audit"
+	"github.com/projecteru2/barrel/proxy/policy"
+	"github.com/projecteru2/barrel/proxy/rewrite"
+	"github.com/projecteru2/barrel/store"
 	"github.com/projecteru2/barrel/types"
 	"github.com/projecteru2/barrel/utils"
 	"github.com/projecteru2/barrel/vessel"
@@ -45,14 +51,34 @@ type containerCreateHandler struct {
 	client  barrelHttp.Client
 	vess    vessel.Helper
 	cniBase *subhandler.Base
+	// nil when no profile is configured
+	profiles *Profiles
+	// nil when no rewrite rule is configured
+	rewriteRules *rewrite.Rules
+	// nil when no admission webhook is configured
+	admission *admission.Controller
+	// nil when no policy is configured, bodies edited are evaluated again
+	accessPolicy *policy.Policy
 }
 
-func newContainerCreateHandler(client barrelHttp.Client, vess vessel.Helper, cniBase *subhandler.Base) proxy.RequestHandler {
+func newContainerCreateHandler(
+	client barrelHttp.Client,
+	vess vessel.Helper,
+	cniBase *subhandler.Base,
+	profiles *Profiles,
+	rewriteRules *rewrite.Rules,
+	admissionController *admission.Controller,
+	accessPolicy *policy.Policy,
+) proxy.RequestHandler {
 	return containerCreateHandler{
 		LoggerFactory: utils.NewObjectLogger("containerCreateHandler"),
 		client:        client,
 		vess:          vess,
 		cniBase:       cniBase,
+		profiles:      profiles,
+		rewriteRules:  rewriteRules,
+		admission:     admissionController,
+		accessPolicy:  accessPolicy,
 	}
 }
 
@@ -69,7 +95,7 @@ func (handler containerCreateHandler) Handle(ctx proxy.HandleContext, res http.R
 		err            error
 		body           []byte
 		bodyObject     utils.Object
-		fixedIPAddress []types.IP
+		fixedIPRequest fixedIPRequest
 		clientResp     *http.Response
 	)
 	if body, err = ioutil.ReadAll(req.Body); err != nil {
@@ -80,32 +106,172 @@ func (handler containerCreateHandler) Handle(ctx proxy.HandleContext, res http.R
 		writeErrorResponse(res, logger, err, "unmarshal server request body")
 		return
 	}
+	// profiles, rules and webhooks edit the body in order, their edits go through fixed-ip and cni handling below
+	if handler.profiles != nil {
+		var profile string
+		if profile, err = handler.profiles.Apply(req.URL.Query().Get("name"), bodyObject); err != nil {
+			if errors.Cause(err) == ErrUnknownProfile {
+				writeServerResponse(res, logger, http.StatusBadRequest, "unknown profile "+profile)
+			} else {
+				writeErrorResponse(res, logger, err, "apply profile "+profile)
+			}
+			return
+		}
+		if profile != "" {
+			logger.Debugf("profile %s is applied to server request", profile)
+		}
+	}
+	if handler.rewriteRules != nil {
+		var rules []string
+		if rules, err = handler.rewriteRules.Rewrite(policy.CallerOf(req), bodyObject); err != nil {
+			writeErrorResponse(res, logger, err, "rewrite server request")
+			return
+		}
+		if len(rules) > 0 {
+			logger.Debugf("server request is rewritten by rules %v", rules)
+		}
+	}
+	if handler.admission != nil {
+		if bodyObject, err = handler.admit(req, bodyObject); err != nil {
+			if rejection, ok := err.(*admission.Rejection); ok {
+				writeServerResponse(res, logger, rejection.StatusCode, rejection.Message)
+			} else {
+				writeErrorResponse(res, logger, err, "admit server request")
+			}
+			return
+		}
+	}
+	// the policy handler has only evaluated the body sent by the client, evaluate the edited one again
+	if handler.accessPolicy != nil {
+		caller := policy.CallerOf(req)
+		if decision := handler.accessPolicy.Evaluate(caller, req.Method, "/containers/create", bodyObject); !decision.Allowed {
+			logger.Warnf("edited server request of %s is denied by rule %q, %s", caller, decision.Rule, decision.Reason)
+			writeServerResponse(res, logger, http.StatusForbidden, decision.Message())
+			return
+		}
+	}
 
 	if err = handler.adaptRequestForCNI(bodyObject); err != nil {
 		writeErrorResponse(res, logger, err, "failed to adapt request for cni")
 		return
 	}
 
-	if fixedIPAddress, err = handler.checkAndRequestFixedIP(bodyObject); err != nil {
+	if fixedIPRequest, err = handler.checkAndRequestFixedIP(req.URL.Query().Get("name"), bodyObject); err != nil {
 		writeErrorResponse(res, logger, err, "check and request fixed-ip")
-		if len(fixedIPAddress) > 0 {
-			for _, address := range fixedIPAddress {
-				if err := handler.vess.FixedIPAllocator().UnallocFixedIP(context.Background(), address, false); err != nil {
-					logger.Errorf("release ip error after checkAndRequestFixedIP failed, cause = %v", err)
-				}
-			}
-		}
+		handler.rollbackFixedIPRequest(fixedIPRequest)
 		return
 	}
+	audit.RecordFixedIPs(req.Context(), fixedIPRequest.addresses...)
 	if body, err = utils.Marshal(bodyObject.Any()); err != nil {
 		writeErrorResponse(res, logger, err, "marshal server request")
 		return
 	}
 	if clientResp, err = requestDockerd(handler.client, req, body); err != nil {
 		writeErrorResponse(res, logger, err, "request dockerd socket")
+		handler.rollbackFixedIPRequest(fixedIPRequest)
 		return
 	}
-	handler.writeServerResponse(res, fixedIPAddress, clientResp)
+	handler.writeServerResponse(req.Context(), res, fixedIPRequest, clientResp)
+}
+
+func (handler containerCreateHandler) admit(req *http.Request, bodyObject utils.Object) (utils.Object, error) {
+	body, err := utils.Marshal(bodyObject.Any())
+	if err != nil {
+		return nil, err
+	}
+	if body, err = handler.admission.Admit(req, body); err != nil {
+		return nil, err
+	}
+	return utils.UnmarshalObject(body)
+}
+
+// fixedIPRequest records fixed ips requested by container creating
+type fixedIPRequest struct {
+	// name of the container, fixed ips reserved for the name will be reclaimed
+	owner string
+	// value of fixed-ip-key label
+	key string
+	// all fixed ips the container will use
+	addresses []types.IP
+	// fixed ips newly allocated for the request, should be released on failure
+	allocated []types.IP
+	// fixed ips reclaimed from retention, should be reserved again on failure
+	reclaimed []types.IP
+	// fixed ips bound to the key and claimed for the request, should be released on failure
+	claimed []types.IP
+	// fixed ips of networks bound to the key by the request, should be unbound on failure
+	bindings map[string][]types.IP
+}
+
+func (r *fixedIPRequest) reuse(address types.IP) {
+	r.addresses = append(r.addresses, address)
+	r.claimed = append(r.claimed, address)
+}
+
+func (r *fixedIPRequest) reclaim(address types.IP) {
+	r.addresses = append(r.addresses, address)
+	r.reclaimed = append(r.reclaimed, address)
+}
+
+func (r *fixedIPRequest) allocate(address types.IP) {
+	r.addresses = append(r.addresses, address)
+	r.allocated = append(r.allocated, address)
+}
+
+func (r *fixedIPRequest) bind(network string, addresses []types.IP) {
+	if r.bindings == nil {
+		r.bindings = make(map[string][]types.IP)
+	}
+	r.bindings[network] = addresses
+}
+
+func (r *fixedIPRequest) merge(other fixedIPRequest) {
+	r.addresses = append(r.addresses, other.addresses...)
+	r.allocated = append(r.allocated, other.allocated...)
+	r.reclaimed = append(r.reclaimed, other.reclaimed...)
+	r.claimed = append(r.claimed, other.claimed...)
+}
+
+// pending returns fixed ips held by reservations or claims during the creation
+func (r fixedIPRequest) pending() []types.IP {
+	return append(append(append([]types.IP{}, r.allocated...), r.reclaimed...), r.claimed...)
+}
+
+func (handler containerCreateHandler) releaseFixedIPReservations(request fixedIPRequest) {
+	logger := handler.Logger("releaseFixedIPReservations")
+	for _, address := range request.pending() {
+		if err := handler.vess.ReleaseFixedIPReservation(context.Background(), address); err != nil {
+			logger.Errorf("release reservation of fixed-ip(%v) failed, cause = %v", address, err)
+		}
+	}
+}
+
+func (handler containerCreateHandler) rollbackFixedIPRequest(request fixedIPRequest) {
+	logger := handler.Logger("rollbackFixedIPRequest")
+	// reclaimed addresses are retained again below, which must not be taken as pending
+	handler.releaseFixedIPReservations(request)
+	for networkName, addresses := range request.bindings {
+		if err := handler.vess.UnbindFixedIPKey(context.Background(), networkName, request.key, addresses); err != nil {
+			logger.Errorf("unbind fixed-ip(%v) from key(%s) failed, cause = %v", addresses, request.key, err)
+		}
+	}
+	for _, address := range request.allocated {
+		if err := handler.vess.FixedIPAllocator().UnallocFixedIP(context.Background(), address, false); err != nil {
+			logger.Errorf("release reserved address failed, cause = %v", err)
+		}
+	}
+	for _, address := range request.reclaimed {
+		if handler.vess.FixedIPRetention() > 0 {
+			err := handler.vess.RetainFixedIP(context.Background(), address, request.owner)
+			if err == nil {
+				continue
+			}
+			logger.Errorf("retain reclaimed address failed, cause = %v", err)
+		}
+		if err := handler.vess.FixedIPAllocator().UnallocFixedIP(context.Background(), address, false); err != nil {
+			logger.Errorf("release reclaimed address failed, cause = %v", err)
+		}
+	}
 }
 
 func isCustomNetwork(networkMode string) bool {
@@ -117,53 +283,217 @@ func isCustomNetwork(networkMode string) bool {
 		!strings.HasPrefix(networkMode, "container:")
 }
 
-func (handler containerCreateHandler) checkAndRequestFixedIP(body utils.Object) ([]types.IP, error) {
+func (handler containerCreateHandler) checkAndRequestFixedIP(name string, body utils.Object) (fixedIPRequest, error) {
 	var (
 		fixedIP     bool
 		networkMode string
-		addresses   []types.IP
+		request     = fixedIPRequest{owner: strings.TrimPrefix(name, "/")}
 		err         error
 	)
 	if fixedIP, networkMode, err = handler.checkFixedIPLabelAndNetworkMode(body); err != nil || !fixedIP {
-		return nil, err
+		return request, err
 	}
 	if !isCustomNetwork(networkMode) {
-		return nil, nil
+		return request, nil
 	}
-	if addresses, err = handler.visitNetworkConfigAndAllocateAddress(networkMode, body); err != nil {
-		return addresses, err
+	if request.key, err = getFixedIPKeyLabel(body); err != nil {
+		return request, err
 	}
-	return addresses, nil
+	err = handler.visitNetworkConfigAndAllocateAddress(networkMode, body, &request)
+	return request, err
 }
 
 func (handler containerCreateHandler) requestFixedIP(
+	networkName string,
 	pools []types.Pool,
 	ipamConfig utils.Object,
-) (bool, types.IP, error) {
+	request *fixedIPRequest,
+) error {
 	var (
 		ipv4Address string
 		ipv6Address string
+		reused      bool
 		err         error
 	)
 	if ipv4Address, err = getStringMember(ipamConfig, "IPv4Address"); err != nil {
-		return false, types.IP{}, err
+		return err
 	}
 	if ipv6Address, err = getStringMember(ipamConfig, "IPv6Address"); err != nil {
-		return false, types.IP{}, err
+		return err
+	}
+	if ipv4Address != "" || ipv6Address != "" {
+		return nil
 	}
-	if ipv4Address == "" && ipv6Address == "" {
-		var address types.IPAddress
-		if address, err = handler.vess.FixedIPAllocator().AllocFixedIPFromPools(context.Background(), pools); err != nil {
-			return false, types.IP{}, err
+	if request.key == "" {
+		return handler.requestFamiliesFixedIP(pools, ipamConfig, request)
+	}
+	if reused, err = handler.reuseKeyedFixedIP(networkName, ipamConfig, request); err != nil || reused {
+		return err
+	}
+	return handler.requestKeyedFixedIP(networkName, pools, ipamConfig, request)
+}
+
+// requestKeyedFixedIP requests fixed ips and binds them to the key, when the key is bound by another
+// creation in the meantime, the fixed ips are released and the ones bound to the key are reused
+func (handler containerCreateHandler) requestKeyedFixedIP(
+	networkName string,
+	pools []types.Pool,
+	ipamConfig utils.Object,
+	request *fixedIPRequest,
+) error {
+	logger := handler.Logger("requestKeyedFixedIP")
+
+	keyed := fixedIPRequest{owner: request.owner}
+	err := handler.requestFamiliesFixedIP(pools, ipamConfig, &keyed)
+	if err == nil {
+		var fixedIPKey *types.FixedIPKey
+		if fixedIPKey, err = handler.vess.BindFixedIPKey(context.Background(), networkName, request.key, keyed.addresses); err == nil &&
+			!vessel.SameFixedIPs(fixedIPKey.Addresses, keyed.addresses) {
+			logger.Warnf("key(%s) is bound to fixed-ip(%v) in the meantime, release fixed-ip(%v)", request.key, fixedIPKey.Addresses, keyed.addresses)
+			handler.rollbackFixedIPRequest(keyed)
+			ipamConfig.Del("IPv4Address")
+			ipamConfig.Del("IPv6Address")
+			reused, err := handler.reuseKeyedFixedIP(networkName, ipamConfig, request)
+			if err == nil && !reused {
+				err = errors.Errorf("fixed-ips bound to key(%s) are released in the meantime", request.key)
+			}
+			return err
+		}
+	}
+	request.merge(keyed)
+	if err != nil {
+		return err
+	}
+	request.bind(networkName, keyed.addresses)
+	return nil
+}
+
+// requestFamiliesFixedIP requests one fixed ip of each family on dual-stack networks
+func (handler containerCreateHandler) requestFamiliesFixedIP(
+	pools []types.Pool,
+	ipamConfig utils.Object,
+	request *fixedIPRequest,
+) error {
+	for _, familyPools := range groupPoolsByFamily(pools) {
+		if err := handler.requestFamilyFixedIP(familyPools, ipamConfig, request); err != nil {
+			return err
 		}
-		if address.Version == 4 {
-			ipamConfig.Set("IPv4Address", utils.NewStringNode(address.Address))
+	}
+	return nil
+}
+
+func (handler containerCreateHandler) requestFamilyFixedIP(
+	pools []types.Pool,
+	ipamConfig utils.Object,
+	request *fixedIPRequest,
+) error {
+	if request.owner != "" {
+		reclaimed, ok, err := handler.vess.ReclaimFixedIP(context.Background(), request.owner, pools)
+		if err != nil {
+			return err
+		}
+		if ok {
+			setIPAMAddress(ipamConfig, types.IPAddress{IP: reclaimed, Version: ipVersion(reclaimed.Address)})
+			request.reclaim(reclaimed)
+			return handler.vess.ReserveFixedIPForCreation(context.Background(), reclaimed)
+		}
+	}
+	address, err := handler.vess.FixedIPAllocator().AllocFixedIPFromPools(context.Background(), pools)
+	if err != nil {
+		return err
+	}
+	setIPAMAddress(ipamConfig, address)
+	request.allocate(address.IP)
+	return handler.vess.ReserveFixedIPForCreation(context.Background(), address.IP)
+}
+
+// groupPoolsByFamily groups pools by ip version, ipv4 pools first
+func groupPoolsByFamily(pools []types.Pool) [][]types.Pool {
+	var ipv4Pools, ipv6Pools []types.Pool
+	for _, pool := range pools {
+		if ipVersion(strings.Split(pool.CIDR, "/")[0]) == 6 {
+			ipv6Pools = append(ipv6Pools, pool)
 		} else {
-			ipamConfig.Set("IPv6Address", utils.NewStringNode(address.Address))
+			ipv4Pools = append(ipv4Pools, pool)
+		}
+	}
+	var groups [][]types.Pool
+	for _, group := range [][]types.Pool{ipv4Pools, ipv6Pools} {
+		if len(group) > 0 {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// reuseKeyedFixedIP reuses the fixed ips bound to the key on network
+func (handler containerCreateHandler) reuseKeyedFixedIP(
+	networkName string,
+	ipamConfig utils.Object,
+	request *fixedIPRequest,
+) (bool, error) {
+	logger := handler.Logger("reuseKeyedFixedIP")
+
+	ctx := context.Background()
+	fixedIPKey, err := handler.vess.GetFixedIPKey(ctx, networkName, request.key)
+	if err != nil {
+		if store.IsNotExists(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if len(fixedIPKey.Addresses) == 0 {
+		return false, nil
+	}
+	// each fixed ip is claimed before reused, so another creation in progress won't reuse it in the meantime
+	var claimed fixedIPRequest
+	for _, address := range fixedIPKey.Addresses {
+		if err = handler.vess.ClaimFixedIPForCreation(ctx, address); err == nil {
+			claimed.reuse(address)
+			continue
 		}
-		return true, address.IP, err
+		handler.releaseFixedIPReservations(claimed)
+		if err == types.ErrFixedIPNotAllocated {
+			// the fixed ip is released, so the key will be bound to a new address
+			logger.Warnf("fixed-ip(%v) of key(%s) is not allocated", address, request.key)
+			return false, handler.vess.UnbindFixedIPKey(ctx, networkName, request.key, fixedIPKey.Addresses)
+		}
+		if err == types.ErrIPInUse {
+			err = types.ErrFixedIPKeyInUse
+		}
+		return false, err
+	}
+	for _, address := range claimed.addresses {
+		logger.Infof("reuse fixed-ip(%v) of key(%s)", address, request.key)
+		setIPAMAddress(ipamConfig, types.IPAddress{IP: address, Version: ipVersion(address.Address)})
+	}
+	request.merge(claimed)
+	return true, nil
+}
+
+func setIPAMAddress(ipamConfig utils.Object, address types.IPAddress) {
+	if address.Version == 4 {
+		ipamConfig.Set("IPv4Address", utils.NewStringNode(address.Address))
+	} else {
+		ipamConfig.Set("IPv6Address", utils.NewStringNode(address.Address))
+	}
+}
+
+func ipVersion(address string) int {
+	if ip := net.ParseIP(address); ip != nil && ip.To4() == nil {
+		return 6
 	}
-	return false, types.IP{}, nil
+	return 4
+}
+
+func getFixedIPKeyLabel(body utils.Object) (string, error) {
+	var labels utils.Object
+	if iLabels, ok := body.Get("Labels"); !ok || iLabels.Null() {
+		return "", nil
+	} else if labels, ok = iLabels.ObjectValue(); !ok {
+		return "", errors.Errorf("parse Labels error, labels=%s", iLabels.String())
+	}
+	return getStringMember(labels, FixedIPKeyLabel)
 }
 
 func (handler containerCreateHandler) checkFixedIPLabelAndNetworkMode(body utils.Object) (bool, string, error) {
@@ -204,18 +534,18 @@ func (handler containerCreateHandler) checkFixedIPLabelAndNetworkMode(body utils
 func (handler containerCreateHandler) visitNetworkConfigAndAllocateAddress(
 	networkMode string,
 	body utils.Object,
-) ([]types.IP, error) {
+	request *fixedIPRequest,
+) error {
 	var (
 		networkConfig   utils.Object
 		endpointsConfig utils.Object
 		err             error
-		addresses       []types.IP
 	)
 	if networkConfig, err = ensureObjectMember(body, "NetworkingConfig"); err != nil {
-		return nil, err
+		return err
 	}
 	if endpointsConfig, err = ensureObjectMember(networkConfig, "EndpointsConfig"); err != nil {
-		return nil, err
+		return err
 	}
 	networkNames := endpointsConfig.Keys()
 	if len(networkNames) == 0 {
@@ -226,8 +556,6 @@ func (handler containerCreateHandler) visitNetworkConfigAndAllocateAddress(
 			pools          []types.Pool
 			endpointConfig utils.Object
 			ipamConfig     utils.Object
-			address        types.IP
-			allocated      bool
 		)
 		if !isCustomNetwork(networkName) {
 			continue
@@ -236,41 +564,39 @@ func (handler containerCreateHandler) visitNetworkConfigAndAllocateAddress(
 			if err == types.ErrUnsupervisedNetwork {
 				continue
 			}
-			return addresses, err
+			return err
 		}
 		if endpointConfig, err = ensureObjectMember(endpointsConfig, networkName); err != nil {
-			return addresses, err
+			return err
 		} else if ipamConfig, err = ensureObjectMember(endpointConfig, "IPAMConfig"); err != nil {
-			return addresses, err
+			return err
 		}
-		if allocated, address, err = handler.requestFixedIP(pools, ipamConfig); err != nil {
-			return addresses, err
-		} else if allocated {
-			addresses = append(addresses, address)
+		if err = handler.requestFixedIP(networkName, pools, ipamConfig, request); err != nil {
+			return err
 		}
 	}
-	return addresses, nil
+	return nil
 }
 
 func (handler containerCreateHandler) writeServerResponse(
+	ctx context.Context,
 	res http.ResponseWriter,
-	fixedIPAddress []types.IP,
+	fixedIPRequest fixedIPRequest,
 	clientResp *http.Response,
 ) {
 	logger := handler.Logger("writeServerResponse")
 	defer clientResp.Body.Close()
 
-	var err error
+	var (
+		err            error
+		fixedIPAddress = fixedIPRequest.addresses
+	)
 	if clientResp.StatusCode != http.StatusCreated {
 		logger.Errorf("create container failed, status code = %d", clientResp.StatusCode)
 		if err = utils.Forward(clientResp, res); err != nil {
 			logger.Errorf("forward message failed, cause = %v", err)
 		}
-		for _, address := range fixedIPAddress {
-			if err := handler.vess.FixedIPAllocator().UnallocFixedIP(context.Background(), address, false); err != nil {
-				logger.Errorf("release reserved address failed, cause = %v", err)
-			}
-		}
+		handler.rollbackFixedIPRequest(fixedIPRequest)
 		return
 	}
 	var content []byte
@@ -288,13 +614,17 @@ func (handler containerCreateHandler) writeServerResponse(
 		logger.Errorf("create container resp blank container id %v, related address = %v", err, fixedIPAddress)
 		return
 	}
-	if err = handler.vess.InitContainerInfoRecord(
-		context.Background(),
-		types.Container{ID: body.ID, HostName: handler.vess.Hostname()},
-		fixedIPAddress,
-	); err != nil {
+	audit.RecordContainer(ctx, body.ID)
+	if err = handler.vess.InitContainerInfoRecord(context.Background(), types.ContainerInfo{
+		Container:  types.Container{ID: body.ID, HostName: handler.vess.Hostname()},
+		Name:       fixedIPRequest.owner,
+		Addresses:  fixedIPAddress,
+		FixedIPKey: fixedIPRequest.key,
+	}); err != nil {
 		logger.Errorf("mark fixed-ip(%s) for container(%s) failed %v", fixedIPAddress, body.ID, err)
 	}
+	// the container is created, its fixed ips are no longer swept
+	handler.releaseFixedIPReservations(fixedIPRequest)
 }
 
 // steps:
@@ -303,14 +633,16 @@ func (handler containerCreateHandler) writeServerResponse(
 // 2. force --runtime barrel-cni
 // 3. if Labels[fixed-ip]=1 then --env fixed-ip=1
 // 4. if NetworkingConfig.EndpointsConfig.IPAMConfig.IPv4Address=x then --env IPV4=x
-// 5. if HostConfig.NetworkMode=x then --env IPPOOL=x
+// 5. if NetworkingConfig.EndpointsConfig.IPAMConfig.IPv6Address=x then --env IPV6=x
+// 6. if HostConfig.NetworkMode=x then --env IPPOOL=<ipv4 pool of x> and --env IPPOOL6=<ipv6 pool of x>
 func (handler containerCreateHandler) adaptRequestForCNI(body utils.Object) (err error) {
 	var (
-		hostConfig  utils.Object
-		labels      utils.Object
-		env         utils.Array
-		networkMode string
-		specificIP  string
+		hostConfig   utils.Object
+		labels       utils.Object
+		env          utils.Array
+		networkMode  string
+		specificIP   string
+		specificIPv6 string
 	)
 	logger := handler.Logger("adaptRequestForCNI")
 
@@ -362,10 +694,16 @@ func (handler containerCreateHandler) adaptRequestForCNI(body utils.Object) (err
 		return
 	}
 
+	ipv4Pool, ipv6Pool := handler.cniIPPools(networkMode)
 	todo = append(todo,
 		func() {
-			logger.Infof("cni mode enabled, set network none, add env IPPOOL=%s, set runtime barrel-cni", networkMode)
-			env.Add(utils.NewStringNode("IPPOOL=" + networkMode))
+			logger.Infof("cni mode enabled, set network none, add env IPPOOL=%s IPPOOL6=%s, set runtime barrel-cni", ipv4Pool, ipv6Pool)
+			if ipv4Pool != "" {
+				env.Add(utils.NewStringNode("IPPOOL=" + ipv4Pool))
+			}
+			if ipv6Pool != "" {
+				env.Add(utils.NewStringNode("IPPOOL6=" + ipv6Pool))
+			}
 			hostConfig.Set("Runtime", utils.NewStringNode("barrel-cni"))
 			hostConfig.Set("NetworkMode", utils.NewStringNode("none"))
 		},
@@ -386,6 +724,9 @@ func (handler containerCreateHandler) adaptRequestForCNI(body utils.Object) (err
 		if ipv4Address, ok := ipamConfig.Get("IPv4Address"); ok && !ipv4Address.Null() {
 			specificIP, _ = ipv4Address.StringValue()
 		}
+		if ipv6Address, ok := ipamConfig.Get("IPv6Address"); ok && !ipv6Address.Null() {
+			specificIPv6, _ = ipv6Address.StringValue()
+		}
 	}
 	todo = append(todo, func() {
 		logger.Info("cni mode enabled, empty EndpointConfig")
@@ -399,11 +740,21 @@ func (handler containerCreateHandler) adaptRequestForCNI(body utils.Object) (err
 		})
 	}
 
+	if specificIPv6 != "" {
+		todo = append(todo, func() {
+			logger.Infof("cni specific-ip mode detected, set ipv6 env IPV6=%s", specificIPv6)
+			env.Add(utils.NewStringNode("IPV6=" + specificIPv6))
+		})
+	}
 	if specificIP != "" {
 		todo = append(todo, func() {
 			logger.Infof("cni specific-ip mode detected, set ipv4 env IPV4=%s", specificIP)
 			env.Add(utils.NewStringNode("IPV4=" + specificIP))
 		})
+	} else {
+		specificIP = specificIPv6
+	}
+	if specificIP != "" {
 
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
@@ -421,3 +772,27 @@ func (handler containerCreateHandler) adaptRequestForCNI(body utils.Object) (err
 	return nil
 
 }
+
+// cniIPPools returns the ipv4 and ipv6 calico pools of the network,
+// the network name is taken as the ipv4 pool when pools can't be resolved
+func (handler containerCreateHandler) cniIPPools(networkName string) (string, string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pools, err := handler.vess.DockerNetworkManager().GetPoolsByNetworkName(ctx, networkName)
+	if err != nil {
+		handler.Logger("cniIPPools").Warnf("get pools of network(%s) error, cause = %v", networkName, err)
+		return networkName, ""
+	}
+	var ipv4Pool, ipv6Pool string
+	for _, pool := range pools {
+		if ipVersion(strings.Split(pool.CIDR, "/")[0]) == 6 {
+			if ipv6Pool == "" {
+				ipv6Pool = pool.Name
+			}
+		} else if ipv4Pool == "" {
+			ipv4Pool = pool.Name
+		}
+	}
+	return ipv4Pool, ipv6Pool
+}
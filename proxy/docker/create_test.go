@@ -1,5 +1,28 @@
 package docker
 
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/projecteru2/barrel/proxy"
+	"github.com/projecteru2/barrel/proxy/policy"
+	"github.com/projecteru2/barrel/proxy/rewrite"
+	"github.com/projecteru2/barrel/store/memory"
+	"github.com/projecteru2/barrel/types"
+	"github.com/projecteru2/barrel/utils"
+	"github.com/projecteru2/barrel/vessel"
+	"github.com/projecteru2/barrel/vessel/codecs"
+	"github.com/projecteru2/barrel/vessel/mocks"
+	"github.com/projecteru2/barrel/vessel/vesseltest"
+)
+
 // func newMockHandler() ContainerCreateHandler {
 // 	return ContainerCreateHandler{}
 // }
@@ -131,3 +154,139 @@ package docker
 // 		}
 // 	}
 // }
+
+var (
+	testIPv4Pool = types.Pool{Name: "pool4", CIDR: "10.10.0.0/16"}
+	testIPv6Pool = types.Pool{Name: "pool6", CIDR: "fd00::/64"}
+	testIPv4     = types.IPAddress{IP: types.IP{PoolID: "pool4", Address: "10.10.10.10"}, Version: 4}
+	testIPv6     = types.IPAddress{IP: types.IP{PoolID: "pool6", Address: "fd00::10"}, Version: 6}
+)
+
+func newTestCreateHandler(calicoIPAllocator *mocks.CalicoIPAllocator) (containerCreateHandler, vessel.Helper) {
+	stor := memory.NewMemoryStore()
+	dockerNetworkManager := &mocks.DockerNetworkManager{}
+	dockerNetworkManager.On("GetPoolsByNetworkName", mock.Anything, "net1").Return([]types.Pool{testIPv6Pool, testIPv4Pool}, nil)
+	helper := vesseltest.NewHelper(calicoIPAllocator, dockerNetworkManager, stor)
+	return containerCreateHandler{LoggerFactory: utils.NewObjectLogger("containerCreateHandler"), vess: helper}, helper
+}
+
+func newTestCreateBody(t *testing.T) utils.Object {
+	body, err := utils.UnmarshalObject([]byte(`{"Labels": {"fixed-ip": "1"}, "HostConfig": {"NetworkMode": "net1"}}`))
+	assert.NoError(t, err)
+	return body
+}
+
+func TestGroupPoolsByFamily(t *testing.T) {
+	assert.Equal(t, [][]types.Pool{{testIPv4Pool}, {testIPv6Pool}}, groupPoolsByFamily([]types.Pool{testIPv6Pool, testIPv4Pool}))
+	assert.Equal(t, [][]types.Pool{{testIPv6Pool}}, groupPoolsByFamily([]types.Pool{testIPv6Pool}))
+	assert.Nil(t, groupPoolsByFamily(nil))
+}
+
+func TestRequestDualStackFixedIP(t *testing.T) {
+	calicoIPAllocator := &mocks.CalicoIPAllocator{}
+	calicoIPAllocator.On("AllocIPFromPools", mock.Anything, []types.Pool{testIPv4Pool}).Return(testIPv4, nil)
+	calicoIPAllocator.On("AllocIPFromPools", mock.Anything, []types.Pool{testIPv6Pool}).Return(testIPv6, nil)
+	handler, helper := newTestCreateHandler(calicoIPAllocator)
+
+	body := newTestCreateBody(t)
+	request, err := handler.checkAndRequestFixedIP("/web", body)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.IP{testIPv4.IP, testIPv6.IP}, request.addresses)
+	assert.Equal(t, request.addresses, request.allocated)
+
+	content, err := utils.Marshal(body.Any())
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"IPAMConfig":{"IPv4Address":"10.10.10.10","IPv6Address":"fd00::10"}`)
+	for _, address := range request.addresses {
+		_, err := helper.FixedIPAllocator().GetFixedIP(context.Background(), address, nil)
+		assert.NoError(t, err)
+	}
+}
+
+func TestRequestDualStackFixedIPRollback(t *testing.T) {
+	calicoIPAllocator := &mocks.CalicoIPAllocator{}
+	calicoIPAllocator.On("AllocIPFromPools", mock.Anything, []types.Pool{testIPv4Pool}).Return(testIPv4, nil)
+	calicoIPAllocator.On("AllocIPFromPools", mock.Anything, []types.Pool{testIPv6Pool}).Return(types.IPAddress{}, errors.New("ipv6 pool exhausted"))
+	calicoIPAllocator.On("UnallocIP", mock.Anything, testIPv4.IP).Return(nil)
+	handler, helper := newTestCreateHandler(calicoIPAllocator)
+
+	// the ipv4 address allocated before the failure is released on rollback
+	request, err := handler.checkAndRequestFixedIP("/web", newTestCreateBody(t))
+	assert.Error(t, err)
+	assert.Equal(t, []types.IP{testIPv4.IP}, request.allocated)
+	handler.rollbackFixedIPRequest(request)
+
+	calicoIPAllocator.AssertCalled(t, "UnallocIP", mock.Anything, testIPv4.IP)
+	_, err = helper.FixedIPAllocator().GetFixedIP(context.Background(), testIPv4.IP, nil)
+	assert.Equal(t, types.ErrFixedIPNotAllocated, err)
+	ipInfos := codecs.IPInfoMultiGetCodec{PrefixKey: codecs.IPInfoPrefix("")}
+	assert.NoError(t, helper.GetMulti(context.Background(), &ipInfos))
+	assert.Empty(t, ipInfos.Codecs)
+}
+
+func TestEditedRequestEvaluatedAgain(t *testing.T) {
+	accessPolicy, err := policy.Parse([]byte(`
+rules:
+  - name: unprivileged
+    action: allow
+    container:
+      denyPrivileged: true
+`))
+	assert.NoError(t, err)
+	rewriteRules, err := rewrite.Parse([]byte(`
+rules:
+  - name: privileged
+    actions:
+      - op: set
+        path: /HostConfig/Privileged
+        value: true
+`))
+	assert.NoError(t, err)
+
+	handler, _ := newTestCreateHandler(&mocks.CalicoIPAllocator{})
+	handler.rewriteRules = rewriteRules
+	handler.accessPolicy = accessPolicy
+
+	req := httptest.NewRequest(http.MethodPost, "/v1.41/containers/create", strings.NewReader(`{"Image": "busybox"}`))
+	res := httptest.NewRecorder()
+	proxy.HTTPProxyHandler{Handlers: []proxy.RequestHandler{handler}}.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusForbidden, res.Code)
+	assert.Contains(t, res.Body.String(), "authorization denied by barrel policy rule unprivileged: privileged container is not allowed")
+}
+
+func TestReuseKeyedFixedIPClaimed(t *testing.T) {
+	calicoIPAllocator := &mocks.CalicoIPAllocator{}
+	calicoIPAllocator.On("AllocIP", mock.Anything, mock.Anything).Return(nil)
+	handler, helper := newTestCreateHandler(calicoIPAllocator)
+
+	ctx := context.Background()
+	addresses := []types.IP{testIPv4.IP, testIPv6.IP}
+	for _, address := range addresses {
+		assert.NoError(t, helper.FixedIPAllocator().AllocFixedIP(ctx, address))
+	}
+	_, err := helper.BindFixedIPKey(ctx, "net1", "web", addresses)
+	assert.NoError(t, err)
+
+	// the creations reusing the key at once can't both take the fixed ips
+	first := fixedIPRequest{key: "web"}
+	reused, err := handler.reuseKeyedFixedIP("net1", utils.NewObjectNode(), &first)
+	assert.NoError(t, err)
+	assert.True(t, reused)
+	assert.Equal(t, addresses, first.claimed)
+
+	second := fixedIPRequest{key: "web"}
+	_, err = handler.reuseKeyedFixedIP("net1", utils.NewObjectNode(), &second)
+	assert.Equal(t, types.ErrFixedIPKeyInUse, err)
+	assert.Empty(t, second.addresses)
+
+	// the claims are released on rollback
+	handler.rollbackFixedIPRequest(first)
+	for _, address := range addresses {
+		codec, err := helper.FixedIPAllocator().GetFixedIP(ctx, address, nil)
+		assert.NoError(t, err)
+		assert.False(t, codec.IPInfo.Status.Match(types.IPStatusPending))
+	}
+	reused, err = handler.reuseKeyedFixedIP("net1", utils.NewObjectNode(), &second)
+	assert.NoError(t, err)
+	assert.True(t, reused)
+}
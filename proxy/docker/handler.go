@@ -2,36 +2,49 @@ package docker
 
 import (
 	"net/http"
-	"time"
 
 	"github.com/projecteru2/barrel/cni/subhandler"
 	"github.com/projecteru2/barrel/proxy"
+	"github.com/projecteru2/barrel/proxy/admission"
+	"github.com/projecteru2/barrel/proxy/policy"
+	"github.com/projecteru2/barrel/proxy/rewrite"
 	"github.com/projecteru2/barrel/vessel"
 )
 
-// NewHandler .
-func NewHandler(dockerDaemonSocket string, dialTimeout time.Duration, cniBase *subhandler.Base, vess vessel.Helper) http.Handler {
-	client := newHTTPClient(dockerDaemonSocket, dialTimeout)
+// NewHandler creates the docker proxy handler, handlers are served ahead of the docker handlers
+func NewHandler(
+	transport http.RoundTripper,
+	cniBase *subhandler.Base,
+	vess vessel.Helper,
+	profiles *Profiles,
+	rewriteRules *rewrite.Rules,
+	admissionController *admission.Controller,
+	accessPolicy *policy.Policy,
+	handlers []proxy.RequestHandler,
+) http.Handler {
+	client := NewHTTPClient(transport)
 
 	inspectAgent := newContainerInspectAgent(client)
 	return proxy.HTTPProxyHandler{
-		Handlers: []proxy.RequestHandler{
-			newContainerCreateHandler(client, vess, cniBase),
-			newContainerDeleteHandler(client, vess, inspectAgent, cniBase),
-			newContainerInspectHandler(client, vess),
-			newContainerPruneHandle(client, vess),
-			newNetworkConnectHandler(client, vess, inspectAgent),
-			newNetworkDisconnectHandler(client, vess, inspectAgent),
-		},
+		Handlers: append(
+			handlers,
+			proxy.WithName("create", newContainerCreateHandler(client, vess, cniBase, profiles, rewriteRules, admissionController, accessPolicy)),
+			proxy.WithName("delete", newContainerDeleteHandler(client, vess, inspectAgent, cniBase)),
+			proxy.WithName("inspect", newContainerInspectHandler(client, vess)),
+			proxy.WithName("prune", newContainerPruneHandle(client, vess)),
+			proxy.WithName("connect", newNetworkConnectHandler(client, vess, inspectAgent)),
+			proxy.WithName("disconnect", newNetworkDisconnectHandler(client, vess, inspectAgent)),
+		),
 		HTTPClient: client,
 	}
 }
 
-// NewSimpleHandler .
-func NewSimpleHandler(dockerDaemonSocket string, dialTimeout time.Duration) http.Handler {
-	client := newHTTPClient(dockerDaemonSocket, dialTimeout)
+// NewSimpleHandler creates the docker proxy handler forwarding requests to dockerd after handlers
+func NewSimpleHandler(transport http.RoundTripper, handlers []proxy.RequestHandler) http.Handler {
+	client := NewHTTPClient(transport)
 
 	return proxy.HTTPProxyHandler{
+		Handlers:   handlers,
 		HTTPClient: client,
 	}
 }
@@ -14,6 +14,8 @@ import (
 const (
 	// FixedIPLabel .
 	FixedIPLabel = "fixed-ip"
+	// FixedIPKeyLabel binds fixed ips to a stable identity instead of container id
+	FixedIPKeyLabel = "fixed-ip-key"
 )
 
 func flagEnabled(label utils.Any) bool {
@@ -48,6 +50,17 @@ func ensureObjectMember(parent utils.Object, key string) (childObject utils.Obje
 	return
 }
 
+func ensureArrayMember(parent utils.Object, key string) (childArray utils.Array, err error) {
+	if child, ok := parent.Get(key); !ok || child.Null() {
+		childArray = utils.NewArrayNode()
+		parent.Set(key, childArray.Any())
+	} else if childArray, ok = child.ArrayValue(); !ok {
+		err = errors.Errorf(`parse object.["%s"] as array error, value=%s`, key, child.String())
+		return
+	}
+	return
+}
+
 func getStringMember(parent utils.Object, key string) (result string, err error) {
 	if child, ok := parent.Get(key); !ok || child.Null() {
 		return
@@ -166,14 +166,22 @@ func (handler containerInspectHandler) injectNetworkforCNI(resp *http.Response)
 		return
 	}
 	if handler.isAliveCNIContainer(container) {
-		ipv4, err := cniutils.ProbeIPv4(fmt.Sprintf("/proc/%d/ns/net", container.State.Pid))
+		netns := fmt.Sprintf("/proc/%d/ns/net", container.State.Pid)
+		ipv4, err := cniutils.ProbeIPv4(netns)
 		if err != nil {
 			log.Errorf("failed to probe cni ip %s: %+v", container.ID, err)
 			return resp, nil
 		}
+		// ipv6 is best-effort, the ipv4 probed is injected anyway
+		ipv6, err := cniutils.ProbeIPv6(netns)
+		if err != nil {
+			log.Warnf("failed to probe cni ipv6 %s: %+v", container.ID, err)
+			ipv6 = ""
+		}
 		container.NetworkSettings.Networks = map[string]*dockernetwork.EndpointSettings{
 			handler.CNIIPPoolName(container): {
-				IPAddress: ipv4,
+				IPAddress:         ipv4,
+				GlobalIPv6Address: ipv6,
 			},
 		}
 
@@ -196,11 +204,16 @@ func (handler containerInspectHandler) isAliveCNIContainer(container *dockertype
 }
 
 func (handler containerInspectHandler) CNIIPPoolName(container *dockertypes.ContainerJSON) string {
+	ipv6Pool := ""
 	for _, e := range container.Config.Env {
 		parts := strings.SplitN(e, "=", 2)
 		if len(parts) == 2 && parts[0] == "IPPOOL" {
 			return parts[1]
 		}
+		if len(parts) == 2 && parts[0] == "IPPOOL6" {
+			ipv6Pool = parts[1]
+		}
 	}
-	return ""
+	// ipv6 only network
+	return ipv6Pool
 }
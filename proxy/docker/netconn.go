@@ -9,6 +9,7 @@ import (
 	"github.com/juju/errors"
 	barrelHttp "github.com/projecteru2/barrel/http"
 	"github.com/projecteru2/barrel/proxy"
+	"github.com/projecteru2/barrel/proxy/audit"
 	"github.com/projecteru2/barrel/types"
 	"github.com/projecteru2/barrel/utils"
 	"github.com/projecteru2/barrel/vessel"
@@ -90,12 +91,16 @@ func (handler networkConnectHandler) Handle(ctx proxy.HandleContext, res http.Re
 		writeErrorResponse(res, logger, err, "get container info")
 		return
 	}
+	audit.RecordContainer(req.Context(), containerInfo.ID)
 	// it doesn't have a fixed-ip label, just ignore
 	if isFixedIPLabelEnabled(containerInfo) {
 		if allocated, fixedIPAddress, err = handler.checkOrRequestFixedIP(pools, bodyObject); err != nil {
 			writeErrorResponse(res, logger, err, "check and request fixed-ip")
 			return
 		}
+		if allocated {
+			audit.RecordFixedIPs(req.Context(), fixedIPAddress)
+		}
 		if body, err = utils.Marshal(bodyObject.Any()); err != nil {
 			writeErrorResponse(res, logger, err, "marshal server request")
 			if allocated {
@@ -9,6 +9,7 @@ import (
 	"github.com/juju/errors"
 	barrelHttp "github.com/projecteru2/barrel/http"
 	"github.com/projecteru2/barrel/proxy"
+	"github.com/projecteru2/barrel/proxy/audit"
 	"github.com/projecteru2/barrel/types"
 	"github.com/projecteru2/barrel/utils"
 	"github.com/projecteru2/barrel/vessel"
@@ -89,6 +90,7 @@ func (handler networkDisconnectHandler) Handle(ctx proxy.HandleContext, res http
 		writeErrorResponse(res, logger, err, "get container info")
 		return
 	}
+	audit.RecordContainer(req.Context(), containerInfo.ID)
 	var resp *http.Response
 	if resp, err = requestDockerd(handler.client, req, body); err != nil {
 		writeErrorResponse(res, logger, err, "request dockerd socket")
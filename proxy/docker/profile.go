@@ -0,0 +1,257 @@
+package docker
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	units "github.com/docker/go-units"
+	"github.com/juju/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/projecteru2/barrel/resources"
+	"github.com/projecteru2/barrel/utils"
+)
+
+const (
+	// ProfileLabel names the profile applied to the container
+	ProfileLabel = "barrel.profile"
+	// placeholder of container name in sources of profile mounts
+	profileNamePlaceholder = "{name}"
+)
+
+// ErrUnknownProfile .
+var ErrUnknownProfile = errors.New("unknown profile")
+
+// Profiles .
+type Profiles struct {
+	Profiles map[string]*Profile `yaml:"profiles"`
+}
+
+// Profile is the defaults of container create requests, values given by requests win
+type Profile struct {
+	// network mode of the container when the request doesn't specify one
+	Network string `yaml:"network"`
+	// value of fixed-ip label, fixed-ip is decided by the request when nil
+	FixedIP   *bool            `yaml:"fixedIP"`
+	Resources ProfileResources `yaml:"resources"`
+	// bind mounts, sources must be under res-path-prefix, and contain {name} when volumeAutoRes is unique
+	Mounts []ProfileMount `yaml:"mounts"`
+	// value of volume-auto-res label, one of [ shared | unique | borrowed ]
+	VolumeAutoRes string `yaml:"volumeAutoRes"`
+	// environment variables in KEY=VALUE form
+	Env []string `yaml:"env"`
+}
+
+// ProfileResources .
+type ProfileResources struct {
+	// memory limit, e.g. 512m
+	Memory    string  `yaml:"memory"`
+	CPUs      float64 `yaml:"cpus"`
+	PidsLimit int64   `yaml:"pidsLimit"`
+	memory    int64
+}
+
+// ProfileMount .
+type ProfileMount struct {
+	// host path, {name} is replaced by the container name
+	Source   string `yaml:"source"`
+	Target   string `yaml:"target"`
+	ReadOnly bool   `yaml:"readOnly"`
+}
+
+// LoadProfiles reads and validates the profiles file, resources.Init must be called before
+func LoadProfiles(path string) (*Profiles, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseProfiles(content)
+}
+
+// ParseProfiles .
+func ParseProfiles(content []byte) (*Profiles, error) {
+	profiles := &Profiles{}
+	if err := yaml.UnmarshalStrict(content, profiles); err != nil {
+		return nil, errors.Annotate(err, "parse profiles")
+	}
+	for name, profile := range profiles.Profiles {
+		if profile == nil {
+			profiles.Profiles[name] = &Profile{}
+			continue
+		}
+		if err := profile.validate(); err != nil {
+			return nil, errors.Annotatef(err, "profile %s", name)
+		}
+	}
+	return profiles, nil
+}
+
+func (profile *Profile) validate() error {
+	if profile.Resources.Memory != "" {
+		memory, err := units.RAMInBytes(profile.Resources.Memory)
+		if err != nil {
+			return err
+		}
+		profile.Resources.memory = memory
+	}
+	for _, mount := range profile.Mounts {
+		if !filepath.IsAbs(mount.Source) || !filepath.IsAbs(mount.Target) {
+			return errors.Errorf("mount %s:%s should be absolute", mount.Source, mount.Target)
+		}
+		if !resources.MatchPrefix(filepath.Clean(mount.Source)) {
+			return errors.Errorf("mount source %s is not under res-path-prefix", mount.Source)
+		}
+		// a source without the name is the same path for every container of the profile, it can't be unique
+		if profile.VolumeAutoRes == ResourceUnique && !strings.Contains(mount.Source, profileNamePlaceholder) {
+			return errors.Errorf("mount source %s should contain %s when volumeAutoRes is %s", mount.Source, profileNamePlaceholder, ResourceUnique)
+		}
+	}
+	switch profile.VolumeAutoRes {
+	case "", ResourceShared, ResourceUnique, ResourceBorrowed:
+	default:
+		return errors.Errorf("invalid volumeAutoRes %q, support only [ %s | %s | %s ]", profile.VolumeAutoRes, ResourceShared, ResourceUnique, ResourceBorrowed)
+	}
+	for _, env := range profile.Env {
+		if !strings.Contains(env, "=") {
+			return errors.Errorf("env %q should be KEY=VALUE", env)
+		}
+	}
+	return nil
+}
+
+// Apply applies the profile named by the label of the create body, returns the profile name, blank when not labeled
+func (profiles *Profiles) Apply(name string, body utils.Object) (string, error) {
+	var (
+		labels      utils.Object
+		profileName string
+		err         error
+	)
+	if iLabels, ok := body.Get("Labels"); !ok || iLabels.Null() {
+		return "", nil
+	} else if labels, ok = iLabels.ObjectValue(); !ok {
+		return "", errors.Errorf("parse Labels error, labels=%s", iLabels.String())
+	}
+	if profileName, err = getStringMember(labels, ProfileLabel); err != nil || profileName == "" {
+		return "", err
+	}
+	profile, ok := profiles.Profiles[profileName]
+	if !ok {
+		return profileName, errors.Annotate(ErrUnknownProfile, profileName)
+	}
+	return profileName, profile.apply(strings.TrimPrefix(name, "/"), body, labels)
+}
+
+func (profile *Profile) apply(name string, body utils.Object, labels utils.Object) error {
+	hostConfig, err := ensureObjectMember(body, "HostConfig")
+	if err != nil {
+		return err
+	}
+	if networkMode, err := getStringMember(hostConfig, "NetworkMode"); err != nil {
+		return err
+	} else if (networkMode == "" || networkMode == "default") && profile.Network != "" {
+		hostConfig.Set("NetworkMode", utils.NewStringNode(profile.Network))
+	}
+	if profile.FixedIP != nil && !labels.Has(FixedIPLabel) {
+		labels.Set(FixedIPLabel, utils.NewStringNode(strconv.FormatBool(*profile.FixedIP)))
+	}
+	if profile.VolumeAutoRes != "" && !labels.Has(labelVolumeAutoResource) {
+		labels.Set(labelVolumeAutoResource, utils.NewStringNode(profile.VolumeAutoRes))
+	}
+	if profile.Resources.memory > 0 && !hasNonZeroMember(hostConfig, "Memory") {
+		hostConfig.Set("Memory", utils.NewIntNode(profile.Resources.memory))
+	}
+	if profile.Resources.CPUs > 0 && !hasNonZeroMember(hostConfig, "NanoCpus") && !hasNonZeroMember(hostConfig, "CpuQuota") {
+		hostConfig.Set("NanoCpus", utils.NewIntNode(int64(profile.Resources.CPUs*1e9)))
+	}
+	if profile.Resources.PidsLimit > 0 && !hasNonZeroMember(hostConfig, "PidsLimit") {
+		hostConfig.Set("PidsLimit", utils.NewIntNode(profile.Resources.PidsLimit))
+	}
+	if err = profile.applyMounts(name, hostConfig); err != nil {
+		return err
+	}
+	return profile.applyEnv(body)
+}
+
+// applyMounts adds binds whose targets aren't mounted by the request
+func (profile *Profile) applyMounts(name string, hostConfig utils.Object) error {
+	if len(profile.Mounts) == 0 {
+		return nil
+	}
+	binds, err := ensureArrayMember(hostConfig, "Binds")
+	if err != nil {
+		return err
+	}
+	targets := map[string]bool{}
+	for i := 0; i < binds.Size(); i++ {
+		if bind, ok := binds.Get(i).StringValue(); ok {
+			if parts := strings.Split(bind, ":"); len(parts) > 1 {
+				targets[filepath.Clean(parts[1])] = true
+			}
+		}
+	}
+	if node, ok := hostConfig.Get("Mounts"); ok {
+		if mounts, ok := node.ArrayValue(); ok {
+			for i := 0; i < mounts.Size(); i++ {
+				if mount, ok := mounts.Get(i).ObjectValue(); ok {
+					target, _ := getStringMember(mount, "Target")
+					targets[filepath.Clean(target)] = true
+				}
+			}
+		}
+	}
+	for _, mount := range profile.Mounts {
+		if targets[filepath.Clean(mount.Target)] {
+			continue
+		}
+		source := mount.Source
+		if strings.Contains(source, profileNamePlaceholder) {
+			if name == "" {
+				return errors.Errorf("mount source %s requires the container name", source)
+			}
+			source = strings.ReplaceAll(source, profileNamePlaceholder, name)
+		}
+		bind := source + ":" + mount.Target
+		if mount.ReadOnly {
+			bind += ":ro"
+		}
+		binds.Add(utils.NewStringNode(bind))
+	}
+	return nil
+}
+
+// applyEnv adds variables not set by the request
+func (profile *Profile) applyEnv(body utils.Object) error {
+	if len(profile.Env) == 0 {
+		return nil
+	}
+	env, err := ensureArrayMember(body, "Env")
+	if err != nil {
+		return err
+	}
+	keys := map[string]bool{}
+	for i := 0; i < env.Size(); i++ {
+		if variable, ok := env.Get(i).StringValue(); ok {
+			keys[strings.SplitN(variable, "=", 2)[0]] = true
+		}
+	}
+	for _, variable := range profile.Env {
+		if !keys[strings.SplitN(variable, "=", 2)[0]] {
+			env.Add(utils.NewStringNode(variable))
+		}
+	}
+	return nil
+}
+
+func hasNonZeroMember(parent utils.Object, key string) bool {
+	child, ok := parent.Get(key)
+	if !ok || child.Null() {
+		return false
+	}
+	if value, ok := child.IntValue(); ok {
+		return value != 0
+	}
+	value, ok := child.FloatValue()
+	return !ok || value != 0
+}
@@ -0,0 +1,117 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/projecteru2/barrel/resources"
+	"github.com/projecteru2/barrel/utils"
+)
+
+const testProfiles = `
+profiles:
+  web:
+    network: calico-net
+    fixedIP: true
+    resources:
+      memory: 512m
+      cpus: 1.5
+      pidsLimit: 1024
+    mounts:
+      - source: /data/barrel/{name}
+        target: /data
+      - source: /data/barrel/{name}-logs
+        target: /logs
+        readOnly: true
+    volumeAutoRes: unique
+    env: [LOG_LEVEL=info, TZ=UTC]
+  plain:
+`
+
+func applyProfile(t *testing.T, profiles *Profiles, name string, body string) (string, string, error) {
+	object, err := utils.UnmarshalObject([]byte(body))
+	assert.NoError(t, err)
+	profile, err := profiles.Apply(name, object)
+	content, marshalErr := utils.Marshal(object.Any())
+	assert.NoError(t, marshalErr)
+	return profile, string(content), err
+}
+
+func TestApplyProfile(t *testing.T) {
+	resources.Init([]string{"/data/barrel"})
+	profiles, err := ParseProfiles([]byte(testProfiles))
+	assert.NoError(t, err)
+
+	profile, body, err := applyProfile(t, profiles, "/app", `{
+		"Image": "busybox",
+		"Labels": {"barrel.profile": "web"},
+		"HostConfig": {"NetworkMode": "default"}
+	}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "web", profile)
+	assert.JSONEq(t, `{
+		"Image": "busybox",
+		"Labels": {"barrel.profile": "web", "fixed-ip": "true", "volume-auto-res": "unique"},
+		"Env": ["LOG_LEVEL=info", "TZ=UTC"],
+		"HostConfig": {
+			"NetworkMode": "calico-net",
+			"Memory": 536870912,
+			"NanoCpus": 1500000000,
+			"PidsLimit": 1024,
+			"Binds": ["/data/barrel/app:/data", "/data/barrel/app-logs:/logs:ro"]
+		}
+	}`, body)
+
+	// explicit values of the request win
+	_, body, err = applyProfile(t, profiles, "app", `{
+		"Labels": {"barrel.profile": "web", "fixed-ip": "0", "volume-auto-res": "shared"},
+		"Env": ["LOG_LEVEL=debug"],
+		"HostConfig": {"NetworkMode": "bridge", "Memory": 1024, "CpuQuota": 50000, "Binds": ["/tmp:/data"]}
+	}`)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"Labels": {"barrel.profile": "web", "fixed-ip": "0", "volume-auto-res": "shared"},
+		"Env": ["LOG_LEVEL=debug", "TZ=UTC"],
+		"HostConfig": {
+			"NetworkMode": "bridge",
+			"Memory": 1024,
+			"CpuQuota": 50000,
+			"PidsLimit": 1024,
+			"Binds": ["/tmp:/data", "/data/barrel/app-logs:/logs:ro"]
+		}
+	}`, body)
+}
+
+func TestApplyProfileWithoutLabel(t *testing.T) {
+	resources.Init([]string{"/data/barrel"})
+	profiles, err := ParseProfiles([]byte(testProfiles))
+	assert.NoError(t, err)
+
+	profile, body, err := applyProfile(t, profiles, "app", `{"Image": "busybox"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "", profile)
+	assert.JSONEq(t, `{"Image": "busybox"}`, body)
+
+	_, _, err = applyProfile(t, profiles, "app", `{"Labels": {"barrel.profile": "db"}}`)
+	assert.Equal(t, ErrUnknownProfile, errors.Cause(err))
+
+	// the container name is required by mounts of the profile
+	_, _, err = applyProfile(t, profiles, "", `{"Labels": {"barrel.profile": "web"}}`)
+	assert.Error(t, err)
+}
+
+func TestParseProfilesRejectsInvalidProfile(t *testing.T) {
+	resources.Init([]string{"/data/barrel"})
+	for _, content := range []string{
+		"profiles:\n  web:\n    mounts:\n      - source: /etc\n        target: /etc\n",
+		"profiles:\n  web:\n    volumeAutoRes: always\n",
+		"profiles:\n  web:\n    mounts:\n      - source: /data/barrel/shared\n        target: /shared\n    volumeAutoRes: unique\n",
+		"profiles:\n  web:\n    resources:\n      memory: lots\n",
+		"profiles:\n  web:\n    env: [DEBUG]\n",
+	} {
+		_, err := ParseProfiles([]byte(content))
+		assert.Error(t, err, content)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/projecteru2/barrel/cni/subhandler"
 	barrelHttp "github.com/projecteru2/barrel/http"
 	"github.com/projecteru2/barrel/proxy"
+	"github.com/projecteru2/barrel/proxy/audit"
 	"github.com/projecteru2/barrel/resources"
 	"github.com/projecteru2/barrel/types"
 	"github.com/projecteru2/barrel/utils"
@@ -87,6 +88,7 @@ func (handler containerDeleteHandler) Handle(ctx proxy.HandleContext, response h
 		}
 		return
 	}
+	audit.RecordContainer(request.Context(), containerInfo.ID)
 
 	var resp *http.Response
 	if resp, err = handler.client.Request(request); err != nil {
@@ -0,0 +1,136 @@
+package docker
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+const (
+	upstreamKeepAlive       = 30 * time.Second
+	upstreamIdleConnTimeout = 90 * time.Second
+	// connections kept alive for reuse, requests of barrel all go to one dockerd
+	upstreamMaxIdleConns = 32
+)
+
+// Upstream is the dockerd barrel proxies to
+type Upstream struct {
+	// unix:///var/run/docker.sock, tcp://host:2375, or https://host:2376
+	Host string
+	// client certificate presented to dockerd
+	CertFile string
+	KeyFile  string
+	// ca verifying dockerd, system roots are used when blank
+	CAFile      string
+	DialTimeout time.Duration
+}
+
+// TLS tells whether dockerd is reached over tls, which is the case for https hosts,
+// and tcp hosts with certificates given
+func (upstream Upstream) TLS() bool {
+	return strings.HasPrefix(upstream.Host, "https://") ||
+		(strings.HasPrefix(upstream.Host, "tcp://") && (upstream.CertFile != "" || upstream.CAFile != ""))
+}
+
+// NewTransport returns the transport pooling connections to dockerd, it serves requests of any url,
+// e.g. http://docker/_ping, connections are always made to the upstream
+func (upstream Upstream) NewTransport() (*http.Transport, error) {
+	network, address, err := upstream.address()
+	if err != nil {
+		return nil, err
+	}
+	var tlsConfig *tls.Config
+	if upstream.TLS() {
+		if tlsConfig, err = upstream.tlsConfig(address); err != nil {
+			return nil, err
+		}
+	}
+	dialer := &net.Dialer{Timeout: upstream.DialTimeout, KeepAlive: upstreamKeepAlive}
+	return &http.Transport{
+		// tls is done on dialing, so that urls keep http scheme, and upgraded connections can be hijacked
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, address)
+			if err != nil || tlsConfig == nil {
+				return conn, err
+			}
+			return handshake(conn, tlsConfig, upstream.DialTimeout)
+		},
+		MaxIdleConns:        upstreamMaxIdleConns,
+		MaxIdleConnsPerHost: upstreamMaxIdleConns,
+		IdleConnTimeout:     upstreamIdleConnTimeout,
+	}, nil
+}
+
+func (upstream Upstream) address() (string, string, error) {
+	if strings.HasPrefix(upstream.Host, "unix://") {
+		return "unix", strings.TrimPrefix(upstream.Host, "unix://"), nil
+	}
+	u, err := url.Parse(upstream.Host)
+	if err != nil {
+		return "", "", errors.Annotatef(err, "parse dockerd host %s", upstream.Host)
+	}
+	if (u.Scheme != "tcp" && u.Scheme != "https") || u.Host == "" {
+		return "", "", errors.Errorf("invalid dockerd host %s, support only [ unix:// | tcp:// | https:// ]", upstream.Host)
+	}
+	if u.Port() == "" {
+		if upstream.TLS() {
+			return "tcp", net.JoinHostPort(u.Hostname(), "2376"), nil
+		}
+		return "tcp", net.JoinHostPort(u.Hostname(), "2375"), nil
+	}
+	return "tcp", u.Host, nil
+}
+
+func (upstream Upstream) tlsConfig(address string) (*tls.Config, error) {
+	serverName, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{ServerName: serverName, MinVersion: tls.VersionTLS12}
+	if upstream.CertFile != "" || upstream.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(upstream.CertFile, upstream.KeyFile)
+		if err != nil {
+			return nil, errors.Annotate(err, "load dockerd client certificate")
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if upstream.CAFile != "" {
+		content, err := ioutil.ReadFile(upstream.CAFile)
+		if err != nil {
+			return nil, errors.Annotate(err, "read dockerd ca")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, errors.Errorf("no certificate found in dockerd ca %s", upstream.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+func handshake(conn net.Conn, config *tls.Config, timeout time.Duration) (net.Conn, error) {
+	tlsConn := tls.Client(conn, config)
+	if timeout > 0 {
+		if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, errors.Annotate(err, "tls handshake with dockerd")
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
@@ -0,0 +1,123 @@
+package docker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func ping(t *testing.T, upstream Upstream) {
+	transport, err := upstream.NewTransport()
+	assert.NoError(t, err)
+	client := NewHTTPClient(transport)
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest(http.MethodGet, "/_ping", nil)
+		assert.NoError(t, err)
+		resp, err := client.Request(req)
+		if !assert.NoError(t, err) {
+			return
+		}
+		content, err := ioutil.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, "OK", string(content))
+	}
+}
+
+// newDockerd serves /_ping and counts connections
+func newDockerd(t *testing.T, conns *int32) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/_ping", req.URL.Path)
+		_, _ = res.Write([]byte("OK"))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(conns, 1)
+		}
+	}
+	return server
+}
+
+func TestUpstreamOverUnixSocket(t *testing.T) {
+	var conns int32
+	server := newDockerd(t, &conns)
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	assert.NoError(t, err)
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	ping(t, Upstream{Host: "unix://" + socket, DialTimeout: time.Second})
+	assert.Equal(t, int32(1), atomic.LoadInt32(&conns))
+}
+
+func TestUpstreamOverTCP(t *testing.T) {
+	var conns int32
+	server := newDockerd(t, &conns)
+	server.Start()
+	defer server.Close()
+
+	ping(t, Upstream{Host: "tcp://" + server.Listener.Addr().String(), DialTimeout: time.Second})
+	assert.Equal(t, int32(1), atomic.LoadInt32(&conns))
+}
+
+func TestUpstreamOverTLS(t *testing.T) {
+	var conns int32
+	server := newDockerd(t, &conns)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	// the certificate of the test server is presented by the client too
+	dir := t.TempDir()
+	cert := server.TLS.Certificates[0]
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	assert.NoError(t, err)
+	writePEM(t, filepath.Join(dir, "cert.pem"), "CERTIFICATE", cert.Certificate[0])
+	writePEM(t, filepath.Join(dir, "key.pem"), "PRIVATE KEY", key)
+	writePEM(t, filepath.Join(dir, "ca.pem"), "CERTIFICATE", server.Certificate().Raw)
+
+	upstream := Upstream{
+		Host:        server.URL,
+		CertFile:    filepath.Join(dir, "cert.pem"),
+		KeyFile:     filepath.Join(dir, "key.pem"),
+		CAFile:      filepath.Join(dir, "ca.pem"),
+		DialTimeout: time.Second,
+	}
+	assert.True(t, upstream.TLS())
+	ping(t, upstream)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&conns))
+
+	// dockerd isn't trusted without the ca
+	upstream.CAFile = ""
+	transport, err := upstream.NewTransport()
+	assert.NoError(t, err)
+	req, err := http.NewRequest(http.MethodGet, "/_ping", nil)
+	assert.NoError(t, err)
+	_, err = NewHTTPClient(transport).Request(req)
+	assert.Error(t, err)
+}
+
+func TestInvalidUpstream(t *testing.T) {
+	for _, host := range []string{"/var/run/docker.sock", "http://localhost:2375", "tcp://"} {
+		_, err := Upstream{Host: host}.NewTransport()
+		assert.Error(t, err, host)
+	}
+	_, err := Upstream{Host: "https://localhost:2376", CAFile: filepath.Join(t.TempDir(), "absent.pem")}.NewTransport()
+	assert.Error(t, err)
+}
+
+func writePEM(t *testing.T, path string, blockType string, content []byte) {
+	assert.NoError(t, ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: content}), 0600))
+}
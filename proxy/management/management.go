@@ -0,0 +1,229 @@
+package management
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+
+	"github.com/projecteru2/barrel/proxy"
+	"github.com/projecteru2/barrel/proxy/docker"
+	"github.com/projecteru2/barrel/proxy/policy"
+	"github.com/projecteru2/barrel/proxy/rewrite"
+	"github.com/projecteru2/barrel/store"
+	"github.com/projecteru2/barrel/types"
+	"github.com/projecteru2/barrel/utils"
+	"github.com/projecteru2/barrel/vessel"
+)
+
+// PathPrefix is the namespace of barrel management api
+const PathPrefix = "/barrel/v1/"
+
+var (
+	regexFixedIPs           = regexp.MustCompile(`^/barrel/v1/pools/([^/]+)/fixed-ips/?$`)
+	regexFixedIP            = regexp.MustCompile(`^/barrel/v1/pools/([^/]+)/fixed-ips/([^/]+)/?$`)
+	regexFixedIPReservation = regexp.MustCompile(`^/barrel/v1/pools/([^/]+)/fixed-ips/([^/]+)/reservations/?$`)
+	regexContainers         = regexp.MustCompile(`^/barrel/v1/containers/?$`)
+	regexRewriteDryRun      = regexp.MustCompile(`^/barrel/v1/rewrite/dry-run/?$`)
+)
+
+// ReserveRequest .
+type ReserveRequest struct {
+	ContainerID string
+}
+
+// RewriteDryRunResponse .
+type RewriteDryRunResponse struct {
+	// name of the profile applied before rules, blank when not labeled
+	Profile string `json:",omitempty"`
+	// names of rules applied in order
+	Rules []string
+	// the rewritten container create body
+	Body json.RawMessage
+}
+
+type managementHandler struct {
+	utils.LoggerFactory
+	vess vessel.Helper
+	// nil when no profile is configured
+	profiles *docker.Profiles
+	// nil when no rewrite rule is configured
+	rewriteRules *rewrite.Rules
+}
+
+// NewHandler serves barrel management api under /barrel/v1/, requests of other paths are passed to next handler
+// GET    /barrel/v1/pools/{pool}/fixed-ips                             list fixed ips of the pool
+// GET    /barrel/v1/pools/{pool}/fixed-ips/{address}                   inspect the fixed ip
+// DELETE /barrel/v1/pools/{pool}/fixed-ips/{address}[?force=true]      release the fixed ip, force to ignore borrowers
+// POST   /barrel/v1/pools/{pool}/fixed-ips/{address}/reservations      reserve the fixed ip for a container
+// GET    /barrel/v1/containers                                         list container records of current host
+// POST   /barrel/v1/rewrite/dry-run[?name={name}]                      show the container create body rewritten by profiles and rules
+func NewHandler(vess vessel.Helper, profiles *docker.Profiles, rewriteRules *rewrite.Rules) proxy.RequestHandler {
+	return managementHandler{
+		LoggerFactory: utils.NewObjectLogger("managementHandler"),
+		vess:          vess,
+		profiles:      profiles,
+		rewriteRules:  rewriteRules,
+	}
+}
+
+// Handle .
+func (handler managementHandler) Handle(ctx proxy.HandleContext, res http.ResponseWriter, req *http.Request) {
+	if !strings.HasPrefix(req.URL.Path, PathPrefix) {
+		ctx.Next()
+		return
+	}
+	handler.Logger("Handle").Infof("management request, method = %s, path = %s", req.Method, req.URL.Path)
+
+	path := req.URL.Path
+	switch {
+	case regexFixedIPs.MatchString(path) && req.Method == http.MethodGet:
+		handler.listFixedIPs(res, req, regexFixedIPs.FindStringSubmatch(path)[1])
+	case regexFixedIP.MatchString(path) && req.Method == http.MethodGet:
+		matches := regexFixedIP.FindStringSubmatch(path)
+		handler.inspectFixedIP(res, req, types.IP{PoolID: matches[1], Address: matches[2]})
+	case regexFixedIP.MatchString(path) && req.Method == http.MethodDelete:
+		matches := regexFixedIP.FindStringSubmatch(path)
+		handler.releaseFixedIP(res, req, types.IP{PoolID: matches[1], Address: matches[2]})
+	case regexFixedIPReservation.MatchString(path) && req.Method == http.MethodPost:
+		matches := regexFixedIPReservation.FindStringSubmatch(path)
+		handler.reserveFixedIP(res, req, types.IP{PoolID: matches[1], Address: matches[2]})
+	case regexContainers.MatchString(path) && req.Method == http.MethodGet:
+		handler.listContainers(res, req)
+	case regexRewriteDryRun.MatchString(path) && req.Method == http.MethodPost:
+		handler.rewriteDryRun(res, req)
+	default:
+		handler.writeMessage(res, http.StatusNotFound, "page not found")
+	}
+}
+
+func (handler managementHandler) listFixedIPs(res http.ResponseWriter, req *http.Request, poolID string) {
+	codecs, err := handler.vess.ListFixedIPs(req.Context(), poolID)
+	if err != nil {
+		handler.writeError(res, err, "list fixed ips")
+		return
+	}
+	ipInfos := make([]*types.IPInfo, 0, len(codecs))
+	for _, codec := range codecs {
+		ipInfos = append(ipInfos, codec.IPInfo)
+	}
+	handler.writeJSON(res, http.StatusOK, ipInfos)
+}
+
+func (handler managementHandler) inspectFixedIP(res http.ResponseWriter, req *http.Request, ip types.IP) {
+	codec, err := handler.vess.FixedIPAllocator().GetFixedIP(req.Context(), ip, nil)
+	if err != nil {
+		handler.writeError(res, err, "inspect fixed ip")
+		return
+	}
+	handler.writeJSON(res, http.StatusOK, codec.IPInfo)
+}
+
+func (handler managementHandler) releaseFixedIP(res http.ResponseWriter, req *http.Request, ip types.IP) {
+	force, _ := strconv.ParseBool(req.URL.Query().Get("force"))
+	if err := handler.vess.FixedIPAllocator().UnallocFixedIP(req.Context(), ip, force); err != nil {
+		handler.writeError(res, err, "release fixed ip")
+		return
+	}
+	handler.writeMessage(res, http.StatusOK, "released")
+}
+
+func (handler managementHandler) reserveFixedIP(res http.ResponseWriter, req *http.Request, ip types.IP) {
+	var body ReserveRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		handler.writeMessage(res, http.StatusBadRequest, "decode request body error, cause: "+err.Error())
+		return
+	}
+	if body.ContainerID == "" {
+		handler.writeMessage(res, http.StatusBadRequest, "ContainerID is required")
+		return
+	}
+	if err := handler.vess.ReserveAddressForContainer(req.Context(), body.ContainerID, ip); err != nil {
+		handler.writeError(res, err, "reserve fixed ip")
+		return
+	}
+	handler.writeMessage(res, http.StatusOK, "reserved")
+}
+
+func (handler managementHandler) listContainers(res http.ResponseWriter, _ *http.Request) {
+	infos, err := handler.vess.ContainerVessel().ListContainers()
+	if err != nil {
+		handler.writeError(res, err, "list containers")
+		return
+	}
+	handler.writeJSON(res, http.StatusOK, infos)
+}
+
+func (handler managementHandler) rewriteDryRun(res http.ResponseWriter, req *http.Request) {
+	content, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		handler.writeMessage(res, http.StatusBadRequest, "read request body error, cause: "+err.Error())
+		return
+	}
+	body, err := utils.UnmarshalObject(content)
+	if err != nil {
+		handler.writeMessage(res, http.StatusBadRequest, "unmarshal request body error, cause: "+err.Error())
+		return
+	}
+	response := RewriteDryRunResponse{Rules: []string{}}
+	// profiles are applied before rules, as container create does
+	if handler.profiles != nil {
+		if response.Profile, err = handler.profiles.Apply(req.URL.Query().Get("name"), body); err != nil {
+			if errors.Cause(err) == docker.ErrUnknownProfile {
+				handler.writeMessage(res, http.StatusBadRequest, "unknown profile "+response.Profile)
+			} else {
+				handler.writeMessage(res, http.StatusBadRequest, "apply profile error, cause: "+err.Error())
+			}
+			return
+		}
+	}
+	if handler.rewriteRules != nil {
+		rules, err := handler.rewriteRules.Rewrite(policy.CallerOf(req), body)
+		if err != nil {
+			handler.writeMessage(res, http.StatusBadRequest, "rewrite request body error, cause: "+err.Error())
+			return
+		}
+		response.Rules = append(response.Rules, rules...)
+	}
+	if response.Body, err = utils.Marshal(body.Any()); err != nil {
+		handler.writeError(res, err, "marshal rewritten body")
+		return
+	}
+	handler.writeJSON(res, http.StatusOK, response)
+}
+
+func (handler managementHandler) writeError(res http.ResponseWriter, err error, label string) {
+	handler.Logger("writeError").Errorf("%s failed %v", label, err)
+	handler.writeMessage(res, statusCode(errors.Cause(err)), label+" error, cause: "+err.Error())
+}
+
+func (handler managementHandler) writeMessage(res http.ResponseWriter, code int, message string) {
+	handler.writeJSON(res, code, utils.HTTPSimpleMessageResponseBody{Message: message})
+}
+
+func (handler managementHandler) writeJSON(res http.ResponseWriter, code int, body interface{}) {
+	if err := utils.WriteHTTPJSONResponse(res, code, nil, body); err != nil {
+		handler.Logger("writeJSON").Errorf("write response failed %v", err)
+	}
+}
+
+func statusCode(err error) int {
+	switch {
+	case err == types.ErrFixedIPNotAllocated || store.IsNotExists(err):
+		return http.StatusNotFound
+	case err == types.ErrIPInUse ||
+		err == types.ErrFixedIPHasBorrower ||
+		err == types.ErrFixedIPReserved ||
+		err == types.ErrMaxRetryCountExceeded:
+		return http.StatusConflict
+	case err == context.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,127 @@
+package management
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	barrelEtcd "github.com/projecteru2/barrel/etcd"
+	"github.com/projecteru2/barrel/proxy/docker"
+	"github.com/projecteru2/barrel/proxy/rewrite"
+	etcdStore "github.com/projecteru2/barrel/store/etcd"
+	"github.com/projecteru2/barrel/types"
+	"github.com/projecteru2/barrel/vessel"
+	"github.com/projecteru2/barrel/vessel/mocks"
+	"github.com/projecteru2/barrel/vessel/vesseltest"
+)
+
+type handleContext struct {
+	next bool
+}
+
+func (ctx *handleContext) Next() {
+	ctx.next = true
+}
+
+func (ctx *handleContext) NextWith(*http.Request) {
+	ctx.next = true
+}
+
+func (ctx *handleContext) Defer(func(int)) {}
+
+func TestManagementFixedIPs(t *testing.T) {
+	stor := etcdStore.NewEtcdStore(barrelEtcd.NewEmbedEtcd(t).Client())
+
+	calicoIPAllocator := mocks.CalicoIPAllocator{}
+	calicoIPAllocator.On("AllocIP", mock.Anything, mock.Anything).Return(nil)
+	calicoIPAllocator.On("UnallocIP", mock.Anything, mock.Anything).Return(nil)
+
+	vess := vesseltest.NewHelper(&calicoIPAllocator, nil, stor)
+	handler := NewHandler(vess, nil, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(6)*time.Second)
+	defer cancel()
+
+	ip := types.IP{PoolID: "poolID", Address: "10.10.10.10"}
+	container := types.Container{ID: "containerID", HostName: "localhost"}
+	assert.NoError(t, vess.FixedIPAllocator().AllocFixedIP(ctx, ip))
+	assert.NoError(t, vess.InitContainerInfoRecord(ctx, types.ContainerInfo{Container: container, Addresses: []types.IP{ip}}))
+
+	do := func(method string, url string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		handleCtx := &handleContext{}
+		handler.Handle(handleCtx, res, httptest.NewRequest(method, url, nil))
+		assert.False(t, handleCtx.next)
+		return res
+	}
+
+	res := do(http.MethodGet, "/barrel/v1/pools/poolID/fixed-ips")
+	assert.Equal(t, http.StatusOK, res.Code)
+	var ipInfos []types.IPInfo
+	assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &ipInfos))
+	assert.Equal(t, 1, len(ipInfos))
+
+	res = do(http.MethodGet, "/barrel/v1/pools/poolID/fixed-ips/10.10.10.10")
+	assert.Equal(t, http.StatusOK, res.Code)
+	var ipInfo types.IPInfo
+	assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &ipInfo))
+	assert.Equal(t, []types.Container{container}, ipInfo.Attrs.Borrowers)
+
+	res = do(http.MethodGet, "/barrel/v1/containers")
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	assert.Equal(t, http.StatusConflict, do(http.MethodDelete, "/barrel/v1/pools/poolID/fixed-ips/10.10.10.10").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/barrel/v1/pools/poolID/fixed-ips/10.10.10.10?force=true").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/barrel/v1/pools/poolID/fixed-ips/10.10.10.10").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/barrel/v1/unknown").Code)
+
+	handleCtx := &handleContext{}
+	handler.Handle(handleCtx, httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1.40/containers/json", nil))
+	assert.True(t, handleCtx.next)
+}
+
+func TestRewriteDryRunAppliesProfile(t *testing.T) {
+	profiles, err := docker.ParseProfiles([]byte("profiles:\n  web:\n    network: calico-net\n"))
+	assert.NoError(t, err)
+	// the rule matches the network set by the profile
+	rules, err := rewrite.Parse([]byte(`
+rules:
+  - name: calico-only
+    match:
+      networks: [calico-net]
+    actions:
+      - op: set
+        path: /Labels/network
+        value: calico
+`))
+	assert.NoError(t, err)
+	handler := NewHandler(vessel.Helper{}, profiles, rules)
+
+	dryRun := func(body string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		handler.Handle(&handleContext{}, res, httptest.NewRequest(http.MethodPost, "/barrel/v1/rewrite/dry-run?name=app", strings.NewReader(body)))
+		return res
+	}
+
+	res := dryRun(`{"Image": "busybox", "Labels": {"barrel.profile": "web"}}`)
+	assert.Equal(t, http.StatusOK, res.Code)
+	var response RewriteDryRunResponse
+	assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &response))
+	assert.Equal(t, "web", response.Profile)
+	assert.Equal(t, []string{"calico-only"}, response.Rules)
+	assert.JSONEq(t, `{
+		"Image": "busybox",
+		"Labels": {"barrel.profile": "web", "network": "calico"},
+		"HostConfig": {"NetworkMode": "calico-net"}
+	}`, string(response.Body))
+
+	res = dryRun(`{"Image": "busybox", "Labels": {"barrel.profile": "db"}}`)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+}
@@ -0,0 +1,109 @@
+package policy
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+
+	log "github.com/sirupsen/logrus"
+
+	barrelHttp "github.com/projecteru2/barrel/http"
+	"github.com/projecteru2/barrel/proxy"
+	"github.com/projecteru2/barrel/utils"
+)
+
+var (
+	regexVersionPrefix   = regexp.MustCompile(`^/v[0-9.]+`)
+	regexCreateContainer = regexp.MustCompile(`^/containers/create$`)
+	regexExecContainer   = regexp.MustCompile(`^/containers/[^/]+/exec$`)
+	regexUpdateContainer = regexp.MustCompile(`^/containers/[^/]+/update$`)
+)
+
+type policyHandler struct {
+	policy *Policy
+}
+
+// NewHandler denies requests against the policy with docker style error
+func NewHandler(policy *Policy) proxy.RequestHandler {
+	return policyHandler{policy: policy}
+}
+
+func (handler policyHandler) Handle(ctx proxy.HandleContext, res http.ResponseWriter, req *http.Request) {
+	logger := handler.logger("Handle")
+
+	var (
+		caller = CallerOf(req)
+		path   = regexVersionPrefix.ReplaceAllString(req.URL.Path, "")
+		body   utils.Object
+	)
+	if ConstrainsBody(req.Method, path) && handler.policy.RequiresBody(caller) {
+		content, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			writeDenied(res, http.StatusBadRequest, "read request body error, cause: "+err.Error())
+			return
+		}
+		if body, err = utils.UnmarshalObject(content); err != nil {
+			writeDenied(res, http.StatusBadRequest, "unmarshal request body error, cause: "+err.Error())
+			return
+		}
+		// the body is read, give the next handlers a fresh one
+		req = req.Clone(req.Context())
+		req.Body = ioutil.NopCloser(bytes.NewReader(content))
+	}
+
+	decision := handler.policy.Evaluate(caller, req.Method, path, body)
+	if !decision.Allowed {
+		logger.WithField("Caller", caller.String()).Warnf("%s %s is denied by rule %q, %s", req.Method, req.URL.Path, decision.Rule, decision.Reason)
+		writeDenied(res, http.StatusForbidden, decision.Message())
+		return
+	}
+	ctx.NextWith(req)
+}
+
+// Message is the docker style error message of denied decisions
+func (decision Decision) Message() string {
+	message := "authorization denied by barrel policy"
+	if decision.Rule != "" {
+		message += fmt.Sprintf(" rule %s", decision.Rule)
+	}
+	return message + ": " + decision.Reason
+}
+
+func (handler policyHandler) logger(method string) *log.Entry {
+	return log.WithField("Receiver", "policyHandler").WithField("Method", method)
+}
+
+// CallerOf returns the identity of the client of the request
+func CallerOf(req *http.Request) Caller {
+	identity := barrelHttp.IdentityOf(req)
+	caller := Caller{TLSClient: identity.TLSClient, TLSSANs: identity.TLSSANs}
+	if identity.Peer != nil {
+		caller.UID = &identity.Peer.UID
+		caller.GID = &identity.Peer.GID
+	}
+	return caller
+}
+
+func (caller Caller) String() string {
+	switch {
+	case caller.UID != nil:
+		return fmt.Sprintf("uid=%d,gid=%d", *caller.UID, *caller.GID)
+	case caller.TLSClient != "":
+		return "tls=" + caller.TLSClient
+	default:
+		return "anonymous"
+	}
+}
+
+func writeDenied(res http.ResponseWriter, statusCode int, message string) {
+	if err := utils.WriteHTTPJSONResponse(
+		res,
+		statusCode,
+		nil,
+		utils.HTTPSimpleMessageResponseBody{Message: message},
+	); err != nil {
+		log.WithError(err).Error("write policy denied response error")
+	}
+}
@@ -0,0 +1,404 @@
+package policy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	units "github.com/docker/go-units"
+	"github.com/juju/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/projecteru2/barrel/utils"
+)
+
+// Action .
+type Action string
+
+const (
+	// ActionAllow .
+	ActionAllow Action = "allow"
+	// ActionDeny .
+	ActionDeny Action = "deny"
+
+	// cpu period of dockerd when CpuQuota is given without CpuPeriod
+	defaultCPUPeriod = 100000
+)
+
+// Policy is evaluated rule by rule, the first rule matching the request decides,
+// the default action applies when no rule matches
+type Policy struct {
+	Default Action `yaml:"default"`
+	Rules   []Rule `yaml:"rules"`
+}
+
+// Rule .
+type Rule struct {
+	Name string `yaml:"name"`
+	// callers the rule applies to, any caller when empty
+	Callers Callers `yaml:"callers"`
+	// endpoints the rule applies to, any endpoint when empty
+	Endpoints []Endpoint `yaml:"endpoints"`
+	Action    Action     `yaml:"action"`
+	// constraints on bodies of container create, exec and update allowed by the rule
+	Container *ContainerConstraints `yaml:"container"`
+}
+
+// Callers matches the caller by any of unix peer uid, gid or tls client common name or subject alternative names
+type Callers struct {
+	UIDs       []uint32 `yaml:"uids"`
+	GIDs       []uint32 `yaml:"gids"`
+	TLSClients []string `yaml:"tlsClients"`
+}
+
+// Endpoint .
+type Endpoint struct {
+	// any method when empty
+	Method string `yaml:"method"`
+	// regexp matching the path with the api version prefix trimmed, e.g. ^/containers/create$
+	Path  string `yaml:"path"`
+	regex *regexp.Regexp
+}
+
+// ContainerConstraints are checked against container create bodies,
+// privileged is checked against exec bodies too, and resource limits against update bodies
+type ContainerConstraints struct {
+	DenyPrivileged  bool `yaml:"denyPrivileged"`
+	DenyHostNetwork bool `yaml:"denyHostNetwork"`
+	DenyHostPID     bool `yaml:"denyHostPID"`
+	// sources of bind mounts must be under one of the prefixes, any source when empty
+	AllowedBindPrefixes []string `yaml:"allowedBindPrefixes"`
+	// images must be one of the list, an item ending with * matches images of the prefix, any image when empty
+	AllowedImages []string `yaml:"allowedImages"`
+	// memory limit must be set and not above it, e.g. 4g, no constraint when empty
+	MaxMemory string `yaml:"maxMemory"`
+	// cpu limit must be set and not above it, no constraint when zero
+	MaxCPUs   float64 `yaml:"maxCPUs"`
+	maxMemory int64
+}
+
+// Caller is the identity of the client
+type Caller struct {
+	UID       *uint32
+	GID       *uint32
+	TLSClient string
+	TLSSANs   []string
+}
+
+// Decision .
+type Decision struct {
+	Allowed bool
+	// name of the rule deciding, blank when decided by default
+	Rule   string
+	Reason string
+}
+
+// Load reads and validates the policy file
+func Load(path string) (*Policy, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(content)
+}
+
+// Parse .
+func Parse(content []byte) (*Policy, error) {
+	policy := &Policy{}
+	if err := yaml.UnmarshalStrict(content, policy); err != nil {
+		return nil, errors.Annotate(err, "parse policy")
+	}
+	if policy.Default == "" {
+		policy.Default = ActionAllow
+	}
+	if err := validateAction(policy.Default); err != nil {
+		return nil, err
+	}
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		if rule.Name == "" {
+			rule.Name = "#" + strconv.Itoa(i)
+		}
+		if err := validateAction(rule.Action); err != nil {
+			return nil, errors.Annotatef(err, "rule %s", rule.Name)
+		}
+		for j := range rule.Endpoints {
+			endpoint := &rule.Endpoints[j]
+			regex, err := regexp.Compile(endpoint.Path)
+			if err != nil {
+				return nil, errors.Annotatef(err, "rule %s", rule.Name)
+			}
+			endpoint.regex = regex
+			endpoint.Method = strings.ToUpper(endpoint.Method)
+		}
+		if rule.Container != nil {
+			for j, prefix := range rule.Container.AllowedBindPrefixes {
+				if !filepath.IsAbs(prefix) {
+					return nil, errors.Errorf("rule %s: bind prefix %s should be absolute", rule.Name, prefix)
+				}
+				rule.Container.AllowedBindPrefixes[j] = filepath.Clean(prefix)
+			}
+			if rule.Container.MaxMemory != "" {
+				memory, err := units.RAMInBytes(rule.Container.MaxMemory)
+				if err != nil {
+					return nil, errors.Annotatef(err, "rule %s", rule.Name)
+				}
+				rule.Container.maxMemory = memory
+			}
+		}
+	}
+	return policy, nil
+}
+
+func validateAction(action Action) error {
+	if action != ActionAllow && action != ActionDeny {
+		return errors.Errorf("invalid action %q, support only [ allow | deny ]", action)
+	}
+	return nil
+}
+
+// Evaluate decides the request, body is the body of container create, exec or update requests, nil for others
+func (policy *Policy) Evaluate(caller Caller, method string, path string, body utils.Object) Decision {
+	for _, rule := range policy.Rules {
+		if !rule.Callers.Match(caller) || !rule.matchEndpoint(method, path) {
+			continue
+		}
+		if rule.Action == ActionDeny {
+			return Decision{Rule: rule.Name, Reason: "denied by rule"}
+		}
+		if rule.Container != nil && body != nil {
+			if reason := rule.Container.check(method, path, body); reason != "" {
+				return Decision{Rule: rule.Name, Reason: reason}
+			}
+		}
+		return Decision{Allowed: true, Rule: rule.Name}
+	}
+	if policy.Default == ActionDeny {
+		return Decision{Reason: "denied by default"}
+	}
+	return Decision{Allowed: true}
+}
+
+// RequiresBody tells whether bodies of container create, exec and update are needed to evaluate requests of the caller
+func (policy *Policy) RequiresBody(caller Caller) bool {
+	for _, rule := range policy.Rules {
+		if rule.Container != nil && rule.Callers.Match(caller) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match tells whether the caller is one of callers
+func (callers Callers) Match(caller Caller) bool {
+	if len(callers.UIDs) == 0 && len(callers.GIDs) == 0 && len(callers.TLSClients) == 0 {
+		return true
+	}
+	if caller.UID != nil {
+		for _, uid := range callers.UIDs {
+			if uid == *caller.UID {
+				return true
+			}
+		}
+	}
+	if caller.GID != nil {
+		for _, gid := range callers.GIDs {
+			if gid == *caller.GID {
+				return true
+			}
+		}
+	}
+	for _, client := range callers.TLSClients {
+		if caller.TLSClient != "" && client == caller.TLSClient {
+			return true
+		}
+		for _, san := range caller.TLSSANs {
+			if client == san {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (rule Rule) matchEndpoint(method string, path string) bool {
+	if len(rule.Endpoints) == 0 {
+		return true
+	}
+	for _, endpoint := range rule.Endpoints {
+		if (endpoint.Method == "" || endpoint.Method == method) && endpoint.regex.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// ConstrainsBody tells whether the body of the request is checked by container constraints
+func ConstrainsBody(method string, path string) bool {
+	return method == http.MethodPost &&
+		(regexCreateContainer.MatchString(path) || regexExecContainer.MatchString(path) || regexUpdateContainer.MatchString(path))
+}
+
+func (constraints ContainerConstraints) check(method string, path string, body utils.Object) string {
+	if method != http.MethodPost {
+		return ""
+	}
+	switch {
+	case regexCreateContainer.MatchString(path):
+		return constraints.checkCreate(body)
+	case regexExecContainer.MatchString(path):
+		if constraints.DenyPrivileged && getBool(body, "Privileged") {
+			return "privileged exec is not allowed"
+		}
+	case regexUpdateContainer.MatchString(path):
+		// limits absent from update bodies are left unchanged
+		return constraints.checkResources(body, false)
+	}
+	return ""
+}
+
+func (constraints ContainerConstraints) checkCreate(body utils.Object) string {
+	hostConfig := getObject(body, "HostConfig")
+	if constraints.DenyPrivileged && hostConfig != nil {
+		if getBool(hostConfig, "Privileged") {
+			return "privileged container is not allowed"
+		}
+	}
+	if constraints.DenyHostNetwork && hostConfig != nil && getString(hostConfig, "NetworkMode") == "host" {
+		return "host network is not allowed"
+	}
+	if constraints.DenyHostPID && hostConfig != nil && getString(hostConfig, "PidMode") == "host" {
+		return "host pid namespace is not allowed"
+	}
+	if len(constraints.AllowedBindPrefixes) > 0 && hostConfig != nil {
+		for _, source := range bindSources(hostConfig) {
+			if !underPrefixes(source, constraints.AllowedBindPrefixes) {
+				return "bind mount of " + source + " is not allowed"
+			}
+		}
+	}
+	if len(constraints.AllowedImages) > 0 {
+		if image := getString(body, "Image"); !MatchImage(image, constraints.AllowedImages) {
+			return "image " + image + " is not allowed"
+		}
+	}
+	if hostConfig == nil {
+		hostConfig = utils.NewObjectNode()
+	}
+	return constraints.checkResources(hostConfig, true)
+}
+
+// checkResources checks limits of HostConfig or update bodies, absent limits are taken as unlimited when required
+func (constraints ContainerConstraints) checkResources(resources utils.Object, required bool) string {
+	if constraints.maxMemory > 0 {
+		if memory := getInt(resources, "Memory"); (memory == 0 && required) || memory > constraints.maxMemory {
+			return "memory limit above " + constraints.MaxMemory + " is not allowed"
+		}
+	}
+	if constraints.MaxCPUs > 0 {
+		cpus := float64(getInt(resources, "NanoCpus")) / 1e9
+		if quota := getInt(resources, "CpuQuota"); quota > 0 {
+			period := getInt(resources, "CpuPeriod")
+			if period <= 0 {
+				period = defaultCPUPeriod
+			}
+			cpus = float64(quota) / float64(period)
+		}
+		if (cpus == 0 && required) || cpus > constraints.MaxCPUs {
+			return "cpu limit above " + strconv.FormatFloat(constraints.MaxCPUs, 'f', -1, 64) + " is not allowed"
+		}
+	}
+	return ""
+}
+
+// bindSources returns host paths of binds and bind mounts, named volumes are skipped
+func bindSources(hostConfig utils.Object) []string {
+	var sources []string
+	if node, ok := hostConfig.Get("Binds"); ok {
+		if binds, ok := node.ArrayValue(); ok {
+			for i := 0; i < binds.Size(); i++ {
+				if bind, ok := binds.Get(i).StringValue(); ok {
+					if source := strings.SplitN(bind, ":", 2)[0]; filepath.IsAbs(source) {
+						sources = append(sources, source)
+					}
+				}
+			}
+		}
+	}
+	if node, ok := hostConfig.Get("Mounts"); ok {
+		if mounts, ok := node.ArrayValue(); ok {
+			for i := 0; i < mounts.Size(); i++ {
+				if mount, ok := mounts.Get(i).ObjectValue(); ok && getString(mount, "Type") == "bind" {
+					sources = append(sources, getString(mount, "Source"))
+				}
+			}
+		}
+	}
+	return sources
+}
+
+func underPrefixes(source string, prefixes []string) bool {
+	source = filepath.Clean(source)
+	for _, prefix := range prefixes {
+		if prefix == "/" || source == prefix || strings.HasPrefix(source, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchImage tells whether the image is one of patterns, a pattern ending with * matches images of the prefix
+func MatchImage(image string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(image, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		} else if image == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func getObject(object utils.Object, key string) utils.Object {
+	node, ok := object.Get(key)
+	if !ok {
+		return nil
+	}
+	value, _ := node.ObjectValue()
+	return value
+}
+
+func getString(object utils.Object, key string) string {
+	node, ok := object.Get(key)
+	if !ok {
+		return ""
+	}
+	value, _ := node.StringValue()
+	return value
+}
+
+func getInt(object utils.Object, key string) int64 {
+	node, ok := object.Get(key)
+	if !ok {
+		return 0
+	}
+	if value, ok := node.IntValue(); ok {
+		return value
+	}
+	value, _ := node.FloatValue()
+	return int64(value)
+}
+
+func getBool(object utils.Object, key string) bool {
+	node, ok := object.Get(key)
+	if !ok {
+		return false
+	}
+	value, _ := node.BoolValue()
+	return value
+}
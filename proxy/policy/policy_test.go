@@ -0,0 +1,165 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/projecteru2/barrel/proxy"
+)
+
+const testPolicy = `
+default: allow
+rules:
+  - name: ci-readonly
+    callers:
+      tlsClients: [ci]
+    endpoints:
+      - method: GET
+        path: .*
+    action: allow
+  - name: ci-denied
+    callers:
+      tlsClients: [ci]
+    action: deny
+  - name: restricted-create
+    endpoints:
+      - method: post
+        path: ^/containers/create$
+    action: allow
+    container:
+      denyPrivileged: true
+      denyHostNetwork: true
+      denyHostPID: true
+      allowedBindPrefixes: [/data/]
+      allowedImages: [registry.example.com/*, busybox]
+`
+
+func TestParseRejectsInvalidPolicy(t *testing.T) {
+	_, err := Parse([]byte("rules:\n  - action: maybe\n"))
+	assert.Error(t, err)
+	_, err = Parse([]byte("rules:\n  - action: deny\n    unknown: true\n"))
+	assert.Error(t, err)
+	_, err = Parse([]byte("rules:\n  - action: allow\n    container:\n      allowedBindPrefixes: [data]\n"))
+	assert.Error(t, err)
+}
+
+func TestEvaluateCallers(t *testing.T) {
+	policy, err := Parse([]byte(testPolicy))
+	assert.NoError(t, err)
+
+	ci := Caller{TLSClient: "ci"}
+	assert.True(t, policy.Evaluate(ci, http.MethodGet, "/containers/json", nil).Allowed)
+	decision := policy.Evaluate(ci, http.MethodPost, "/containers/abc/stop", nil)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, "ci-denied", decision.Rule)
+	// tls clients are matched by subject alternative names too
+	assert.Equal(t, "ci-denied", policy.Evaluate(Caller{TLSClient: "runner", TLSSANs: []string{"ci"}}, http.MethodPost, "/containers/abc/stop", nil).Rule)
+
+	uid, gid := uint32(1000), uint32(1000)
+	assert.True(t, policy.Evaluate(Caller{UID: &uid, GID: &gid}, http.MethodPost, "/containers/abc/stop", nil).Allowed)
+}
+
+func TestEvaluateContainerCreate(t *testing.T) {
+	policy, err := Parse([]byte(testPolicy))
+	assert.NoError(t, err)
+
+	for _, c := range []struct {
+		body    string
+		allowed bool
+	}{
+		{`{"Image": "busybox"}`, true},
+		{`{"Image": "registry.example.com/app:v1", "HostConfig": {"Binds": ["/data/app:/app", "vol:/vol"]}}`, true},
+		{`{"Image": "busybox", "HostConfig": {"Mounts": [{"Type": "volume", "Source": "vol"}]}}`, true},
+		{`{"Image": "alpine"}`, false},
+		{`{"Image": "busybox", "HostConfig": {"Privileged": true}}`, false},
+		{`{"Image": "busybox", "HostConfig": {"NetworkMode": "host"}}`, false},
+		{`{"Image": "busybox", "HostConfig": {"PidMode": "host"}}`, false},
+		{`{"Image": "busybox", "HostConfig": {"Binds": ["/etc:/etc"]}}`, false},
+		{`{"Image": "busybox", "HostConfig": {"Binds": ["/data/../etc:/etc"]}}`, false},
+		{`{"Image": "busybox", "HostConfig": {"Binds": ["/database:/db"]}}`, false},
+		{`{"Image": "busybox", "HostConfig": {"Mounts": [{"Type": "bind", "Source": "/"}]}}`, false},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/v1.41/containers/create?name=abc", strings.NewReader(c.body))
+		res := serve(t, policy, req)
+		if c.allowed {
+			assert.Equal(t, http.StatusOK, res.Code, c.body)
+		} else {
+			assert.Equal(t, http.StatusForbidden, res.Code, c.body)
+			var message struct{ Message string }
+			assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &message))
+			assert.True(t, strings.HasPrefix(message.Message, "authorization denied by barrel policy rule restricted-create: "), message.Message)
+		}
+	}
+}
+
+const testResourcePolicy = `
+rules:
+  - name: limited
+    action: allow
+    container:
+      denyPrivileged: true
+      maxMemory: 1g
+      maxCPUs: 2
+`
+
+func TestEvaluateContainerExecAndUpdate(t *testing.T) {
+	policy, err := Parse([]byte(testResourcePolicy))
+	assert.NoError(t, err)
+
+	for _, c := range []struct {
+		path    string
+		body    string
+		allowed bool
+	}{
+		{"/v1.41/containers/create", `{"Image": "busybox", "HostConfig": {"Memory": 536870912, "NanoCpus": 1000000000}}`, true},
+		// limits are required on create
+		{"/v1.41/containers/create", `{"Image": "busybox", "HostConfig": {"NanoCpus": 1000000000}}`, false},
+		{"/v1.41/containers/create", `{"Image": "busybox", "HostConfig": {"Memory": 536870912, "CpuQuota": 300000}}`, false},
+		{"/v1.41/containers/abc/exec", `{"Cmd": ["sh"]}`, true},
+		{"/v1.41/containers/abc/exec", `{"Cmd": ["sh"], "Privileged": true}`, false},
+		// limits absent from update bodies are unchanged
+		{"/v1.41/containers/abc/update", `{"RestartPolicy": {"Name": "always"}}`, true},
+		{"/v1.41/containers/abc/update", `{"Memory": 536870912, "CpuQuota": 100000, "CpuPeriod": 50000}`, true},
+		{"/v1.41/containers/abc/update", `{"Memory": 2147483648}`, false},
+		{"/v1.41/containers/abc/update", `{"NanoCpus": 4000000000}`, false},
+	} {
+		req := httptest.NewRequest(http.MethodPost, c.path, strings.NewReader(c.body))
+		res := serve(t, policy, req)
+		if c.allowed {
+			assert.Equal(t, http.StatusOK, res.Code, c.body)
+		} else {
+			assert.Equal(t, http.StatusForbidden, res.Code, c.body)
+		}
+	}
+
+	_, err = Parse([]byte("rules:\n  - action: allow\n    container:\n      maxMemory: lots\n"))
+	assert.Error(t, err)
+}
+
+func serve(t *testing.T, policy *Policy, req *http.Request) *httptest.ResponseRecorder {
+	res := httptest.NewRecorder()
+	proxy.HTTPProxyHandler{Handlers: []proxy.RequestHandler{
+		NewHandler(policy),
+		bodyEcho{t: t},
+	}}.ServeHTTP(res, req.WithContext(context.Background()))
+	return res
+}
+
+// bodyEcho checks the body is still readable after evaluated
+type bodyEcho struct {
+	t *testing.T
+}
+
+func (h bodyEcho) Handle(ctx proxy.HandleContext, res http.ResponseWriter, req *http.Request) {
+	content, err := ioutil.ReadAll(req.Body)
+	assert.NoError(h.t, err)
+	assert.True(h.t, json.Valid(content))
+	res.WriteHeader(http.StatusOK)
+}
@@ -1,19 +1,30 @@
 package proxy
 
 import (
+	"bufio"
 	"io"
 	"net"
 	"net/http"
+	"time"
 
+	"github.com/juju/errors"
 	log "github.com/sirupsen/logrus"
 
 	barrelHttp "github.com/projecteru2/barrel/http"
+	"github.com/projecteru2/barrel/metrics"
 	"github.com/projecteru2/barrel/utils"
 )
 
+const passthroughHandlerName = "passthrough"
+
 // HandleContext .
 type HandleContext interface {
+	// Next passes the request to the next handler
 	Next()
+	// NextWith passes the replaced request to the next handler, e.g. with values attached to its context
+	NextWith(*http.Request)
+	// Defer calls fn with the status code after the request is served, whichever handler serves it
+	Defer(fn func(status int))
 }
 
 // RequestHandler .
@@ -21,14 +32,66 @@ type RequestHandler interface {
 	Handle(HandleContext, http.ResponseWriter, *http.Request)
 }
 
+type namedHandler struct {
+	RequestHandler
+	name string
+}
+
+// WithName names the handler, the name is used as handler label of proxy metrics
+func WithName(name string, handler RequestHandler) RequestHandler {
+	return namedHandler{RequestHandler: handler, name: name}
+}
+
+func handlerName(handler RequestHandler) string {
+	if named, ok := handler.(namedHandler); ok {
+		return named.name
+	}
+	return "unnamed"
+}
+
+// statusRecorder records status code of response for metrics
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := r.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, errors.New("response writer can't be hijacked")
+}
+
 type handleContext struct {
-	next bool
+	next     bool
+	req      *http.Request
+	deferred []func(int)
 }
 
 func (ctx *handleContext) Next() {
 	ctx.next = true
 }
 
+func (ctx *handleContext) NextWith(req *http.Request) {
+	ctx.next = true
+	ctx.req = req
+}
+
+func (ctx *handleContext) Defer(fn func(int)) {
+	ctx.deferred = append(ctx.deferred, fn)
+}
+
 // HTTPProxyHandler .
 type HTTPProxyHandler struct {
 	Handlers   []RequestHandler
@@ -36,18 +99,35 @@ type HTTPProxyHandler struct {
 }
 
 func (ph HTTPProxyHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
-	log.Infof("[ComposedHttpHandler] Incoming request, method = %s, url = %s", req.Method, req.URL.String())
+	log.WithField("Client", barrelHttp.IdentityOf(req).String()).Infof("[ComposedHttpHandler] Incoming request, method = %s, url = %s", req.Method, req.URL.String())
 	utils.PrintHeaders("ServerRequestHeaders:", req.Header)
 
+	var (
+		start    = time.Now()
+		recorder = &statusRecorder{ResponseWriter: res, status: http.StatusOK}
+		name     = passthroughHandlerName
+	)
+	ctx := &handleContext{}
+	defer func() {
+		metrics.ObserveProxyRequest(name, recorder.status, start)
+		for i := len(ctx.deferred) - 1; i >= 0; i-- {
+			ctx.deferred[i](recorder.status)
+		}
+	}()
+
 	for _, handler := range ph.Handlers {
-		ctx := &handleContext{}
-		handler.Handle(ctx, res, req)
+		ctx.next, ctx.req = false, nil
+		handler.Handle(ctx, recorder, req)
 		if !ctx.next {
+			name = handlerName(handler)
 			return
 		}
+		if ctx.req != nil {
+			req = ctx.req
+		}
 	}
 
-	ph.proxy(res, req)
+	ph.proxy(recorder, req)
 }
 
 // Handle .
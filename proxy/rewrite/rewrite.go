@@ -0,0 +1,367 @@
+package rewrite
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/projecteru2/barrel/proxy/policy"
+	"github.com/projecteru2/barrel/utils"
+)
+
+// Op .
+type Op string
+
+const (
+	// OpSet replaces the value at the path, creating missing objects on the way
+	OpSet Op = "set"
+	// OpMerge merges objects key by key recursively and appends missing items to arrays,
+	// other values are replaced
+	OpMerge Op = "merge"
+	// OpDelete removes the member at the path, nothing happens when it's absent
+	OpDelete Op = "delete"
+)
+
+// Rules are applied in order, every matching rule applies
+type Rules struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule .
+type Rule struct {
+	Name    string   `yaml:"name"`
+	Match   Match    `yaml:"match"`
+	Actions []Action `yaml:"actions"`
+}
+
+// Match requires all of the conditions given, an empty match matches every container
+type Match struct {
+	// images of the container, an item ending with * matches images of the prefix
+	Images []string `yaml:"images"`
+	// labels of the container, a value of * matches any value
+	Labels map[string]string `yaml:"labels"`
+	// networks the container joins by network mode or endpoints config
+	Networks []string       `yaml:"networks"`
+	Callers  policy.Callers `yaml:"callers"`
+}
+
+// Action .
+type Action struct {
+	Op Op `yaml:"op"`
+	// json pointer (RFC 6901) into the create body, e.g. /HostConfig/LogConfig
+	Path  string      `yaml:"path"`
+	Value interface{} `yaml:"value"`
+	// segments of the path
+	segments []string
+	// json of the value, decoded for every application, so that requests don't share nodes
+	value []byte
+}
+
+// Load reads and validates the rules file
+func Load(path string) (*Rules, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(content)
+}
+
+// Parse .
+func Parse(content []byte) (*Rules, error) {
+	rules := &Rules{}
+	if err := yaml.UnmarshalStrict(content, rules); err != nil {
+		return nil, errors.Annotate(err, "parse rewrite rules")
+	}
+	for i := range rules.Rules {
+		rule := &rules.Rules[i]
+		if rule.Name == "" {
+			rule.Name = "#" + strconv.Itoa(i)
+		}
+		for j := range rule.Actions {
+			if err := rule.Actions[j].compile(); err != nil {
+				return nil, errors.Annotatef(err, "rule %s action #%d", rule.Name, j)
+			}
+		}
+	}
+	return rules, nil
+}
+
+func (action *Action) compile() error {
+	if action.Op != OpSet && action.Op != OpMerge && action.Op != OpDelete {
+		return errors.Errorf("invalid op %q, support only [ set | merge | delete ]", action.Op)
+	}
+	if !strings.HasPrefix(action.Path, "/") {
+		return errors.Errorf("path %q should be a json pointer starting with /", action.Path)
+	}
+	for _, segment := range strings.Split(action.Path[1:], "/") {
+		action.segments = append(action.segments, strings.NewReplacer("~1", "/", "~0", "~").Replace(segment))
+	}
+	if action.Op == OpDelete {
+		return nil
+	}
+	value, err := jsonValue(action.Value)
+	if err != nil {
+		return err
+	}
+	if action.value, err = json.Marshal(value); err != nil {
+		return err
+	}
+	return nil
+}
+
+// jsonValue converts maps decoded from yaml to maps of string keys
+func jsonValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted, err := jsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+			object[fmt.Sprint(key)] = converted
+		}
+		return object, nil
+	case []interface{}:
+		array := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			converted, err := jsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, converted)
+		}
+		return array, nil
+	default:
+		return v, nil
+	}
+}
+
+// Rewrite applies matching rules to the create body in place, returns names of rules applied
+func (rules *Rules) Rewrite(caller policy.Caller, body utils.Object) ([]string, error) {
+	var applied []string
+	for _, rule := range rules.Rules {
+		if !rule.Match.match(caller, body) {
+			continue
+		}
+		for _, action := range rule.Actions {
+			if err := action.apply(body); err != nil {
+				return applied, errors.Annotatef(err, "rule %s %s %s", rule.Name, action.Op, action.Path)
+			}
+		}
+		applied = append(applied, rule.Name)
+	}
+	return applied, nil
+}
+
+func (match Match) match(caller policy.Caller, body utils.Object) bool {
+	if len(match.Images) > 0 && !policy.MatchImage(getString(body, "Image"), match.Images) {
+		return false
+	}
+	if len(match.Labels) > 0 {
+		labels := getObject(body, "Labels")
+		if labels == nil {
+			return false
+		}
+		for key, expected := range match.Labels {
+			if value, ok := labels.Get(key); !ok || (expected != "*" && asString(value) != expected) {
+				return false
+			}
+		}
+	}
+	if len(match.Networks) > 0 && !matchNetworks(body, match.Networks) {
+		return false
+	}
+	return match.Callers.Match(caller)
+}
+
+func matchNetworks(body utils.Object, networks []string) bool {
+	var joined []string
+	if hostConfig := getObject(body, "HostConfig"); hostConfig != nil {
+		joined = append(joined, getString(hostConfig, "NetworkMode"))
+	}
+	if networkingConfig := getObject(body, "NetworkingConfig"); networkingConfig != nil {
+		if endpointsConfig := getObject(networkingConfig, "EndpointsConfig"); endpointsConfig != nil {
+			joined = append(joined, endpointsConfig.Keys()...)
+		}
+	}
+	for _, network := range networks {
+		for _, name := range joined {
+			if name == network {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (action Action) apply(body utils.Object) error {
+	var value utils.Any
+	if action.Op != OpDelete {
+		var err error
+		if value, err = utils.Unmarshal(action.value); err != nil {
+			return err
+		}
+	}
+	parent, err := walk(body.Any(), action.segments[:len(action.segments)-1], action.Op != OpDelete)
+	if err != nil || parent == nil {
+		return err
+	}
+	key := action.segments[len(action.segments)-1]
+	switch action.Op {
+	case OpSet:
+		return setMember(parent, key, value)
+	case OpMerge:
+		current, _ := getMember(parent, key)
+		if current == nil {
+			return setMember(parent, key, value)
+		}
+		merged, err := merge(current, value)
+		if err != nil {
+			return err
+		}
+		return setMember(parent, key, merged)
+	default:
+		if object, ok := parent.ObjectValue(); ok {
+			object.Del(key)
+			return nil
+		}
+		return errors.Errorf("delete supports only object members")
+	}
+}
+
+// walk returns the node at segments, missing members are created as objects when create is true,
+// otherwise nil is returned
+func walk(node utils.Any, segments []string, create bool) (utils.Any, error) {
+	for _, segment := range segments {
+		child, err := getMember(node, segment)
+		if err != nil {
+			return nil, err
+		}
+		if child == nil || child.Null() {
+			if !create {
+				return nil, nil
+			}
+			child = utils.NewObjectNode().Any()
+			if err = setMember(node, segment, child); err != nil {
+				return nil, err
+			}
+		}
+		node = child
+	}
+	return node, nil
+}
+
+// getMember returns nil when the member is absent
+func getMember(node utils.Any, key string) (utils.Any, error) {
+	if object, ok := node.ObjectValue(); ok {
+		value, _ := object.Get(key)
+		return value, nil
+	}
+	if array, ok := node.ArrayValue(); ok {
+		index, err := arrayIndex(key)
+		if err != nil || index >= array.Size() {
+			return nil, err
+		}
+		return array.Get(index), nil
+	}
+	return nil, errors.Errorf("%s is neither object nor array", node.String())
+}
+
+func setMember(node utils.Any, key string, value utils.Any) error {
+	if object, ok := node.ObjectValue(); ok {
+		object.Set(key, value)
+		return nil
+	}
+	if array, ok := node.ArrayValue(); ok {
+		index, err := arrayIndex(key)
+		if err != nil {
+			return err
+		}
+		// the index of size appends, others beyond would leave holes
+		if index > array.Size() {
+			return errors.Errorf("array index %d is out of range, size %d", index, array.Size())
+		}
+		array.Set(index, value)
+		return nil
+	}
+	return errors.Errorf("%s is neither object nor array", node.String())
+}
+
+func arrayIndex(key string) (int, error) {
+	index, err := strconv.Atoi(key)
+	if err != nil || index < 0 {
+		return 0, errors.Errorf("invalid array index %q", key)
+	}
+	return index, nil
+}
+
+func merge(current utils.Any, value utils.Any) (utils.Any, error) {
+	if currentObject, ok := current.ObjectValue(); ok {
+		valueObject, ok := value.ObjectValue()
+		if !ok {
+			return nil, errors.Errorf("can't merge %s into object", value.String())
+		}
+		for _, key := range valueObject.Keys() {
+			item, _ := valueObject.Get(key)
+			if existing, ok := currentObject.Get(key); ok && !existing.Null() {
+				merged, err := merge(existing, item)
+				if err != nil {
+					return nil, err
+				}
+				item = merged
+			}
+			currentObject.Set(key, item)
+		}
+		return current, nil
+	}
+	if currentArray, ok := current.ArrayValue(); ok {
+		valueArray, ok := value.ArrayValue()
+		if !ok {
+			return nil, errors.Errorf("can't merge %s into array", value.String())
+		}
+		for i := 0; i < valueArray.Size(); i++ {
+			if item := valueArray.Get(i); !containsItem(currentArray, item) {
+				currentArray.Add(item)
+			}
+		}
+		return current, nil
+	}
+	return value, nil
+}
+
+func containsItem(array utils.Array, item utils.Any) bool {
+	for i := 0; i < array.Size(); i++ {
+		if array.Get(i).String() == item.String() {
+			return true
+		}
+	}
+	return false
+}
+
+func getObject(object utils.Object, key string) utils.Object {
+	node, ok := object.Get(key)
+	if !ok {
+		return nil
+	}
+	value, _ := node.ObjectValue()
+	return value
+}
+
+func getString(object utils.Object, key string) string {
+	node, ok := object.Get(key)
+	if !ok {
+		return ""
+	}
+	return asString(node)
+}
+
+func asString(node utils.Any) string {
+	value, _ := node.StringValue()
+	return value
+}
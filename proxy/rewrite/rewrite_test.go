@@ -0,0 +1,158 @@
+package rewrite
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/projecteru2/barrel/proxy/policy"
+	"github.com/projecteru2/barrel/utils"
+)
+
+const testRules = `
+rules:
+  - name: log-opts
+    actions:
+      - op: set
+        path: /HostConfig/LogConfig
+        value:
+          Type: json-file
+          Config:
+            max-size: 10m
+  - name: infra-defaults
+    match:
+      images: [registry.example.com/infra/*]
+      labels:
+        team: "*"
+    actions:
+      - op: merge
+        path: /Labels
+        value:
+          owner: infra
+      - op: merge
+        path: /Env
+        value: [SIDECAR=1]
+      - op: merge
+        path: /HostConfig/Ulimits
+        value:
+          - Name: nofile
+            Soft: 65535
+            Hard: 65535
+      - op: delete
+        path: /Labels/debug
+  - name: calico-only
+    match:
+      networks: [calico-net]
+      callers:
+        tlsClients: [ci]
+    actions:
+      - op: set
+        path: /Labels/com.example~1network
+        value: calico
+`
+
+func applyRules(t *testing.T, rules *Rules, caller policy.Caller, body string) ([]string, string) {
+	object, err := utils.UnmarshalObject([]byte(body))
+	assert.NoError(t, err)
+	applied, err := rules.Rewrite(caller, object)
+	assert.NoError(t, err)
+	content, err := utils.Marshal(object.Any())
+	assert.NoError(t, err)
+	return applied, string(content)
+}
+
+func TestRewrite(t *testing.T) {
+	rules, err := Parse([]byte(testRules))
+	assert.NoError(t, err)
+
+	applied, body := applyRules(t, rules, policy.Caller{}, `{"Image": "busybox", "HostConfig": {"LogConfig": {"Type": "none"}}}`)
+	assert.Equal(t, []string{"log-opts"}, applied)
+	assert.JSONEq(t, `{"Image": "busybox", "HostConfig": {"LogConfig": {"Type": "json-file", "Config": {"max-size": "10m"}}}}`, body)
+
+	applied, body = applyRules(t, rules, policy.Caller{}, `{
+		"Image": "registry.example.com/infra/app:v1",
+		"Labels": {"team": "infra", "debug": "1"},
+		"Env": ["SIDECAR=1", "A=1"]
+	}`)
+	assert.Equal(t, []string{"log-opts", "infra-defaults"}, applied)
+	assert.JSONEq(t, `{
+		"Image": "registry.example.com/infra/app:v1",
+		"Labels": {"team": "infra", "owner": "infra"},
+		"Env": ["SIDECAR=1", "A=1"],
+		"HostConfig": {
+			"LogConfig": {"Type": "json-file", "Config": {"max-size": "10m"}},
+			"Ulimits": [{"Name": "nofile", "Soft": 65535, "Hard": 65535}]
+		}
+	}`, body)
+
+	body = `{"Image": "busybox", "HostConfig": {"NetworkMode": "calico-net"}}`
+	applied, _ = applyRules(t, rules, policy.Caller{}, body)
+	assert.Equal(t, []string{"log-opts"}, applied)
+	applied, body = applyRules(t, rules, policy.Caller{TLSClient: "ci"}, body)
+	assert.Equal(t, []string{"log-opts", "calico-only"}, applied)
+	assert.JSONEq(t, `{
+		"Image": "busybox",
+		"Labels": {"com.example/network": "calico"},
+		"HostConfig": {"NetworkMode": "calico-net", "LogConfig": {"Type": "json-file", "Config": {"max-size": "10m"}}}
+	}`, body)
+}
+
+func TestRewriteDoesNotShareValues(t *testing.T) {
+	rules, err := Parse([]byte("rules:\n  - actions:\n      - op: set\n        path: /Labels\n        value: {a: b}\n"))
+	assert.NoError(t, err)
+
+	first, err := utils.UnmarshalObject([]byte(`{}`))
+	assert.NoError(t, err)
+	_, err = rules.Rewrite(policy.Caller{}, first)
+	assert.NoError(t, err)
+	labels, _ := first.Get("Labels")
+	object, _ := labels.ObjectValue()
+	object.Set("c", utils.NewStringNode("d"))
+
+	_, body := applyRules(t, rules, policy.Caller{}, `{}`)
+	assert.JSONEq(t, `{"Labels": {"a": "b"}}`, body)
+}
+
+func TestRewriteMismatchedTypes(t *testing.T) {
+	rules, err := Parse([]byte("rules:\n  - actions:\n      - op: merge\n        path: /Env\n        value: [A=1]\n"))
+	assert.NoError(t, err)
+	object, err := utils.UnmarshalObject([]byte(`{"Env": {"A": "1"}}`))
+	assert.NoError(t, err)
+	_, err = rules.Rewrite(policy.Caller{}, object)
+	assert.Error(t, err)
+}
+
+func TestRewriteArrayIndex(t *testing.T) {
+	rules, err := Parse([]byte("rules:\n  - actions:\n      - op: set\n        path: /Cmd/1\n        value: sh\n"))
+	assert.NoError(t, err)
+
+	// the index of size appends
+	_, body := applyRules(t, rules, policy.Caller{}, `{"Cmd": ["bash"]}`)
+	assert.JSONEq(t, `{"Cmd": ["bash", "sh"]}`, body)
+
+	object, err := utils.UnmarshalObject([]byte(`{"Cmd": []}`))
+	assert.NoError(t, err)
+	_, err = rules.Rewrite(policy.Caller{}, object)
+	assert.Error(t, err)
+
+	// members created along the path are bounded too
+	rules, err = Parse([]byte("rules:\n  - actions:\n      - op: set\n        path: /Mounts/2/Type\n        value: bind\n"))
+	assert.NoError(t, err)
+	object, err = utils.UnmarshalObject([]byte(`{"Mounts": [{"Type": "volume"}]}`))
+	assert.NoError(t, err)
+	_, err = rules.Rewrite(policy.Caller{}, object)
+	assert.Error(t, err)
+	_, err = utils.Marshal(object.Any())
+	assert.NoError(t, err)
+}
+
+func TestParseRejectsInvalidRules(t *testing.T) {
+	for _, content := range []string{
+		"rules:\n  - actions:\n      - op: replace\n        path: /Labels\n",
+		"rules:\n  - actions:\n      - op: delete\n        path: Labels\n",
+		"rules:\n  - match:\n      image: busybox\n",
+	} {
+		_, err := Parse([]byte(content))
+		assert.Error(t, err, content)
+	}
+}
@@ -20,7 +20,7 @@ func RecycleMounts(paths []string) {
 	paths = minify(paths)
 
 	for _, path := range paths {
-		if !matchPrefix(path) {
+		if !MatchPrefix(path) {
 			log.WithField("path", path).Info("Path not matching resource path prefixes")
 			continue
 		}
@@ -32,7 +32,8 @@ func RecycleMounts(paths []string) {
 	}
 }
 
-func matchPrefix(path string) bool {
+// MatchPrefix tells whether the path is under resource path prefixes
+func MatchPrefix(path string) bool {
 	for _, prefix := range resPathPrefixes {
 		if strings.HasPrefix(path, prefix) {
 			return true
@@ -0,0 +1,601 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/juju/errors"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/projecteru2/barrel/store"
+)
+
+var (
+	kvsBucket    = []byte("kvs")
+	leasesBucket = []byte("leases")
+	metaBucket   = []byte("meta")
+	// revision is increased on each write, as the revision of etcd
+	revisionKey = []byte("revision")
+	// lease is the last granted lease id
+	leaseKey = []byte("lease")
+
+	errKeyIsBlank = errors.New("Key shouldn't be blank")
+	errNoOps      = errors.New("No ops")
+)
+
+// record is the value persisted for a key
+type record struct {
+	Value string
+	// Version counts puts of the key since created, it's what codecs see
+	Version int64
+	// CreateRevision and ModRevision are store revisions when the key is created and last modified
+	CreateRevision int64
+	ModRevision    int64
+	// Lease the key attached to, 0 means not attached to any lease
+	Lease int64 `json:",omitempty"`
+}
+
+// leaseRecord is the value persisted for a lease
+type leaseRecord struct {
+	TTL time.Duration
+	// ExpireAt in unix nano
+	ExpireAt int64
+}
+
+func (l leaseRecord) expired(now time.Time) bool {
+	return now.UnixNano() >= l.ExpireAt
+}
+
+type boltStore struct {
+	db  *bolt.DB
+	hub *store.WatchHub
+}
+
+// txn collects changes made in the transaction, which are notified to watchers after committed
+type txn struct {
+	*bolt.Tx
+	events []store.WatchEvent
+}
+
+// NewBoltStore opens or creates the bolt file as a store,
+// the file is locked by the process until exits
+func NewBoltStore(path string, timeout time.Duration) (store.Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: timeout})
+	if err != nil {
+		return nil, err
+	}
+	s := &boltStore{db: db, hub: store.NewWatchHub()}
+	if err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{kvsBucket, leasesBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return (&txn{Tx: tx}).purgeExpired(time.Now())
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get .
+func (b *boltStore) Get(ctx context.Context, codec store.Codec) error {
+	var (
+		r   record
+		ok  bool
+		err error
+	)
+	if err = b.db.View(func(tx *bolt.Tx) (err error) {
+		r, ok, err = (&txn{Tx: tx}).get(codec.Key())
+		return err
+	}); err != nil {
+		return err
+	}
+	if !ok {
+		return store.ErrKVNotExists
+	}
+	codec.SetVersion(r.Version)
+	return codec.Decode(r.Value)
+}
+
+// GetMulti .
+func (b *boltStore) GetMulti(ctx context.Context, codec store.MultiGetCodec) error {
+	var records []record
+	if err := b.db.View(func(t *bolt.Tx) error {
+		var (
+			tx     = &txn{Tx: t}
+			prefix = []byte(codec.Prefix())
+			alive  = make(map[int64]bool)
+		)
+		cursor := tx.Bucket(kvsBucket).Cursor()
+		for k, v := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Next() {
+			var r record
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			if r.Lease != 0 {
+				if _, ok := alive[r.Lease]; !ok {
+					_, found, err := tx.getLease(r.Lease)
+					if err != nil {
+						return err
+					}
+					alive[r.Lease] = found
+				}
+				if !alive[r.Lease] {
+					continue
+				}
+			}
+			records = append(records, r)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, r := range records {
+		codec.Decode(r.Value, r.Version)
+	}
+	return nil
+}
+
+// Put .
+func (b *boltStore) Put(ctx context.Context, codec store.Codec) error {
+	return b.PutWithLease(ctx, codec, 0)
+}
+
+// PutWithTTL .
+func (b *boltStore) PutWithTTL(ctx context.Context, codec store.Codec, ttl time.Duration) error {
+	if codec.Key() == "" {
+		return errKeyIsBlank
+	}
+	id, err := b.Grant(ctx, ttl)
+	if err != nil {
+		return err
+	}
+	return b.PutWithLease(ctx, codec, id)
+}
+
+// Grant .
+func (b *boltStore) Grant(ctx context.Context, ttl time.Duration) (store.LeaseID, error) {
+	if ttl < store.MinLeaseTTL {
+		ttl = store.MinLeaseTTL
+	}
+	var id int64
+	if err := b.update(func(tx *txn) (err error) {
+		if id, err = nextSequence(tx.Tx, leaseKey); err != nil {
+			return err
+		}
+		return tx.putLease(id, leaseRecord{TTL: ttl, ExpireAt: time.Now().Add(ttl).UnixNano()})
+	}); err != nil {
+		return 0, err
+	}
+	return store.LeaseID(id), nil
+}
+
+// KeepAlive .
+func (b *boltStore) KeepAlive(ctx context.Context, id store.LeaseID) (<-chan struct{}, error) {
+	ttl, err := b.refresh(id)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if _, err := b.refresh(id); err != nil {
+				return
+			}
+		}
+	}()
+	return done, nil
+}
+
+// refresh renews the lease and returns its ttl
+func (b *boltStore) refresh(id store.LeaseID) (time.Duration, error) {
+	var ttl time.Duration
+	err := b.update(func(tx *txn) error {
+		l, ok, err := tx.getLease(int64(id))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return store.ErrLeaseNotFound
+		}
+		ttl = l.TTL
+		l.ExpireAt = time.Now().Add(l.TTL).UnixNano()
+		return tx.putLease(int64(id), l)
+	})
+	return ttl, err
+}
+
+// Revoke .
+func (b *boltStore) Revoke(ctx context.Context, id store.LeaseID) error {
+	return b.update(func(tx *txn) error {
+		_, ok, err := tx.getLease(int64(id))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return store.ErrLeaseNotFound
+		}
+		return tx.revoke(int64(id))
+	})
+}
+
+// PutWithLease .
+func (b *boltStore) PutWithLease(ctx context.Context, codec store.Codec, lease store.LeaseID) error {
+	var (
+		key = codec.Key()
+		val string
+		err error
+	)
+	if key == "" {
+		return errKeyIsBlank
+	}
+	if val, err = codec.Encode(); err != nil {
+		return err
+	}
+
+	var version int64
+	if err = b.update(func(tx *txn) (err error) {
+		if lease != 0 {
+			var ok bool
+			if _, ok, err = tx.getLease(int64(lease)); err != nil {
+				return err
+			}
+			if !ok {
+				return store.ErrLeaseNotFound
+			}
+		}
+		version, err = tx.put(key, val, int64(lease))
+		return err
+	}); err != nil {
+		return err
+	}
+	codec.SetVersion(version)
+	return nil
+}
+
+// Delete .
+func (b *boltStore) Delete(ctx context.Context, codec store.Codec) error {
+	key := codec.Key()
+	if key == "" {
+		return errKeyIsBlank
+	}
+	return b.update(func(tx *txn) error {
+		_, ok, err := tx.get(key)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return store.ErrKVNotExists
+		}
+		return tx.delete(key)
+	})
+}
+
+// GetAndDelete .
+func (b *boltStore) GetAndDelete(ctx context.Context, codec store.Codec) error {
+	key := codec.Key()
+	if key == "" {
+		return errKeyIsBlank
+	}
+	var r record
+	if err := b.update(func(tx *txn) (err error) {
+		var ok bool
+		if r, ok, err = tx.get(key); err != nil {
+			return err
+		}
+		if !ok {
+			return store.ErrKVNotExists
+		}
+		return tx.delete(key)
+	}); err != nil {
+		return err
+	}
+	codec.SetVersion(0)
+	return codec.Decode(r.Value)
+}
+
+// DeleteElseGet .
+func (b *boltStore) DeleteElseGet(ctx context.Context, codec store.Codec) (bool, error) {
+	key := codec.Key()
+	if key == "" {
+		return false, errKeyIsBlank
+	}
+	var (
+		succeeded bool
+		exists    bool
+		prev      record
+	)
+	if err := b.update(func(tx *txn) (err error) {
+		if prev, exists, err = tx.get(key); err != nil || !exists {
+			return err
+		}
+		if prev.Version != codec.Version() {
+			return nil
+		}
+		succeeded = true
+		return tx.delete(key)
+	}); err != nil {
+		return false, err
+	}
+	if succeeded {
+		codec.SetVersion(0)
+		return true, nil
+	}
+	if !exists {
+		return false, store.ErrKVNotExists
+	}
+	codec.SetVersion(prev.Version)
+	return false, codec.Decode(prev.Value)
+}
+
+// UpdateElseGet .
+func (b *boltStore) UpdateElseGet(ctx context.Context, codec store.Codec) (bool, error) {
+	var (
+		value string
+		err   error
+	)
+	if value, err = codec.Encode(); err != nil {
+		return false, err
+	}
+	var (
+		key         = codec.Key()
+		prevVersion = codec.Version()
+		succeeded   bool
+		exists      bool
+		version     int64
+		prev        record
+	)
+	if err = b.update(func(tx *txn) (err error) {
+		if prev, exists, err = tx.get(key); err != nil {
+			return err
+		}
+		if prev.Version != prevVersion {
+			return nil
+		}
+		succeeded = true
+		version, err = tx.put(key, value, 0)
+		return err
+	}); err != nil {
+		return false, err
+	}
+	if succeeded {
+		codec.SetVersion(version)
+		return true, nil
+	}
+	if !exists {
+		return false, store.ErrKVNotExists
+	}
+	codec.SetVersion(prev.Version)
+	return false, codec.Decode(prev.Value)
+}
+
+// Update .
+func (b *boltStore) Update(ctx context.Context, codec store.UpdateCodec) (bool, error) {
+	for {
+		var (
+			succeeded bool
+			err       error
+		)
+		if succeeded, err = b.UpdateElseGet(ctx, codec); err != nil {
+			return succeeded, err
+		}
+		if succeeded {
+			return true, nil
+		}
+		if !codec.Retry() {
+			return false, nil
+		}
+	}
+}
+
+// PutMulti puts all codecs in one transaction
+func (b *boltStore) PutMulti(ctx context.Context, codecs ...store.Codec) error {
+	data := make(map[string]string)
+	for _, encoder := range codecs {
+		var (
+			key = encoder.Key()
+			val string
+			err error
+		)
+		if key == "" {
+			return errKeyIsBlank
+		}
+		if val, err = encoder.Encode(); err != nil {
+			return err
+		}
+		data[key] = val
+	}
+	if len(data) == 0 {
+		return errNoOps
+	}
+	return b.update(func(tx *txn) error {
+		for key, val := range data {
+			if _, err := tx.put(key, val, 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Watch .
+func (b *boltStore) Watch(ctx context.Context, prefix string) <-chan store.WatchEvent {
+	return b.hub.Watch(ctx, prefix)
+}
+
+func (b *boltStore) update(fn func(*txn) error) error {
+	tx := &txn{}
+	if err := b.db.Update(func(t *bolt.Tx) error {
+		tx.Tx = t
+		tx.events = nil
+		return fn(tx)
+	}); err != nil {
+		return err
+	}
+	b.hub.Notify(tx.events...)
+	return nil
+}
+
+// get treats record attached to an expired lease as absent
+func (tx *txn) get(key string) (record, bool, error) {
+	var r record
+	v := tx.Bucket(kvsBucket).Get([]byte(key))
+	if v == nil {
+		return r, false, nil
+	}
+	if err := json.Unmarshal(v, &r); err != nil {
+		return r, false, err
+	}
+	if r.Lease != 0 {
+		if _, ok, err := tx.getLease(r.Lease); err != nil || !ok {
+			return record{}, false, err
+		}
+	}
+	return r, true, nil
+}
+
+// getLease treats expired lease as absent, and revokes it in writable transaction
+func (tx *txn) getLease(id int64) (leaseRecord, bool, error) {
+	var l leaseRecord
+	v := tx.Bucket(leasesBucket).Get(itob(id))
+	if v == nil {
+		return l, false, nil
+	}
+	if err := json.Unmarshal(v, &l); err != nil {
+		return l, false, err
+	}
+	if l.expired(time.Now()) {
+		if tx.Writable() {
+			return leaseRecord{}, false, tx.revoke(id)
+		}
+		return leaseRecord{}, false, nil
+	}
+	return l, true, nil
+}
+
+func (tx *txn) putLease(id int64, l leaseRecord) error {
+	bs, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(leasesBucket).Put(itob(id), bs)
+}
+
+// revoke deletes the lease and keys attached to it,
+// keys are not indexed by lease, so all keys are scanned
+func (tx *txn) revoke(id int64) error {
+	if err := tx.Bucket(leasesBucket).Delete(itob(id)); err != nil {
+		return err
+	}
+	var keys []string
+	if err := tx.Bucket(kvsBucket).ForEach(func(k, v []byte) error {
+		var r record
+		if err := json.Unmarshal(v, &r); err != nil {
+			return err
+		}
+		if r.Lease == id {
+			keys = append(keys, string(k))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := tx.delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *txn) delete(key string) error {
+	if err := tx.Bucket(kvsBucket).Delete([]byte(key)); err != nil {
+		return err
+	}
+	tx.events = append(tx.events, store.WatchEvent{Type: store.EventTypeDelete, Key: key})
+	return nil
+}
+
+func (tx *txn) put(key string, value string, lease int64) (int64, error) {
+	prev, exists, err := tx.get(key)
+	if err != nil {
+		return 0, err
+	}
+	revision, err := nextSequence(tx.Tx, revisionKey)
+	if err != nil {
+		return 0, err
+	}
+	r := record{
+		Value:          value,
+		Version:        prev.Version + 1,
+		CreateRevision: prev.CreateRevision,
+		ModRevision:    revision,
+		Lease:          lease,
+	}
+	if !exists {
+		r.CreateRevision = revision
+	}
+	bs, err := json.Marshal(r)
+	if err != nil {
+		return 0, err
+	}
+	if err = tx.Bucket(kvsBucket).Put([]byte(key), bs); err != nil {
+		return 0, err
+	}
+	tx.events = append(tx.events, store.WatchEvent{Type: store.EventTypePut, Key: key, Value: value, Version: r.Version})
+	return r.Version, nil
+}
+
+// nextSequence increases the counter of key in meta bucket
+func nextSequence(tx *bolt.Tx, key []byte) (int64, error) {
+	bucket := tx.Bucket(metaBucket)
+	var seq int64
+	if v := bucket.Get(key); v != nil {
+		seq = int64(binary.BigEndian.Uint64(v))
+	}
+	seq++
+	return seq, bucket.Put(key, itob(seq))
+}
+
+func itob(v int64) []byte {
+	bs := make([]byte, 8)
+	binary.BigEndian.PutUint64(bs, uint64(v))
+	return bs
+}
+
+// purgeExpired revokes expired leases left since last run
+func (tx *txn) purgeExpired(now time.Time) error {
+	var expired []int64
+	if err := tx.Bucket(leasesBucket).ForEach(func(k, v []byte) error {
+		var l leaseRecord
+		if err := json.Unmarshal(v, &l); err != nil {
+			return err
+		}
+		if l.expired(now) {
+			expired = append(expired, int64(binary.BigEndian.Uint64(k)))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, id := range expired {
+		if err := tx.revoke(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
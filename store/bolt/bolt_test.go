@@ -0,0 +1,23 @@
+package bolt
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/projecteru2/barrel/store"
+	"github.com/projecteru2/barrel/store/storetest"
+)
+
+func TestBoltStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		stor, err := NewBoltStore(filepath.Join(t.TempDir(), "barrel.db"), time.Second)
+		assert.NoError(t, err)
+		t.Cleanup(func() {
+			stor.(*boltStore).db.Close()
+		})
+		return stor
+	})
+}
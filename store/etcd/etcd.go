@@ -3,8 +3,10 @@ package etcd
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
 	"github.com/juju/errors"
 
 	"github.com/projecteru2/barrel/store"
@@ -21,7 +23,7 @@ var (
 )
 
 type etcdStore struct {
-	cli clientv3.KV
+	cli *clientv3.Client
 }
 
 // NewEtcdStore .
@@ -47,7 +49,7 @@ func (e *etcdStore) Get(ctx context.Context, codec store.Codec) error {
 }
 
 func (e *etcdStore) GetMulti(ctx context.Context, codec store.MultiGetCodec) error {
-	resp, err := e.cli.Get(ctx, codec.Prefix())
+	resp, err := e.cli.Get(ctx, codec.Prefix(), clientv3.WithPrefix())
 	if err != nil {
 		return err
 	}
@@ -77,11 +79,94 @@ func (e *etcdStore) Put(ctx context.Context, codec store.Codec) error {
 	if resp.PrevKv != nil {
 		codec.SetVersion(resp.PrevKv.Version + 1)
 	} else {
-		codec.SetVersion(0)
+		codec.SetVersion(1)
 	}
 	return nil
 }
 
+// PutWithTTL save a key value attached to a lease,
+// the key is removed by etcd when the lease expires
+func (e *etcdStore) PutWithTTL(ctx context.Context, codec store.Codec, ttl time.Duration) error {
+	if codec.Key() == "" {
+		return errKeyIsBlank
+	}
+	lease, err := e.Grant(ctx, ttl)
+	if err != nil {
+		return err
+	}
+	return e.PutWithLease(ctx, codec, lease)
+}
+
+// Grant .
+func (e *etcdStore) Grant(ctx context.Context, ttl time.Duration) (store.LeaseID, error) {
+	if ttl < store.MinLeaseTTL {
+		ttl = store.MinLeaseTTL
+	}
+	resp, err := e.cli.Grant(ctx, int64(ttl/time.Second))
+	if err != nil {
+		return 0, err
+	}
+	return store.LeaseID(resp.ID), nil
+}
+
+// PutWithLease .
+func (e *etcdStore) PutWithLease(ctx context.Context, codec store.Codec, lease store.LeaseID) error {
+	var (
+		key  = codec.Key()
+		val  string
+		err  error
+		resp *clientv3.PutResponse
+	)
+	if key == "" {
+		return errKeyIsBlank
+	}
+	if val, err = codec.Encode(); err != nil {
+		return err
+	}
+	if resp, err = e.cli.Put(ctx, key, val, clientv3.WithLease(clientv3.LeaseID(lease)), clientv3.WithPrevKV()); err != nil {
+		return leaseError(err)
+	}
+	if resp.PrevKv != nil {
+		codec.SetVersion(resp.PrevKv.Version + 1)
+	} else {
+		codec.SetVersion(1)
+	}
+	return nil
+}
+
+// KeepAlive .
+func (e *etcdStore) KeepAlive(ctx context.Context, lease store.LeaseID) (<-chan struct{}, error) {
+	// keep alive of etcd client doesn't fail on lost lease, which is checked first here
+	if _, err := e.cli.KeepAliveOnce(ctx, clientv3.LeaseID(lease)); err != nil {
+		return nil, leaseError(err)
+	}
+	ch, err := e.cli.KeepAlive(ctx, clientv3.LeaseID(lease))
+	if err != nil {
+		return nil, leaseError(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// responses must be consumed, otherwise the keep alive channel is full
+		for range ch {
+		}
+	}()
+	return done, nil
+}
+
+// Revoke .
+func (e *etcdStore) Revoke(ctx context.Context, lease store.LeaseID) error {
+	_, err := e.cli.Revoke(ctx, clientv3.LeaseID(lease))
+	return leaseError(err)
+}
+
+func leaseError(err error) error {
+	if err == rpctypes.ErrLeaseNotFound {
+		return store.ErrLeaseNotFound
+	}
+	return err
+}
+
 // Delete delete key
 // returns true on delete count > 0
 func (e *etcdStore) Delete(ctx context.Context, codec store.Codec) error {
@@ -123,6 +208,49 @@ func (e *etcdStore) GetAndDelete(ctx context.Context, codec store.Codec) error {
 	return codec.Decode(string(resp.PrevKvs[0].Value))
 }
 
+// DeleteElseGet .
+func (e *etcdStore) DeleteElseGet(ctx context.Context, codec store.Codec) (bool, error) {
+	var (
+		key  = codec.Key()
+		resp *clientv3.TxnResponse
+		err  error
+	)
+	if key == "" {
+		return false, errKeyIsBlank
+	}
+	// version 0 matches absent keys in etcd, which are not deleted here
+	if resp, err = e.cli.Txn(
+		ctx,
+	).If(
+		clientv3.Compare(clientv3.Version(key), "=", codec.Version()),
+		clientv3.Compare(clientv3.Version(key), ">", 0),
+	).Then(
+		clientv3.OpDelete(key),
+	).Else(
+		clientv3.OpGet(key),
+	).Commit(); err != nil {
+		return false, err
+	}
+	if len(resp.Responses) != 1 {
+		return resp.Succeeded, store.ErrUnexpectedTxnResp
+	}
+	if resp.Succeeded {
+		codec.SetVersion(0)
+		return true, nil
+	}
+
+	r := resp.Responses[0].GetResponseRange()
+	if r == nil {
+		return false, store.ErrUnexpectedTxnResp
+	}
+	if r.Count == 0 {
+		return false, store.ErrKVNotExists
+	}
+	kv := r.Kvs[0]
+	codec.SetVersion(kv.Version)
+	return false, codec.Decode(string(kv.Value))
+}
+
 // Update .
 func (e *etcdStore) UpdateElseGet(ctx context.Context, codec store.Codec) (bool, error) {
 	var (
@@ -158,7 +286,9 @@ func (e *etcdStore) UpdateElseGet(ctx context.Context, codec store.Codec) (bool,
 			return true, store.ErrUnexpectedTxnResp
 		}
 		if r.PrevKv == nil {
-			return true, store.ErrKVNotExists
+			// the key is created by this txn
+			codec.SetVersion(1)
+			return true, nil
 		}
 		codec.SetVersion(r.PrevKv.Version + 1)
 		return true, nil
@@ -195,6 +325,51 @@ func (e *etcdStore) Update(ctx context.Context, codec store.UpdateCodec) (bool,
 	}
 }
 
+// Watch returns after the watcher is created,
+// so that changes made after the call are all observed
+func (e *etcdStore) Watch(ctx context.Context, prefix string) <-chan store.WatchEvent {
+	ch := make(chan store.WatchEvent)
+	wch := e.cli.Watch(clientv3.WithRequireLeader(ctx), prefix, clientv3.WithPrefix(), clientv3.WithCreatedNotify())
+	if resp, ok := <-wch; ok && resp.Err() != nil {
+		go func() {
+			defer close(ch)
+			select {
+			case ch <- store.WatchEvent{Err: resp.Err()}:
+			case <-ctx.Done():
+			}
+		}()
+		return ch
+	}
+	go func() {
+		defer close(ch)
+		for resp := range wch {
+			if err := resp.Err(); err != nil {
+				select {
+				case ch <- store.WatchEvent{Err: err}:
+				case <-ctx.Done():
+				}
+				return
+			}
+			for _, ev := range resp.Events {
+				event := store.WatchEvent{Key: string(ev.Kv.Key)}
+				if ev.Type == clientv3.EventTypeDelete {
+					event.Type = store.EventTypeDelete
+				} else {
+					event.Type = store.EventTypePut
+					event.Value = string(ev.Kv.Value)
+					event.Version = ev.Kv.Version
+				}
+				select {
+				case ch <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch
+}
+
 // PutMulti .
 func (e *etcdStore) PutMulti(ctx context.Context, codecs ...store.Codec) error {
 	data := make(map[string]string)
@@ -9,6 +9,7 @@ import (
 
 	barrelEtcd "github.com/projecteru2/barrel/etcd"
 	"github.com/projecteru2/barrel/store"
+	"github.com/projecteru2/barrel/store/storetest"
 	"github.com/projecteru2/barrel/types"
 	"github.com/projecteru2/barrel/vessel/codecs"
 )
@@ -35,3 +36,9 @@ func TestEtcdOperation(t *testing.T) {
 
 	t.Logf("Version = %v", ipInfoCodec.Version())
 }
+
+func TestEtcdStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return NewEtcdStore(barrelEtcd.NewEmbedEtcd(t).Client())
+	})
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/projecteru2/barrel/metrics"
+)
+
+type instrumentedStore struct {
+	Store
+}
+
+// Instrument reports latency of store operations to metrics
+func Instrument(stor Store) Store {
+	return instrumentedStore{Store: stor}
+}
+
+// Get .
+func (s instrumentedStore) Get(ctx context.Context, codec Codec) (err error) {
+	defer observe("get", time.Now())(&err)
+	return s.Store.Get(ctx, codec)
+}
+
+// GetMulti .
+func (s instrumentedStore) GetMulti(ctx context.Context, codec MultiGetCodec) (err error) {
+	defer observe("get_multi", time.Now())(&err)
+	return s.Store.GetMulti(ctx, codec)
+}
+
+// Put .
+func (s instrumentedStore) Put(ctx context.Context, codec Codec) (err error) {
+	defer observe("put", time.Now())(&err)
+	return s.Store.Put(ctx, codec)
+}
+
+// PutWithTTL .
+func (s instrumentedStore) PutWithTTL(ctx context.Context, codec Codec, ttl time.Duration) (err error) {
+	defer observe("put_with_ttl", time.Now())(&err)
+	return s.Store.PutWithTTL(ctx, codec, ttl)
+}
+
+// Grant .
+func (s instrumentedStore) Grant(ctx context.Context, ttl time.Duration) (_ LeaseID, err error) {
+	defer observe("grant", time.Now())(&err)
+	return s.Store.Grant(ctx, ttl)
+}
+
+// PutWithLease .
+func (s instrumentedStore) PutWithLease(ctx context.Context, codec Codec, lease LeaseID) (err error) {
+	defer observe("put_with_lease", time.Now())(&err)
+	return s.Store.PutWithLease(ctx, codec, lease)
+}
+
+// Revoke .
+func (s instrumentedStore) Revoke(ctx context.Context, lease LeaseID) (err error) {
+	defer observe("revoke", time.Now())(&err)
+	return s.Store.Revoke(ctx, lease)
+}
+
+// Delete .
+func (s instrumentedStore) Delete(ctx context.Context, codec Codec) (err error) {
+	defer observe("delete", time.Now())(&err)
+	return s.Store.Delete(ctx, codec)
+}
+
+// GetAndDelete .
+func (s instrumentedStore) GetAndDelete(ctx context.Context, codec Codec) (err error) {
+	defer observe("get_and_delete", time.Now())(&err)
+	return s.Store.GetAndDelete(ctx, codec)
+}
+
+// DeleteElseGet .
+func (s instrumentedStore) DeleteElseGet(ctx context.Context, codec Codec) (_ bool, err error) {
+	defer observe("delete_else_get", time.Now())(&err)
+	return s.Store.DeleteElseGet(ctx, codec)
+}
+
+// UpdateElseGet .
+func (s instrumentedStore) UpdateElseGet(ctx context.Context, codec Codec) (_ bool, err error) {
+	defer observe("update_else_get", time.Now())(&err)
+	return s.Store.UpdateElseGet(ctx, codec)
+}
+
+// Update .
+func (s instrumentedStore) Update(ctx context.Context, codec UpdateCodec) (_ bool, err error) {
+	defer observe("update", time.Now())(&err)
+	return s.Store.Update(ctx, codec)
+}
+
+// PutMulti .
+func (s instrumentedStore) PutMulti(ctx context.Context, codecs ...Codec) (err error) {
+	defer observe("put_multi", time.Now())(&err)
+	return s.Store.PutMulti(ctx, codecs...)
+}
+
+// observe returns the func reporting the operation, KV not exists is not taken as failure
+func observe(operation string, start time.Time) func(*error) {
+	return func(errp *error) {
+		var err error
+		if ErrButOtherThenKVUnexistsErr(*errp) {
+			err = *errp
+		}
+		metrics.ObserveStoreOperation(operation, start, err)
+	}
+}
@@ -0,0 +1,400 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+
+	"github.com/projecteru2/barrel/store"
+)
+
+var (
+	errKeyIsBlank = errors.New("Key shouldn't be blank")
+	errNoOps      = errors.New("No ops")
+)
+
+type kv struct {
+	value   string
+	version int64
+	// zero means not attached to any lease
+	lease store.LeaseID
+}
+
+type lease struct {
+	ttl      time.Duration
+	expireAt time.Time
+}
+
+func (l lease) expired(now time.Time) bool {
+	return !now.Before(l.expireAt)
+}
+
+type memoryStore struct {
+	mutex     sync.Mutex
+	kvs       map[string]kv
+	leases    map[store.LeaseID]lease
+	nextLease store.LeaseID
+	hub       *store.WatchHub
+}
+
+// NewMemoryStore creates a goroutine-safe store keeping kvs in memory,
+// it follows the semantics of etcd store, versions of a key start from 1 and reset on delete
+func NewMemoryStore() store.Store {
+	return &memoryStore{
+		kvs:    make(map[string]kv),
+		leases: make(map[store.LeaseID]lease),
+		hub:    store.NewWatchHub(),
+	}
+}
+
+// getLease must be called with mutex held, expired leases are revoked lazily
+func (m *memoryStore) getLease(id store.LeaseID) (lease, bool) {
+	l, ok := m.leases[id]
+	if !ok {
+		return lease{}, false
+	}
+	if l.expired(time.Now()) {
+		m.revoke(id)
+		return lease{}, false
+	}
+	return l, true
+}
+
+// revoke must be called with mutex held
+func (m *memoryStore) revoke(id store.LeaseID) {
+	delete(m.leases, id)
+	for key, v := range m.kvs {
+		if v.lease == id {
+			m.delete(key)
+		}
+	}
+}
+
+// get must be called with mutex held, expired kvs are removed lazily
+func (m *memoryStore) get(key string) (kv, bool) {
+	v, ok := m.kvs[key]
+	if !ok {
+		return kv{}, false
+	}
+	if v.lease != 0 {
+		if _, ok := m.getLease(v.lease); !ok {
+			// deleted on revoking the lease
+			return kv{}, false
+		}
+	}
+	return v, true
+}
+
+// delete must be called with mutex held
+func (m *memoryStore) delete(key string) {
+	delete(m.kvs, key)
+	m.hub.Notify(store.WatchEvent{Type: store.EventTypeDelete, Key: key})
+}
+
+// put must be called with mutex held
+func (m *memoryStore) put(key string, value string, lease store.LeaseID) int64 {
+	prev, _ := m.get(key)
+	m.kvs[key] = kv{value: value, version: prev.version + 1, lease: lease}
+	m.hub.Notify(store.WatchEvent{Type: store.EventTypePut, Key: key, Value: value, Version: prev.version + 1})
+	return prev.version + 1
+}
+
+// Get .
+func (m *memoryStore) Get(ctx context.Context, codec store.Codec) error {
+	m.mutex.Lock()
+	v, ok := m.get(codec.Key())
+	m.mutex.Unlock()
+
+	if !ok {
+		return store.ErrKVNotExists
+	}
+	codec.SetVersion(v.version)
+	return codec.Decode(v.value)
+}
+
+// GetMulti decodes kvs in key order, as etcd does
+func (m *memoryStore) GetMulti(ctx context.Context, codec store.MultiGetCodec) error {
+	prefix := codec.Prefix()
+
+	m.mutex.Lock()
+	var keys []string
+	for key := range m.kvs {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	kvs := make([]kv, 0, len(keys))
+	for _, key := range keys {
+		if v, ok := m.get(key); ok {
+			kvs = append(kvs, v)
+		}
+	}
+	m.mutex.Unlock()
+
+	for _, v := range kvs {
+		codec.Decode(v.value, v.version)
+	}
+	return nil
+}
+
+// Put .
+func (m *memoryStore) Put(ctx context.Context, codec store.Codec) error {
+	return m.PutWithLease(ctx, codec, 0)
+}
+
+// PutWithTTL .
+func (m *memoryStore) PutWithTTL(ctx context.Context, codec store.Codec, ttl time.Duration) error {
+	if codec.Key() == "" {
+		return errKeyIsBlank
+	}
+	id, err := m.Grant(ctx, ttl)
+	if err != nil {
+		return err
+	}
+	return m.PutWithLease(ctx, codec, id)
+}
+
+// Grant .
+func (m *memoryStore) Grant(ctx context.Context, ttl time.Duration) (store.LeaseID, error) {
+	if ttl < store.MinLeaseTTL {
+		ttl = store.MinLeaseTTL
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.nextLease++
+	m.leases[m.nextLease] = lease{ttl: ttl, expireAt: time.Now().Add(ttl)}
+	return m.nextLease, nil
+}
+
+// KeepAlive .
+func (m *memoryStore) KeepAlive(ctx context.Context, id store.LeaseID) (<-chan struct{}, error) {
+	m.mutex.Lock()
+	l, ok := m.getLease(id)
+	m.mutex.Unlock()
+	if !ok {
+		return nil, store.ErrLeaseNotFound
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(l.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if !m.refresh(id) {
+				return
+			}
+		}
+	}()
+	return done, nil
+}
+
+func (m *memoryStore) refresh(id store.LeaseID) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	l, ok := m.getLease(id)
+	if !ok {
+		return false
+	}
+	l.expireAt = time.Now().Add(l.ttl)
+	m.leases[id] = l
+	return true
+}
+
+// Revoke .
+func (m *memoryStore) Revoke(ctx context.Context, id store.LeaseID) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.getLease(id); !ok {
+		return store.ErrLeaseNotFound
+	}
+	m.revoke(id)
+	return nil
+}
+
+// PutWithLease .
+func (m *memoryStore) PutWithLease(ctx context.Context, codec store.Codec, lease store.LeaseID) error {
+	var (
+		key = codec.Key()
+		val string
+		err error
+	)
+	if key == "" {
+		return errKeyIsBlank
+	}
+	if val, err = codec.Encode(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if lease != 0 {
+		if _, ok := m.getLease(lease); !ok {
+			return store.ErrLeaseNotFound
+		}
+	}
+	codec.SetVersion(m.put(key, val, lease))
+	return nil
+}
+
+// Delete .
+func (m *memoryStore) Delete(ctx context.Context, codec store.Codec) error {
+	key := codec.Key()
+	if key == "" {
+		return errKeyIsBlank
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.get(key); !ok {
+		return store.ErrKVNotExists
+	}
+	m.delete(key)
+	return nil
+}
+
+// GetAndDelete .
+func (m *memoryStore) GetAndDelete(ctx context.Context, codec store.Codec) error {
+	key := codec.Key()
+	if key == "" {
+		return errKeyIsBlank
+	}
+
+	m.mutex.Lock()
+	v, ok := m.get(key)
+	if ok {
+		m.delete(key)
+	}
+	m.mutex.Unlock()
+
+	if !ok {
+		return store.ErrKVNotExists
+	}
+	codec.SetVersion(0)
+	return codec.Decode(v.value)
+}
+
+// DeleteElseGet .
+func (m *memoryStore) DeleteElseGet(ctx context.Context, codec store.Codec) (bool, error) {
+	key := codec.Key()
+	if key == "" {
+		return false, errKeyIsBlank
+	}
+
+	m.mutex.Lock()
+	prev, ok := m.get(key)
+	if ok && prev.version == codec.Version() {
+		m.delete(key)
+		m.mutex.Unlock()
+
+		codec.SetVersion(0)
+		return true, nil
+	}
+	m.mutex.Unlock()
+
+	if !ok {
+		return false, store.ErrKVNotExists
+	}
+	codec.SetVersion(prev.version)
+	return false, codec.Decode(prev.value)
+}
+
+// UpdateElseGet .
+func (m *memoryStore) UpdateElseGet(ctx context.Context, codec store.Codec) (bool, error) {
+	var (
+		value string
+		err   error
+	)
+	if value, err = codec.Encode(); err != nil {
+		return false, err
+	}
+	key := codec.Key()
+
+	m.mutex.Lock()
+	prev, ok := m.get(key)
+	if prev.version == codec.Version() {
+		// etcd detaches the lease on put, so does the update here
+		version := m.put(key, value, 0)
+		m.mutex.Unlock()
+
+		codec.SetVersion(version)
+		return true, nil
+	}
+	m.mutex.Unlock()
+
+	if !ok {
+		return false, store.ErrKVNotExists
+	}
+	codec.SetVersion(prev.version)
+	return false, codec.Decode(prev.value)
+}
+
+// Update .
+func (m *memoryStore) Update(ctx context.Context, codec store.UpdateCodec) (bool, error) {
+	for {
+		var (
+			succeeded bool
+			err       error
+		)
+		if succeeded, err = m.UpdateElseGet(ctx, codec); err != nil {
+			return succeeded, err
+		}
+		if succeeded {
+			return true, nil
+		}
+		if !codec.Retry() {
+			return false, nil
+		}
+	}
+}
+
+// PutMulti puts all codecs at once
+func (m *memoryStore) PutMulti(ctx context.Context, codecs ...store.Codec) error {
+	data := make(map[string]string)
+	for _, encoder := range codecs {
+		var (
+			key = encoder.Key()
+			val string
+			err error
+		)
+		if key == "" {
+			return errKeyIsBlank
+		}
+		if val, err = encoder.Encode(); err != nil {
+			return err
+		}
+		data[key] = val
+	}
+	if len(data) == 0 {
+		return errNoOps
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for key, val := range data {
+		m.put(key, val, 0)
+	}
+	return nil
+}
+
+// Watch .
+func (m *memoryStore) Watch(ctx context.Context, prefix string) <-chan store.WatchEvent {
+	return m.hub.Watch(ctx, prefix)
+}
@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/projecteru2/barrel/store"
+	"github.com/projecteru2/barrel/store/storetest"
+)
+
+func TestMemoryStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return NewMemoryStore()
+	})
+}
@@ -4,6 +4,7 @@ package mocks
 
 import (
 	context "context"
+	time "time"
 
 	store "github.com/projecteru2/barrel/store"
 	mock "github.com/stretchr/testify/mock"
@@ -42,6 +43,27 @@ func (_m *Store) Delete(ctx context.Context, codec store.Codec) error {
 	return r0
 }
 
+// DeleteElseGet provides a mock function with given fields: ctx, codec
+func (_m *Store) DeleteElseGet(ctx context.Context, codec store.Codec) (bool, error) {
+	ret := _m.Called(ctx, codec)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context, store.Codec) bool); ok {
+		r0 = rf(ctx, codec)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, store.Codec) error); ok {
+		r1 = rf(ctx, codec)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Get provides a mock function with given fields: ctx, codec
 func (_m *Store) Get(ctx context.Context, codec store.Codec) error {
 	ret := _m.Called(ctx, codec)
@@ -70,6 +92,50 @@ func (_m *Store) GetAndDelete(ctx context.Context, codec store.Codec) error {
 	return r0
 }
 
+// Grant provides a mock function with given fields: ctx, ttl
+func (_m *Store) Grant(ctx context.Context, ttl time.Duration) (store.LeaseID, error) {
+	ret := _m.Called(ctx, ttl)
+
+	var r0 store.LeaseID
+	if rf, ok := ret.Get(0).(func(context.Context, time.Duration) store.LeaseID); ok {
+		r0 = rf(ctx, ttl)
+	} else {
+		r0 = ret.Get(0).(store.LeaseID)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Duration) error); ok {
+		r1 = rf(ctx, ttl)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// KeepAlive provides a mock function with given fields: ctx, lease
+func (_m *Store) KeepAlive(ctx context.Context, lease store.LeaseID) (<-chan struct{}, error) {
+	ret := _m.Called(ctx, lease)
+
+	var r0 <-chan struct{}
+	if rf, ok := ret.Get(0).(func(context.Context, store.LeaseID) <-chan struct{}); ok {
+		r0 = rf(ctx, lease)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(<-chan struct{})
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, store.LeaseID) error); ok {
+		r1 = rf(ctx, lease)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Put provides a mock function with given fields: ctx, codec
 func (_m *Store) Put(ctx context.Context, codec store.Codec) error {
 	ret := _m.Called(ctx, codec)
@@ -105,6 +171,48 @@ func (_m *Store) PutMulti(ctx context.Context, codec ...store.Codec) error {
 	return r0
 }
 
+// PutWithLease provides a mock function with given fields: ctx, codec, lease
+func (_m *Store) PutWithLease(ctx context.Context, codec store.Codec, lease store.LeaseID) error {
+	ret := _m.Called(ctx, codec, lease)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, store.Codec, store.LeaseID) error); ok {
+		r0 = rf(ctx, codec, lease)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// PutWithTTL provides a mock function with given fields: ctx, codec, ttl
+func (_m *Store) PutWithTTL(ctx context.Context, codec store.Codec, ttl time.Duration) error {
+	ret := _m.Called(ctx, codec, ttl)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, store.Codec, time.Duration) error); ok {
+		r0 = rf(ctx, codec, ttl)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Revoke provides a mock function with given fields: ctx, lease
+func (_m *Store) Revoke(ctx context.Context, lease store.LeaseID) error {
+	ret := _m.Called(ctx, lease)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, store.LeaseID) error); ok {
+		r0 = rf(ctx, lease)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // Update provides a mock function with given fields: ctx, codec
 func (_m *Store) Update(ctx context.Context, codec store.UpdateCodec) (bool, error) {
 	ret := _m.Called(ctx, codec)
@@ -146,3 +254,19 @@ func (_m *Store) UpdateElseGet(ctx context.Context, codec store.Codec) (bool, er
 
 	return r0, r1
 }
+
+// Watch provides a mock function with given fields: ctx, prefix
+func (_m *Store) Watch(ctx context.Context, prefix string) <-chan store.WatchEvent {
+	ret := _m.Called(ctx, prefix)
+
+	var r0 <-chan store.WatchEvent
+	if rf, ok := ret.Get(0).(func(context.Context, string) <-chan store.WatchEvent); ok {
+		r0 = rf(ctx, prefix)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(<-chan store.WatchEvent)
+		}
+	}
+
+	return r0
+}
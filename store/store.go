@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"time"
 
 	"github.com/juju/errors"
 )
@@ -12,8 +13,17 @@ var (
 
 	// ErrUnexpectedTxnResp .
 	ErrUnexpectedTxnResp = errors.New("unexpected txn resp")
+
+	// ErrLeaseNotFound .
+	ErrLeaseNotFound = errors.New("lease not found")
 )
 
+// LeaseID identifies a lease, keys attached to a lease are deleted when it expires or is revoked
+type LeaseID int64
+
+// MinLeaseTTL is the minimal ttl of leases, shorter ttls are rounded up to it
+const MinLeaseTTL = time.Second
+
 // IsNotExists .
 func IsNotExists(err error) bool {
 	return err == ErrKVNotExists
@@ -50,9 +60,23 @@ type Store interface {
 	Get(ctx context.Context, codec Codec) error
 	GetMulti(ctx context.Context, codec MultiGetCodec) error
 	Put(ctx context.Context, codec Codec) error
+	// PutWithTTL grants a lease of ttl and attaches codec to it
+	PutWithTTL(ctx context.Context, codec Codec, ttl time.Duration) error
+	Grant(ctx context.Context, ttl time.Duration) (LeaseID, error)
+	PutWithLease(ctx context.Context, codec Codec, lease LeaseID) error
+	// KeepAlive refreshes the lease until ctx is done, the returned channel is closed
+	// when the lease is no longer kept alive, either ctx is done or the lease is lost
+	KeepAlive(ctx context.Context, lease LeaseID) (<-chan struct{}, error)
+	// Revoke revokes the lease and deletes keys attached to it
+	Revoke(ctx context.Context, lease LeaseID) error
 	Delete(ctx context.Context, codec Codec) error
 	GetAndDelete(ctx context.Context, codec Codec) error
+	// DeleteElseGet deletes the key when its version matches codec, otherwise gets the current kv as UpdateElseGet does
+	DeleteElseGet(ctx context.Context, codec Codec) (bool, error)
+	// UpdateElseGet puts codec when its version matches, the key is detached from its lease as etcd does
 	UpdateElseGet(ctx context.Context, codec Codec) (bool, error)
 	Update(ctx context.Context, codec UpdateCodec) (bool, error)
 	PutMulti(ctx context.Context, codec ...Codec) error
+	// Watch yields changes of keys with the prefix made since called, the channel is closed when ctx is done
+	Watch(ctx context.Context, prefix string) <-chan WatchEvent
 }
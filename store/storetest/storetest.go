@@ -0,0 +1,426 @@
+// Package storetest provides the conformance suite every store.Store implementation must pass
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/projecteru2/barrel/store"
+)
+
+type testCodec struct {
+	key     string
+	value   string
+	version int64
+	retry   func() bool
+}
+
+func newTestCodec(key string, value string) *testCodec {
+	return &testCodec{key: key, value: value}
+}
+
+func (codec *testCodec) Key() string {
+	return codec.key
+}
+
+func (codec *testCodec) Encode() (string, error) {
+	return codec.value, nil
+}
+
+func (codec *testCodec) Decode(input string) error {
+	codec.value = input
+	return nil
+}
+
+func (codec *testCodec) Version() int64 {
+	return codec.version
+}
+
+func (codec *testCodec) SetVersion(version int64) {
+	codec.version = version
+}
+
+func (codec *testCodec) Retry() bool {
+	if codec.retry == nil {
+		return false
+	}
+	return codec.retry()
+}
+
+type testMultiGetCodec struct {
+	prefix   string
+	values   []string
+	versions []int64
+}
+
+func (codec *testMultiGetCodec) Prefix() string {
+	return codec.prefix
+}
+
+func (codec *testMultiGetCodec) Decode(value string, version int64) {
+	codec.values = append(codec.values, value)
+	codec.versions = append(codec.versions, version)
+}
+
+// Run runs the conformance suite, newStore shall return an empty store for each case
+func Run(t *testing.T, newStore func(t *testing.T) store.Store) {
+	cases := []struct {
+		name string
+		test func(*testing.T, store.Store)
+	}{
+		{"GetPut", testGetPut},
+		{"GetMulti", testGetMulti},
+		{"PutWithTTL", testPutWithTTL},
+		{"Lease", testLease},
+		{"KeepAlive", testKeepAlive},
+		{"Delete", testDelete},
+		{"GetAndDelete", testGetAndDelete},
+		{"DeleteElseGet", testDeleteElseGet},
+		{"UpdateElseGet", testUpdateElseGet},
+		{"UpdateElseGetConcurrently", testUpdateElseGetConcurrently},
+		{"Update", testUpdate},
+		{"PutMulti", testPutMulti},
+		{"Watch", testWatch},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			c.test(t, newStore(t))
+		})
+	}
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(10)*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func testGetPut(t *testing.T, stor store.Store) {
+	ctx := testContext(t)
+
+	codec := newTestCodec("/test/key", "")
+	assert.Equal(t, store.ErrKVNotExists, stor.Get(ctx, codec))
+	assert.Error(t, stor.Put(ctx, newTestCodec("", "value")))
+
+	codec = newTestCodec("/test/key", "value1")
+	assert.NoError(t, stor.Put(ctx, codec))
+	assert.Equal(t, int64(1), codec.Version())
+	codec = newTestCodec("/test/key", "value2")
+	assert.NoError(t, stor.Put(ctx, codec))
+	assert.Equal(t, int64(2), codec.Version())
+
+	codec = newTestCodec("/test/key", "")
+	assert.NoError(t, stor.Get(ctx, codec))
+	assert.Equal(t, "value2", codec.value)
+	assert.Equal(t, int64(2), codec.Version())
+}
+
+func testGetMulti(t *testing.T, stor store.Store) {
+	ctx := testContext(t)
+
+	assert.NoError(t, stor.Put(ctx, newTestCodec("/test/prefix/b", "b")))
+	assert.NoError(t, stor.Put(ctx, newTestCodec("/test/prefix/a", "a")))
+	assert.NoError(t, stor.Put(ctx, newTestCodec("/test/prefix/a", "a")))
+	assert.NoError(t, stor.Put(ctx, newTestCodec("/test/other/c", "c")))
+
+	codec := &testMultiGetCodec{prefix: "/test/prefix/"}
+	assert.NoError(t, stor.GetMulti(ctx, codec))
+	assert.Equal(t, []string{"a", "b"}, codec.values)
+	assert.Equal(t, []int64{2, 1}, codec.versions)
+
+	codec = &testMultiGetCodec{prefix: "/test/none/"}
+	assert.NoError(t, stor.GetMulti(ctx, codec))
+	assert.Empty(t, codec.values)
+}
+
+func testPutWithTTL(t *testing.T, stor store.Store) {
+	ctx := testContext(t)
+
+	codec := newTestCodec("/test/ttl", "value")
+	assert.NoError(t, stor.PutWithTTL(ctx, codec, time.Second))
+	assert.Equal(t, int64(1), codec.Version())
+	assert.NoError(t, stor.Get(ctx, newTestCodec("/test/ttl", "")))
+
+	assert.Eventually(t, func() bool {
+		return stor.Get(ctx, newTestCodec("/test/ttl", "")) == store.ErrKVNotExists
+	}, time.Duration(8)*time.Second, 100*time.Millisecond)
+}
+
+func testLease(t *testing.T, stor store.Store) {
+	ctx := testContext(t)
+
+	assert.Equal(t, store.ErrLeaseNotFound, stor.PutWithLease(ctx, newTestCodec("/test/lease/unknown", "value"), store.LeaseID(12345)))
+
+	lease, err := stor.Grant(ctx, time.Hour)
+	assert.NoError(t, err)
+	assert.NoError(t, stor.PutWithLease(ctx, newTestCodec("/test/lease/1", "value"), lease))
+	assert.NoError(t, stor.PutWithLease(ctx, newTestCodec("/test/lease/2", "value"), lease))
+	assert.NoError(t, stor.Put(ctx, newTestCodec("/test/lease/3", "value")))
+
+	assert.NoError(t, stor.Revoke(ctx, lease))
+	assert.Equal(t, store.ErrKVNotExists, stor.Get(ctx, newTestCodec("/test/lease/1", "")))
+	assert.Equal(t, store.ErrKVNotExists, stor.Get(ctx, newTestCodec("/test/lease/2", "")))
+	assert.NoError(t, stor.Get(ctx, newTestCodec("/test/lease/3", "")))
+
+	assert.Equal(t, store.ErrLeaseNotFound, stor.Revoke(ctx, lease))
+	assert.Equal(t, store.ErrLeaseNotFound, stor.PutWithLease(ctx, newTestCodec("/test/lease/1", "value"), lease))
+}
+
+func testKeepAlive(t *testing.T, stor store.Store) {
+	ctx := testContext(t)
+
+	// etcd rounds ttls up to its minimal lease ttl, which is 2s for the embed etcd
+	ttl := 2 * time.Second
+	lease, err := stor.Grant(ctx, ttl)
+	assert.NoError(t, err)
+	assert.NoError(t, stor.PutWithLease(ctx, newTestCodec("/test/alive", "value"), lease))
+
+	keepAliveCtx, cancel := context.WithCancel(ctx)
+	done, err := stor.KeepAlive(keepAliveCtx, lease)
+	assert.NoError(t, err)
+
+	time.Sleep(ttl + time.Second)
+	assert.NoError(t, stor.Get(ctx, newTestCodec("/test/alive", "")))
+
+	cancel()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("keep alive isn't stopped after ctx is canceled")
+	}
+	assert.Eventually(t, func() bool {
+		return stor.Get(ctx, newTestCodec("/test/alive", "")) == store.ErrKVNotExists
+	}, time.Duration(5)*time.Second, 100*time.Millisecond)
+
+	_, err = stor.KeepAlive(ctx, lease)
+	assert.Equal(t, store.ErrLeaseNotFound, err)
+}
+
+func testDelete(t *testing.T, stor store.Store) {
+	ctx := testContext(t)
+
+	assert.Equal(t, store.ErrKVNotExists, stor.Delete(ctx, newTestCodec("/test/key", "")))
+	assert.NoError(t, stor.Put(ctx, newTestCodec("/test/key", "value")))
+	assert.NoError(t, stor.Delete(ctx, newTestCodec("/test/key", "")))
+	assert.Equal(t, store.ErrKVNotExists, stor.Get(ctx, newTestCodec("/test/key", "")))
+
+	// version restarts after the key is deleted
+	codec := newTestCodec("/test/key", "value")
+	assert.NoError(t, stor.Put(ctx, codec))
+	assert.Equal(t, int64(1), codec.Version())
+}
+
+func testGetAndDelete(t *testing.T, stor store.Store) {
+	ctx := testContext(t)
+
+	assert.Equal(t, store.ErrKVNotExists, stor.GetAndDelete(ctx, newTestCodec("/test/key", "")))
+	assert.NoError(t, stor.Put(ctx, newTestCodec("/test/key", "value")))
+
+	var (
+		wg      sync.WaitGroup
+		mutex   sync.Mutex
+		deleted []*testCodec
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codec := newTestCodec("/test/key", "")
+			if err := stor.GetAndDelete(ctx, codec); err == nil {
+				mutex.Lock()
+				deleted = append(deleted, codec)
+				mutex.Unlock()
+			} else {
+				assert.Equal(t, store.ErrKVNotExists, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// only one of the concurrent callers gets the value
+	assert.Equal(t, 1, len(deleted))
+	assert.Equal(t, "value", deleted[0].value)
+	assert.Equal(t, int64(0), deleted[0].Version())
+	assert.Equal(t, store.ErrKVNotExists, stor.Get(ctx, newTestCodec("/test/key", "")))
+}
+
+func testDeleteElseGet(t *testing.T, stor store.Store) {
+	ctx := testContext(t)
+
+	codec := newTestCodec("/test/key", "value1")
+	assert.NoError(t, stor.Put(ctx, codec))
+	codec.value = "value2"
+	assert.NoError(t, stor.Put(ctx, codec))
+
+	// stale version gets the current kv, the key is kept
+	stale := newTestCodec("/test/key", "")
+	stale.SetVersion(1)
+	ok, err := stor.DeleteElseGet(ctx, stale)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, "value2", stale.value)
+	assert.Equal(t, int64(2), stale.Version())
+
+	ok, err = stor.DeleteElseGet(ctx, stale)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, store.ErrKVNotExists, stor.Get(ctx, newTestCodec("/test/key", "")))
+
+	// the key is gone, version 0 doesn't match the absent key either
+	ok, err = stor.DeleteElseGet(ctx, newTestCodec("/test/key", ""))
+	assert.Equal(t, store.ErrKVNotExists, err)
+	assert.False(t, ok)
+}
+
+func testUpdateElseGet(t *testing.T, stor store.Store) {
+	ctx := testContext(t)
+
+	// version 0 creates the key
+	codec := newTestCodec("/test/key", "value1")
+	ok, err := stor.UpdateElseGet(ctx, codec)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), codec.Version())
+
+	codec.value = "value2"
+	ok, err = stor.UpdateElseGet(ctx, codec)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), codec.Version())
+
+	// stale version gets the current kv
+	stale := newTestCodec("/test/key", "stale")
+	stale.SetVersion(1)
+	ok, err = stor.UpdateElseGet(ctx, stale)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, "value2", stale.value)
+	assert.Equal(t, int64(2), stale.Version())
+
+	// the key is gone
+	missing := newTestCodec("/test/missing", "value")
+	missing.SetVersion(1)
+	ok, err = stor.UpdateElseGet(ctx, missing)
+	assert.Equal(t, store.ErrKVNotExists, err)
+	assert.False(t, ok)
+}
+
+func testUpdateElseGetConcurrently(t *testing.T, stor store.Store) {
+	ctx := testContext(t)
+
+	assert.NoError(t, stor.Put(ctx, newTestCodec("/test/counter", "0")))
+
+	const workers = 8
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codec := newTestCodec("/test/counter", "")
+			if !assert.NoError(t, stor.Get(ctx, codec)) {
+				return
+			}
+			for {
+				var count int
+				fmt.Sscanf(codec.value, "%d", &count)
+				codec.value = fmt.Sprintf("%d", count+1)
+				ok, err := stor.UpdateElseGet(ctx, codec)
+				if !assert.NoError(t, err) || ok {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	codec := newTestCodec("/test/counter", "")
+	assert.NoError(t, stor.Get(ctx, codec))
+	assert.Equal(t, fmt.Sprintf("%d", workers), codec.value)
+	assert.Equal(t, int64(workers+1), codec.Version())
+}
+
+func testUpdate(t *testing.T, stor store.Store) {
+	ctx := testContext(t)
+
+	assert.NoError(t, stor.Put(ctx, newTestCodec("/test/key", "value1")))
+
+	// no retry on conflict
+	codec := newTestCodec("/test/key", "value2")
+	codec.SetVersion(0)
+	ok, err := stor.Update(ctx, codec)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, "value1", codec.value)
+
+	// retry with the fetched version
+	codec = newTestCodec("/test/key", "value2")
+	retries := 0
+	codec.retry = func() bool {
+		retries++
+		codec.value = "value2"
+		return true
+	}
+	ok, err = stor.Update(ctx, codec)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 1, retries)
+	assert.Equal(t, int64(2), codec.Version())
+}
+
+func testPutMulti(t *testing.T, stor store.Store) {
+	ctx := testContext(t)
+
+	assert.Error(t, stor.PutMulti(ctx))
+	// a blank key fails the whole batch
+	assert.Error(t, stor.PutMulti(ctx, newTestCodec("/test/multi/a", "a"), newTestCodec("", "blank")))
+	assert.Equal(t, store.ErrKVNotExists, stor.Get(ctx, newTestCodec("/test/multi/a", "")))
+
+	assert.NoError(t, stor.PutMulti(ctx, newTestCodec("/test/multi/a", "a"), newTestCodec("/test/multi/b", "b")))
+	codec := &testMultiGetCodec{prefix: "/test/multi/"}
+	assert.NoError(t, stor.GetMulti(ctx, codec))
+	assert.Equal(t, []string{"a", "b"}, codec.values)
+}
+
+func testWatch(t *testing.T, stor store.Store) {
+	ctx := testContext(t)
+	watchCtx, cancel := context.WithCancel(ctx)
+	ch := stor.Watch(watchCtx, "/test/watch/")
+
+	codec := newTestCodec("/test/watch/a", "value1")
+	assert.NoError(t, stor.Put(ctx, codec))
+	assert.NoError(t, stor.Put(ctx, newTestCodec("/test/other/a", "other")))
+	codec.value = "value2"
+	_, err := stor.UpdateElseGet(ctx, codec)
+	assert.NoError(t, err)
+	assert.NoError(t, stor.Delete(ctx, codec))
+
+	expected := []store.WatchEvent{
+		{Type: store.EventTypePut, Key: "/test/watch/a", Value: "value1", Version: 1},
+		{Type: store.EventTypePut, Key: "/test/watch/a", Value: "value2", Version: 2},
+		{Type: store.EventTypeDelete, Key: "/test/watch/a"},
+	}
+	for _, e := range expected {
+		select {
+		case event := <-ch:
+			assert.Equal(t, e, event)
+		case <-time.After(time.Duration(5) * time.Second):
+			t.Fatalf("event %v is not observed", e)
+		}
+	}
+
+	cancel()
+	assert.Eventually(t, func() bool {
+		select {
+		case _, ok := <-ch:
+			return !ok
+		default:
+			return false
+		}
+	}, time.Duration(5)*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,139 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// EventType .
+type EventType int
+
+const (
+	// EventTypePut means the key is created or modified
+	EventTypePut EventType = iota
+	// EventTypeDelete means the key is deleted or expired
+	EventTypeDelete
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventTypePut:
+		return "put"
+	case EventTypeDelete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+// WatchEvent is a change of a key, Value is blank and Version is 0 on delete.
+// An event carrying Err means the watch is broken, the channel is closed after it
+type WatchEvent struct {
+	Type    EventType
+	Key     string
+	Value   string
+	Version int64
+	Err     error
+}
+
+// Decode decodes value of the event into codec
+func (event WatchEvent) Decode(codec Codec) error {
+	codec.SetVersion(event.Version)
+	return codec.Decode(event.Value)
+}
+
+// WatchHub fans out events to watchers, for stores without native watch.
+// Notify never blocks, events are queued for slow watchers
+type WatchHub struct {
+	mutex    sync.Mutex
+	watchers map[*watcher]struct{}
+}
+
+type watcher struct {
+	prefix string
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	queue  []WatchEvent
+	done   bool
+}
+
+// NewWatchHub .
+func NewWatchHub() *WatchHub {
+	return &WatchHub{watchers: make(map[*watcher]struct{})}
+}
+
+// Watch returns events of keys with the prefix until ctx is done
+func (hub *WatchHub) Watch(ctx context.Context, prefix string) <-chan WatchEvent {
+	w := &watcher{prefix: prefix}
+	w.cond = sync.NewCond(&w.mutex)
+
+	hub.mutex.Lock()
+	hub.watchers[w] = struct{}{}
+	hub.mutex.Unlock()
+
+	ch := make(chan WatchEvent)
+	go func() {
+		<-ctx.Done()
+		hub.mutex.Lock()
+		delete(hub.watchers, w)
+		hub.mutex.Unlock()
+
+		w.mutex.Lock()
+		w.done = true
+		w.cond.Broadcast()
+		w.mutex.Unlock()
+	}()
+	go func() {
+		defer close(ch)
+		for {
+			event, ok := w.pop()
+			if !ok {
+				return
+			}
+			select {
+			case ch <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// Notify delivers events to watchers of matched prefixes
+func (hub *WatchHub) Notify(events ...WatchEvent) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	for w := range hub.watchers {
+		w.push(events)
+	}
+}
+
+func (w *watcher) push(events []WatchEvent) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for _, event := range events {
+		if strings.HasPrefix(event.Key, w.prefix) {
+			w.queue = append(w.queue, event)
+		}
+	}
+	w.cond.Broadcast()
+}
+
+func (w *watcher) pop() (WatchEvent, bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for len(w.queue) == 0 && !w.done {
+		w.cond.Wait()
+	}
+	if w.done {
+		return WatchEvent{}, false
+	}
+	event := w.queue[0]
+	w.queue = w.queue[1:]
+	return event, true
+}
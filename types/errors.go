@@ -33,6 +33,10 @@ var (
 	ErrFixedIPNotAllocated = errors.New("fixed-ip not allocated")
 	// ErrFixedIPHasBorrower .
 	ErrFixedIPHasBorrower = errors.New("fixed-ip has borrower")
+	// ErrFixedIPKeyInUse .
+	ErrFixedIPKeyInUse = errors.New("fixed-ip of the key is borrowed by another container")
+	// ErrFixedIPReserved .
+	ErrFixedIPReserved = errors.New("fixed-ip is reserved for return of its owner")
 	// ErrMaxRetryCountExceeded .
 	ErrMaxRetryCountExceeded = errors.New("max retry count exceeded")
 )
@@ -24,6 +24,11 @@ type IPInfo struct {
 // IPAttributes .
 type IPAttributes struct {
 	Borrowers []Container
+	// identity of the owner the released ip is reserved for, as the owner of FixedIPRetention
+	ReservedFor string `json:",omitempty"`
+	// identity of the unalloc which retired the ip, it tells retirements apart
+	// as the version of the record starts over once the record is recreated
+	RetiredBy string `json:",omitempty"`
 }
 
 const (
@@ -31,6 +36,10 @@ const (
 	IPStatusInUse BitStatus = 1 << iota
 	// IPStatusRetired .
 	IPStatusRetired
+	// IPStatusReserved the ip is released and reserved for return of its owner
+	IPStatusReserved
+	// IPStatusPending the ip is requested by a container creating, and not borrowed yet
+	IPStatusPending
 )
 
 // Container .
@@ -42,8 +51,77 @@ type Container struct {
 // ContainerInfo .
 type ContainerInfo struct {
 	Container
+	// name of the container, used as the owner identity of retained fixed ips
+	Name      string `json:",omitempty"`
 	Networks  []Network
 	Addresses []IP
+	// addresses are bound to the key, so they are kept after container removed
+	FixedIPKey string `json:",omitempty"`
+}
+
+// FixedIPKey binds fixed ips of a network to a logical identity
+type FixedIPKey struct {
+	Network   string
+	Key       string
+	Addresses []IP
+}
+
+// FixedIPRetention keeps a released fixed ip for its owner until expired,
+// the owner is the container name scoped by host
+type FixedIPRetention struct {
+	Owner string
+	IP
+}
+
+// FixedIPReservation holds a fixed ip for a container creating until the container is recorded,
+// it's attached to a lease, so the fixed ip is swept when barrel crashes before dockerd answers
+type FixedIPReservation struct {
+	HostName string
+	IP
+}
+
+// HostLiveness is kept alive by barrel of the host, it disappears soon after barrel is gone
+type HostLiveness struct {
+	HostName  string `json:"-"`
+	StartedAt int64
+}
+
+// Leader is the host doing cluster-wide jobs of the role, the lead is taken over when the host isn't alive
+type Leader struct {
+	Role     string `json:"-"`
+	HostName string
+}
+
+// IntentOperation .
+type IntentOperation string
+
+const (
+	// IntentCreateFixedIP allocates the ip in calico, then creates the fixed ip record
+	IntentCreateFixedIP IntentOperation = "create-fixed-ip"
+	// IntentUnallocFixedIP retires and deletes the fixed ip record, then unallocs the ip in calico
+	IntentUnallocFixedIP IntentOperation = "unalloc-fixed-ip"
+)
+
+// IntentStep is the progress of an intent
+type IntentStep string
+
+const (
+	// IntentStepCalicoAllocated the ip is allocated in calico
+	IntentStepCalicoAllocated IntentStep = "calico-allocated"
+	// IntentStepRecordDeleted the fixed ip record is locked and being deleted, it's recorded ahead of the delete
+	IntentStepRecordDeleted IntentStep = "record-deleted"
+)
+
+// Intent is journaled before a multi-step fixed ip operation and removed after the operation finished,
+// intents left by a crash are replayed or rolled back on start
+type Intent struct {
+	ID        string
+	HostName  string
+	Operation IntentOperation
+	Step      IntentStep `json:",omitempty"`
+	// blank until allocated when the ip is auto assigned
+	IP        IP
+	CreatedAt int64
 }
 
 // Network .
@@ -52,3 +130,9 @@ type Network struct {
 	EndpointID string
 	Address    IP
 }
+
+// EventCursor records the last handled docker event of host
+type EventCursor struct {
+	HostName string `json:"-"`
+	TimeNano int64
+}
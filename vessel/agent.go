@@ -42,24 +42,45 @@ type networkAgent struct {
 	notifier        notifier
 }
 
+const (
+	defaultMinPollInterval = time.Second
+	defaultPollInterval    = 30 * time.Second
+	defaultPollTimeout     = 30 * time.Second
+)
+
 // NewAgent .
-func NewAgent(vess Vessel, config AgentConfig) interface {
+func NewAgent(vess Vessel, dockerCli docker.Client, config AgentConfig) interface {
 	CNMAgent
 	service.Service
 } {
-	return &networkAgent{
+	agent := &networkAgent{
+		hostname:        config.HostName,
 		pollers:         newPollers(),
 		vess:            vess,
+		dockerClient:    dockerCli,
 		minPollInterval: config.MinInterval,
 		pollInterval:    config.PollInterval,
 		pollTimeout:     config.PollTimeout,
 		notifier:        notifier{},
 	}
+	if agent.hostname == "" {
+		agent.hostname = vess.Hostname()
+	}
+	if agent.minPollInterval <= 0 {
+		agent.minPollInterval = defaultMinPollInterval
+	}
+	if agent.pollInterval <= 0 {
+		agent.pollInterval = defaultPollInterval
+	}
+	if agent.pollTimeout <= 0 {
+		agent.pollTimeout = defaultPollTimeout
+	}
+	return agent
 }
 
 func (agent *networkAgent) Serve(ctx context.Context) (service.Disposable, error) {
 	logger := agent.logger("Serve")
-	agent.chErr = make(chan error)
+	agent.chErr = make(chan error, 1)
 	agent.serve()
 
 	select {
@@ -85,19 +106,16 @@ func (agent *networkAgent) serve() {
 				return
 			}
 			if agent.closed.Get() {
-				logger.Info("interval closed, waiting for polling signal")
-				ch := make(chan int)
-				agent.notifier.wait(ch)
-				agent.notifier.cancel(ch)
-				close(ch)
-				<-ch
-				continue
+				logger.Info("agent closed, polling end")
+				return
 			}
 			agent.next()
 		}
 	}()
 }
 
+// next waits for the next polling, pending pollers wait for endpoints shown in docker,
+// which isn't observable from the store, so they're polled every minPollInterval
 func (agent *networkAgent) next() {
 	logger := agent.logger("next")
 	logger.Info("waiting for next polling signal")
@@ -108,10 +126,9 @@ func (agent *networkAgent) next() {
 	}
 
 	logger.Info("make ch")
-	ch := make(chan int)
+	ch := make(chan int, 1)
 	agent.notifier.wait(ch)
 	defer agent.notifier.cancel(ch)
-	defer close(ch)
 
 	select {
 	case <-time.After(agent.pollInterval):
@@ -125,6 +142,8 @@ func (agent *networkAgent) Dispose(ctx context.Context) error {
 	logger := agent.logger("Dispose")
 	logger.Info("Disposeing")
 	agent.closed.Set(true)
+	// wake up the polling loop so it can exit
+	agent.notifier.send(0)
 	return nil
 }
 
@@ -507,8 +526,10 @@ func (n *notifier) wait(ch chan<- int) {
 
 	if n.hasSig {
 		n.hasSig = false
+		// sig may be overwritten by send once the lock is released
+		sig := n.sig
 		go func() {
-			ch <- n.sig
+			ch <- sig
 		}()
 		return
 	}
@@ -540,7 +561,7 @@ func (n *notifier) remove(ch chan<- int) {
 	for idx, c := range n.chs {
 		if c == ch {
 			n.chs[idx] = n.chs[lastIdx]
-			n.chs = n.chs[:lastIdx-1]
+			n.chs = n.chs[:lastIdx]
 			return
 		}
 	}
@@ -573,7 +594,11 @@ func (n *notifier) send(sig int) {
 
 	logger.Infof("subscriber size = %v", len(n.chs))
 	for _, c := range n.chs {
-		c <- sig
+		// subscribers' channels are buffered, never block while holding the lock
+		select {
+		case c <- sig:
+		default:
+		}
 	}
 	n.chs = n.chs[:0]
 }
@@ -6,7 +6,10 @@ import (
 
 	"github.com/juju/errors"
 	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
+	bapi "github.com/projectcalico/libcalico-go/lib/backend/api"
+	"github.com/projectcalico/libcalico-go/lib/backend/model"
 	"github.com/projectcalico/libcalico-go/lib/clientv3"
+	cerrors "github.com/projectcalico/libcalico-go/lib/errors"
 	calicoipam "github.com/projectcalico/libcalico-go/lib/ipam"
 	caliconet "github.com/projectcalico/libcalico-go/lib/net"
 	"github.com/projectcalico/libcalico-go/lib/options"
@@ -21,6 +24,9 @@ const addressAny = "::/0"
 // CalicoIPPool .
 type CalicoIPPool interface {
 	UnallocIP(ctx context.Context, ip types.IP) error
+	// UnallocIPByHandle unallocs ips allocated with the handle, see WithIPHandle
+	UnallocIPByHandle(ctx context.Context, handle string) error
+	IsIPAllocated(ctx context.Context, ip types.IP) (bool, error)
 	GetPoolByID(ctx context.Context, poolID string) (types.Pool, error)
 	GetPoolByCIDR(ctx context.Context, cidr string) (types.Pool, error)
 	GetPoolsByCIDRS(ctx context.Context, cidr []string) ([]types.Pool, error)
@@ -34,6 +40,21 @@ type CalicoIPAllocator interface {
 	AllocIPFromPools(ctx context.Context, pools []types.Pool) (types.IPAddress, error)
 	CalicoIPPool
 }
+type ipHandleKey struct{}
+
+// WithIPHandle returns a context with which ips are allocated in calico with the handle,
+// so they can be unalloced by the handle, without touching ips allocated by others
+func WithIPHandle(ctx context.Context, handle string) context.Context {
+	return context.WithValue(ctx, ipHandleKey{}, handle)
+}
+
+func ipHandle(ctx context.Context) *string {
+	if handle, ok := ctx.Value(ipHandleKey{}).(string); ok && handle != "" {
+		return &handle
+	}
+	return nil
+}
+
 type calicoIPPoolmanager struct {
 	cliv3 clientv3.Interface
 	utils.LoggerFactory
@@ -75,6 +96,7 @@ func (m calicoIPAllocator) AllocIP(ctx context.Context, ip types.IP) error {
 	ipArgs := calicoipam.AssignIPArgs{
 		IP:       caliconet.IP{IP: netIP},
 		Hostname: m.hostname,
+		HandleID: ipHandle(ctx),
 	}
 
 	if err = m.cliv3.IPAM().AssignIP(ctx, ipArgs); err != nil {
@@ -144,6 +166,7 @@ func (m calicoIPAllocator) AllocIPFromPool(ctx context.Context, poolID string) (
 			Hostname:  m.hostname,
 			IPv4Pools: poolV4,
 			IPv6Pools: poolV6,
+			HandleID:  ipHandle(ctx),
 		},
 	); err != nil {
 		log.Errorln("IP assignment error")
@@ -227,6 +250,75 @@ func (m calicoIPPoolmanager) UnallocIP(ctx context.Context, ip types.IP) error {
 	return nil
 }
 
+// UnallocIPByHandle .
+func (m calicoIPPoolmanager) UnallocIPByHandle(ctx context.Context, handle string) error {
+	if err := m.cliv3.IPAM().ReleaseByHandle(ctx, handle); err != nil {
+		if _, ok := err.(cerrors.ErrorResourceDoesNotExist); ok {
+			return nil
+		}
+		log.Errorf("IP releasing error, handle: %s", handle)
+		return err
+	}
+	return nil
+}
+
+// IsIPAllocated checks the allocation block of the ip, GetAssignmentAttributes of calico can't tell
+// unassigned ips from errors reading blocks, both are reported as plain errors
+func (m calicoIPPoolmanager) IsIPAllocated(ctx context.Context, ip types.IP) (bool, error) {
+	calicoIP := caliconet.ParseIP(ip.Address)
+	if calicoIP == nil {
+		return false, errors.Errorf("invalid ip %s", ip.Address)
+	}
+	backend, ok := m.cliv3.(interface{ Backend() bapi.Client })
+	if !ok {
+		return false, errors.New("calico backend client is not available")
+	}
+	pools, err := m.IPPools(ctx)
+	if err != nil {
+		return false, err
+	}
+	pool := poolOfIP(pools.Items, *calicoIP)
+	if pool == nil {
+		return false, errors.Errorf("%s is not part of a configured pool", ip.Address)
+	}
+	kv, err := backend.Backend().Get(ctx, model.BlockKey{CIDR: blockCIDROf(*calicoIP, pool.Spec.BlockSize)}, "")
+	if err != nil {
+		if _, ok := err.(cerrors.ErrorResourceDoesNotExist); ok {
+			// no address of the block is allocated
+			return false, nil
+		}
+		return false, err
+	}
+	block, ok := kv.Value.(*model.AllocationBlock)
+	if !ok {
+		return false, errors.Errorf("unexpected allocation block %v", kv.Value)
+	}
+	ordinal, err := block.IPToOrdinal(*calicoIP)
+	if err != nil {
+		return false, err
+	}
+	return block.Allocations[ordinal] != nil, nil
+}
+
+func poolOfIP(pools []apiv3.IPPool, ip caliconet.IP) *apiv3.IPPool {
+	for i := range pools {
+		if _, cidr, err := caliconet.ParseCIDR(pools[i].Spec.CIDR); err == nil && cidr.Contains(ip.IP) {
+			return &pools[i]
+		}
+	}
+	return nil
+}
+
+// blockCIDROf returns the cidr of the allocation block containing the ip, as calico does
+func blockCIDROf(ip caliconet.IP, blockSize int) caliconet.IPNet {
+	bits := 32
+	if ip.Version() == 6 {
+		bits = 128
+	}
+	mask := net.CIDRMask(blockSize, bits)
+	return caliconet.IPNet{IPNet: net.IPNet{IP: ip.Mask(mask), Mask: mask}}
+}
+
 // IPPools .
 func (m calicoIPPoolmanager) IPPools(ctx context.Context) (*apiv3.IPPoolList, error) {
 	return m.cliv3.IPPools().List(ctx, options.ListOptions{})
@@ -0,0 +1,101 @@
+package vessel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
+	bapi "github.com/projectcalico/libcalico-go/lib/backend/api"
+	"github.com/projectcalico/libcalico-go/lib/backend/model"
+	"github.com/projectcalico/libcalico-go/lib/clientv3"
+	cerrors "github.com/projectcalico/libcalico-go/lib/errors"
+	caliconet "github.com/projectcalico/libcalico-go/lib/net"
+	"github.com/projectcalico/libcalico-go/lib/options"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/projecteru2/barrel/types"
+)
+
+// fakeCalicoClient serves pools and allocation blocks, as the calico etcd backend does
+type fakeCalicoClient struct {
+	clientv3.Interface
+	pools   []apiv3.IPPool
+	backend fakeCalicoBackend
+}
+
+func (c fakeCalicoClient) IPPools() clientv3.IPPoolInterface {
+	return fakeIPPools{pools: c.pools}
+}
+
+func (c fakeCalicoClient) Backend() bapi.Client {
+	return c.backend
+}
+
+type fakeIPPools struct {
+	clientv3.IPPoolInterface
+	pools []apiv3.IPPool
+}
+
+func (p fakeIPPools) List(ctx context.Context, opts options.ListOptions) (*apiv3.IPPoolList, error) {
+	return &apiv3.IPPoolList{Items: p.pools}, nil
+}
+
+type fakeCalicoBackend struct {
+	bapi.Client
+	blocks map[string]*model.AllocationBlock
+	err    error
+}
+
+func (b fakeCalicoBackend) Get(ctx context.Context, key model.Key, revision string) (*model.KVPair, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	block, ok := b.blocks[key.(model.BlockKey).CIDR.String()]
+	if !ok {
+		return nil, cerrors.ErrorResourceDoesNotExist{Identifier: key}
+	}
+	return &model.KVPair{Key: key, Value: block}, nil
+}
+
+func TestIsIPAllocated(t *testing.T) {
+	_, cidr, err := caliconet.ParseCIDR("10.10.10.0/26")
+	assert.NoError(t, err)
+	block := &model.AllocationBlock{CIDR: *cidr, Allocations: make([]*int, 64)}
+	attr := 0
+	block.Allocations[10] = &attr
+
+	pool := apiv3.IPPool{}
+	pool.Name = "pool1"
+	pool.Spec.CIDR = "10.10.0.0/16"
+	pool.Spec.BlockSize = 26
+	client := fakeCalicoClient{
+		pools:   []apiv3.IPPool{pool},
+		backend: fakeCalicoBackend{blocks: map[string]*model.AllocationBlock{"10.10.10.0/26": block}},
+	}
+	m := calicoIPPoolmanager{cliv3: client}
+
+	ctx := context.Background()
+	allocated, err := m.IsIPAllocated(ctx, types.IP{PoolID: "pool1", Address: "10.10.10.10"})
+	assert.NoError(t, err)
+	assert.True(t, allocated)
+
+	// not assigned in the block
+	allocated, err = m.IsIPAllocated(ctx, types.IP{PoolID: "pool1", Address: "10.10.10.11"})
+	assert.NoError(t, err)
+	assert.False(t, allocated)
+
+	// the block doesn't exist
+	allocated, err = m.IsIPAllocated(ctx, types.IP{PoolID: "pool1", Address: "10.10.10.70"})
+	assert.NoError(t, err)
+	assert.False(t, allocated)
+
+	_, err = m.IsIPAllocated(ctx, types.IP{PoolID: "pool1", Address: "10.20.10.10"})
+	assert.Error(t, err)
+
+	// errors reading the block aren't taken as unallocated
+	client.backend.err = errors.New("etcdserver: request timed out")
+	m = calicoIPPoolmanager{cliv3: client}
+	_, err = m.IsIPAllocated(ctx, types.IP{PoolID: "pool1", Address: "10.10.10.11"})
+	assert.Error(t, err)
+}
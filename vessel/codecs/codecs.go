@@ -19,14 +19,14 @@ func (codec *IPInfoCodec) Key() string {
 		return ""
 	}
 	if codec.IPInfo.PoolID == "" {
-		return fmt.Sprintf("/barrel/addresses/%s", codec.IPInfo.Address)
+		return key("/addresses/%s", codec.IPInfo.Address)
 	}
-	return fmt.Sprintf("/barrel/pools/%s/addresses/%s", codec.IPInfo.PoolID, codec.IPInfo.Address)
+	return key("/pools/%s/addresses/%s", codec.IPInfo.PoolID, codec.IPInfo.Address)
 }
 
 // Encode .
 func (codec *IPInfoCodec) Encode() (string, error) {
-	return marshal(codec.IPInfo)
+	return encodeVersioned(SchemaIPInfo, codec.IPInfo)
 }
 
 // SetVersion .
@@ -41,7 +41,8 @@ func (codec *IPInfoCodec) Version() int64 {
 
 // Decode .
 func (codec *IPInfoCodec) Decode(input string) error {
-	return json.Unmarshal([]byte(input), codec.IPInfo)
+	_, err := decodeVersioned(SchemaIPInfo, input, codec.IPInfo)
+	return err
 }
 
 // ContainerInfoCodec .
@@ -55,12 +56,12 @@ func (codec ContainerInfoCodec) Key() string {
 	if codec.Info.ID == "" || codec.Info.HostName == "" {
 		return ""
 	}
-	return fmt.Sprintf("/barrel/hosts/%s/containers/%s", codec.Info.HostName, codec.Info.ID)
+	return key("/hosts/%s/containers/%s", codec.Info.HostName, codec.Info.ID)
 }
 
 // Encode .
 func (codec ContainerInfoCodec) Encode() (string, error) {
-	return marshal(codec.Info)
+	return encodeVersioned(SchemaContainerInfo, codec.Info)
 }
 
 // SetVersion .
@@ -75,7 +76,212 @@ func (codec *ContainerInfoCodec) Version() int64 {
 
 // Decode .
 func (codec ContainerInfoCodec) Decode(input string) error {
-	return json.Unmarshal([]byte(input), codec.Info)
+	_, err := decodeVersioned(SchemaContainerInfo, input, codec.Info)
+	return err
+}
+
+// EventCursorCodec .
+type EventCursorCodec struct {
+	Cursor  *types.EventCursor
+	version int64
+}
+
+// Key .
+func (codec *EventCursorCodec) Key() string {
+	if codec.Cursor.HostName == "" {
+		return ""
+	}
+	return key("/hosts/%s/events/cursor", codec.Cursor.HostName)
+}
+
+// Encode .
+func (codec *EventCursorCodec) Encode() (string, error) {
+	return marshal(codec.Cursor)
+}
+
+// SetVersion .
+func (codec *EventCursorCodec) SetVersion(version int64) {
+	codec.version = version
+}
+
+// Version .
+func (codec *EventCursorCodec) Version() int64 {
+	return codec.version
+}
+
+// Decode .
+func (codec *EventCursorCodec) Decode(input string) error {
+	return json.Unmarshal([]byte(input), codec.Cursor)
+}
+
+// FixedIPKeyCodec .
+type FixedIPKeyCodec struct {
+	FixedIPKey *types.FixedIPKey
+	version    int64
+}
+
+// Key .
+func (codec *FixedIPKeyCodec) Key() string {
+	if codec.FixedIPKey.Network == "" || codec.FixedIPKey.Key == "" {
+		return ""
+	}
+	return key("/networks/%s/keys/%s", codec.FixedIPKey.Network, codec.FixedIPKey.Key)
+}
+
+// Encode .
+func (codec *FixedIPKeyCodec) Encode() (string, error) {
+	return marshal(codec.FixedIPKey)
+}
+
+// SetVersion .
+func (codec *FixedIPKeyCodec) SetVersion(version int64) {
+	codec.version = version
+}
+
+// Version .
+func (codec *FixedIPKeyCodec) Version() int64 {
+	return codec.version
+}
+
+// Decode .
+func (codec *FixedIPKeyCodec) Decode(input string) error {
+	return json.Unmarshal([]byte(input), codec.FixedIPKey)
+}
+
+// FixedIPRetentionCodec .
+type FixedIPRetentionCodec struct {
+	Retention *types.FixedIPRetention
+	version   int64
+}
+
+// Key .
+func (codec *FixedIPRetentionCodec) Key() string {
+	if codec.Retention.Owner == "" || codec.Retention.PoolID == "" || codec.Retention.Address == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s%s/%s", FixedIPRetentionPrefix(codec.Retention.Owner), codec.Retention.PoolID, codec.Retention.Address)
+}
+
+// Encode .
+func (codec *FixedIPRetentionCodec) Encode() (string, error) {
+	return marshal(codec.Retention)
+}
+
+// SetVersion .
+func (codec *FixedIPRetentionCodec) SetVersion(version int64) {
+	codec.version = version
+}
+
+// Version .
+func (codec *FixedIPRetentionCodec) Version() int64 {
+	return codec.version
+}
+
+// Decode .
+func (codec *FixedIPRetentionCodec) Decode(input string) error {
+	return json.Unmarshal([]byte(input), codec.Retention)
+}
+
+// FixedIPReservationCodec .
+type FixedIPReservationCodec struct {
+	Reservation *types.FixedIPReservation
+	version     int64
+}
+
+// Key .
+func (codec *FixedIPReservationCodec) Key() string {
+	if codec.Reservation.PoolID == "" || codec.Reservation.Address == "" {
+		return ""
+	}
+	return key("/reservations/%s/%s", codec.Reservation.PoolID, codec.Reservation.Address)
+}
+
+// Encode .
+func (codec *FixedIPReservationCodec) Encode() (string, error) {
+	return marshal(codec.Reservation)
+}
+
+// SetVersion .
+func (codec *FixedIPReservationCodec) SetVersion(version int64) {
+	codec.version = version
+}
+
+// Version .
+func (codec *FixedIPReservationCodec) Version() int64 {
+	return codec.version
+}
+
+// Decode .
+func (codec *FixedIPReservationCodec) Decode(input string) error {
+	return json.Unmarshal([]byte(input), codec.Reservation)
+}
+
+// HostLivenessCodec .
+type HostLivenessCodec struct {
+	Liveness *types.HostLiveness
+	version  int64
+}
+
+// Key .
+func (codec *HostLivenessCodec) Key() string {
+	if codec.Liveness.HostName == "" {
+		return ""
+	}
+	return key("/hosts/%s/alive", codec.Liveness.HostName)
+}
+
+// Encode .
+func (codec *HostLivenessCodec) Encode() (string, error) {
+	return marshal(codec.Liveness)
+}
+
+// SetVersion .
+func (codec *HostLivenessCodec) SetVersion(version int64) {
+	codec.version = version
+}
+
+// Version .
+func (codec *HostLivenessCodec) Version() int64 {
+	return codec.version
+}
+
+// Decode .
+func (codec *HostLivenessCodec) Decode(input string) error {
+	return json.Unmarshal([]byte(input), codec.Liveness)
+}
+
+// LeaderCodec .
+type LeaderCodec struct {
+	Leader  *types.Leader
+	version int64
+}
+
+// Key .
+func (codec *LeaderCodec) Key() string {
+	if codec.Leader.Role == "" {
+		return ""
+	}
+	return key("/leaders/%s", codec.Leader.Role)
+}
+
+// Encode .
+func (codec *LeaderCodec) Encode() (string, error) {
+	return marshal(codec.Leader)
+}
+
+// SetVersion .
+func (codec *LeaderCodec) SetVersion(version int64) {
+	codec.version = version
+}
+
+// Version .
+func (codec *LeaderCodec) Version() int64 {
+	return codec.version
+}
+
+// Decode .
+func (codec *LeaderCodec) Decode(input string) error {
+	return json.Unmarshal([]byte(input), codec.Leader)
 }
 
 func marshal(src interface{}) (string, error) {
@@ -83,6 +289,15 @@ func marshal(src interface{}) (string, error) {
 	return string(bytes), err
 }
 
+// IPInfoPrefix returns the key prefix of fixed ips in pool,
+// returns the prefix of all pools when poolID is blank
+func IPInfoPrefix(poolID string) string {
+	if poolID == "" {
+		return key("/pools/")
+	}
+	return key("/pools/%s/addresses/", poolID)
+}
+
 // IPInfoMultiGetCodec .
 type IPInfoMultiGetCodec struct {
 	PrefixKey string
@@ -97,7 +312,85 @@ func (codec *IPInfoMultiGetCodec) Prefix() string {
 
 // Decode .
 func (codec *IPInfoMultiGetCodec) Decode(val string, ver int64) {
-	c := &IPInfoCodec{}
+	c := &IPInfoCodec{IPInfo: &types.IPInfo{}}
+	if err := c.Decode(val); err != nil {
+		codec.Errors = append(codec.Errors, err)
+		return
+	}
+	c.SetVersion(ver)
+	codec.Codecs = append(codec.Codecs, c)
+}
+
+// ContainerInfoPrefix returns the key prefix of container records of the host
+func ContainerInfoPrefix(hostname string) string {
+	return key("/hosts/%s/containers/", hostname)
+}
+
+// ContainerInfoMultiGetCodec .
+type ContainerInfoMultiGetCodec struct {
+	HostName string
+	Codecs   []*ContainerInfoCodec
+	Errors   []error
+}
+
+// Prefix .
+func (codec *ContainerInfoMultiGetCodec) Prefix() string {
+	return ContainerInfoPrefix(codec.HostName)
+}
+
+// Decode .
+func (codec *ContainerInfoMultiGetCodec) Decode(val string, ver int64) {
+	c := &ContainerInfoCodec{Info: &types.ContainerInfo{}}
+	if err := c.Decode(val); err != nil {
+		codec.Errors = append(codec.Errors, err)
+		return
+	}
+	c.SetVersion(ver)
+	codec.Codecs = append(codec.Codecs, c)
+}
+
+// FixedIPKeyMultiGetCodec .
+type FixedIPKeyMultiGetCodec struct {
+	Codecs []*FixedIPKeyCodec
+	Errors []error
+}
+
+// Prefix .
+func (codec *FixedIPKeyMultiGetCodec) Prefix() string {
+	return key("/networks/")
+}
+
+// Decode .
+func (codec *FixedIPKeyMultiGetCodec) Decode(val string, ver int64) {
+	c := &FixedIPKeyCodec{FixedIPKey: &types.FixedIPKey{}}
+	if err := c.Decode(val); err != nil {
+		codec.Errors = append(codec.Errors, err)
+		return
+	}
+	c.SetVersion(ver)
+	codec.Codecs = append(codec.Codecs, c)
+}
+
+// FixedIPRetentionPrefix .
+func FixedIPRetentionPrefix(owner string) string {
+	return key("/retentions/%s/", owner)
+}
+
+// FixedIPRetentionMultiGetCodec .
+type FixedIPRetentionMultiGetCodec struct {
+	Owner  string
+	Codecs []*FixedIPRetentionCodec
+	Errors []error
+}
+
+// Prefix .
+func (codec *FixedIPRetentionMultiGetCodec) Prefix() string {
+	return FixedIPRetentionPrefix(codec.Owner)
+}
+
+// Decode .
+func (codec *FixedIPRetentionMultiGetCodec) Decode(val string, ver int64) {
+	c := &FixedIPRetentionCodec{Retention: &types.FixedIPRetention{}}
 	if err := c.Decode(val); err != nil {
 		codec.Errors = append(codec.Errors, err)
 		return
@@ -105,3 +398,95 @@ func (codec *IPInfoMultiGetCodec) Decode(val string, ver int64) {
 	c.SetVersion(ver)
 	codec.Codecs = append(codec.Codecs, c)
 }
+
+// IntentCodec .
+type IntentCodec struct {
+	Intent  *types.Intent
+	version int64
+}
+
+// Key .
+func (codec *IntentCodec) Key() string {
+	if codec.Intent.HostName == "" || codec.Intent.ID == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s%s", IntentPrefix(codec.Intent.HostName), codec.Intent.ID)
+}
+
+// Encode .
+func (codec *IntentCodec) Encode() (string, error) {
+	return marshal(codec.Intent)
+}
+
+// SetVersion .
+func (codec *IntentCodec) SetVersion(version int64) {
+	codec.version = version
+}
+
+// Version .
+func (codec *IntentCodec) Version() int64 {
+	return codec.version
+}
+
+// Decode .
+func (codec *IntentCodec) Decode(input string) error {
+	return json.Unmarshal([]byte(input), codec.Intent)
+}
+
+// IntentPrefix returns the key prefix of the journal of the host
+func IntentPrefix(hostname string) string {
+	return key("/journal/%s/", hostname)
+}
+
+// IntentMultiGetCodec .
+type IntentMultiGetCodec struct {
+	HostName string
+	Codecs   []*IntentCodec
+	Errors   []error
+}
+
+// Prefix .
+func (codec *IntentMultiGetCodec) Prefix() string {
+	return IntentPrefix(codec.HostName)
+}
+
+// Decode .
+func (codec *IntentMultiGetCodec) Decode(val string, ver int64) {
+	c := &IntentCodec{Intent: &types.Intent{}}
+	if err := c.Decode(val); err != nil {
+		codec.Errors = append(codec.Errors, err)
+		return
+	}
+	c.SetVersion(ver)
+	codec.Codecs = append(codec.Codecs, c)
+}
+
+// HealthCheckCodec is a never written key, reading it probes the store
+type HealthCheckCodec struct {
+	version int64
+}
+
+// Key .
+func (codec *HealthCheckCodec) Key() string {
+	return key("/healthcheck")
+}
+
+// Encode .
+func (codec *HealthCheckCodec) Encode() (string, error) {
+	return "", nil
+}
+
+// SetVersion .
+func (codec *HealthCheckCodec) SetVersion(version int64) {
+	codec.version = version
+}
+
+// Version .
+func (codec *HealthCheckCodec) Version() int64 {
+	return codec.version
+}
+
+// Decode .
+func (codec *HealthCheckCodec) Decode(string) error {
+	return nil
+}
@@ -32,3 +32,20 @@ func TestCodec(t *testing.T) {
 	assert.Equal(t, "container-01", decoder.IPInfo.Attrs.Borrowers[0].ID)
 	assert.Equal(t, "host-01", decoder.IPInfo.Attrs.Borrowers[0].HostName)
 }
+
+func TestPrefix(t *testing.T) {
+	defer func() { assert.NoError(t, Init(DefaultPrefix)) }()
+
+	codec := &IPInfoCodec{IPInfo: &types.IPInfo{PoolID: "pool-1", Address: "127.0.0.1"}}
+	assert.Equal(t, "/barrel/pools/pool-1/addresses/127.0.0.1", codec.Key())
+
+	assert.NoError(t, Init("/staging/barrel/"))
+	assert.Equal(t, "/staging/barrel", Prefix())
+	assert.Equal(t, "/staging/barrel/pools/pool-1/addresses/127.0.0.1", codec.Key())
+	assert.Equal(t, "/staging/barrel/pools/", IPInfoPrefix(""))
+	assert.Equal(t, "/staging/barrel/hosts/host-01/containers/", ContainerInfoPrefix("host-01"))
+
+	assert.Error(t, Init("/"))
+	assert.Error(t, Init("barrel"))
+	assert.Equal(t, "/staging/barrel", Prefix())
+}
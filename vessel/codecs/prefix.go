@@ -0,0 +1,43 @@
+package codecs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// DefaultPrefix is the namespace of barrel keys when not configured
+const DefaultPrefix = "/barrel"
+
+// prefix is set once on start, before any key is generated
+var prefix = DefaultPrefix
+
+// Init sets the namespace of all barrel keys,
+// so that multiple barrel clusters can share one etcd
+func Init(keyPrefix string) error {
+	p, err := NormalizePrefix(keyPrefix)
+	if err != nil {
+		return err
+	}
+	prefix = p
+	return nil
+}
+
+// Prefix returns the namespace of barrel keys
+func Prefix() string {
+	return prefix
+}
+
+// NormalizePrefix validates the key prefix and trims the trailing slash
+func NormalizePrefix(keyPrefix string) (string, error) {
+	p := strings.TrimRight(keyPrefix, "/")
+	if p == "" || !strings.HasPrefix(p, "/") {
+		return "", errors.Errorf("invalid key prefix %q, must be an absolute path other than /", keyPrefix)
+	}
+	return p, nil
+}
+
+func key(format string, args ...interface{}) string {
+	return prefix + fmt.Sprintf(format, args...)
+}
@@ -0,0 +1,139 @@
+package codecs
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+
+	"github.com/projecteru2/barrel/types"
+)
+
+const (
+	// SchemaIPInfo is the schema of stored types.IPInfo
+	SchemaIPInfo = "IPInfo"
+	// SchemaContainerInfo is the schema of stored types.ContainerInfo
+	SchemaContainerInfo = "ContainerInfo"
+
+	// schemaVersionField is embedded in stored json, records without it are of version 0
+	schemaVersionField = "SchemaVersion"
+)
+
+// Migration upgrades a stored record from its version to the next version,
+// the record is the generic json object, numbers are json.Number
+type Migration func(record map[string]interface{}) error
+
+// migrations[i] upgrades records of version i to version i+1
+var migrations = map[string][]Migration{}
+
+func init() {
+	// records written before the schema version is introduced are compatible with version 1
+	RegisterMigration(SchemaIPInfo, func(map[string]interface{}) error { return nil })
+	RegisterMigration(SchemaContainerInfo, func(map[string]interface{}) error { return nil })
+}
+
+// RegisterMigration appends the migration to the schema, which increases its latest version,
+// it must be called in init, before any record is decoded
+func RegisterMigration(schema string, migration Migration) {
+	migrations[schema] = append(migrations[schema], migration)
+}
+
+// LatestSchemaVersion is the version records of the schema are encoded in
+func LatestSchemaVersion(schema string) int {
+	return len(migrations[schema])
+}
+
+// encodeVersioned marshals src with the latest schema version embedded
+func encodeVersioned(schema string, src interface{}) (string, error) {
+	bs, err := json.Marshal(src)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.HasPrefix(bs, []byte("{")) {
+		return "", errors.Errorf("%s should be encoded as json object", schema)
+	}
+	field := `"` + schemaVersionField + `":` + strconv.Itoa(LatestSchemaVersion(schema))
+	if string(bs) != "{}" {
+		field += ","
+	}
+	return "{" + field + string(bs[1:]), nil
+}
+
+// decodeVersioned unmarshals input into dst after migrated to the latest schema version,
+// records of newer versions are decoded as is, returns the stored version
+func decodeVersioned(schema string, input string, dst interface{}) (int, error) {
+	version, err := storedSchemaVersion(input)
+	if err != nil {
+		return 0, err
+	}
+	if version >= LatestSchemaVersion(schema) {
+		return version, json.Unmarshal([]byte(input), dst)
+	}
+
+	var record map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(input))
+	decoder.UseNumber()
+	if err := decoder.Decode(&record); err != nil {
+		return version, err
+	}
+	for v := version; v < LatestSchemaVersion(schema); v++ {
+		if err := migrations[schema][v](record); err != nil {
+			return version, errors.Annotatef(err, "migrate %s from version %d", schema, v)
+		}
+	}
+	bs, err := json.Marshal(record)
+	if err != nil {
+		return version, err
+	}
+	return version, json.Unmarshal(bs, dst)
+}
+
+func storedSchemaVersion(input string) (int, error) {
+	var header struct {
+		SchemaVersion int
+	}
+	err := json.Unmarshal([]byte(input), &header)
+	return header.SchemaVersion, err
+}
+
+// SchemaOf returns the schema of records stored under key
+func SchemaOf(key string) (string, bool) {
+	switch {
+	case strings.HasPrefix(key, IPInfoPrefix("")) && strings.Contains(key, "/addresses/"),
+		strings.HasPrefix(key, prefix+"/addresses/"):
+		return SchemaIPInfo, true
+	case strings.HasPrefix(key, prefix+"/hosts/") && strings.Contains(key, "/containers/"):
+		return SchemaContainerInfo, true
+	default:
+		return "", false
+	}
+}
+
+// MigrateRecord rewrites the record stored under key in the latest schema version,
+// returns false when the record is already of the latest version or not versioned
+func MigrateRecord(key string, value string) (string, bool, error) {
+	schema, ok := SchemaOf(key)
+	if !ok {
+		return value, false, nil
+	}
+	var codec interface {
+		Encode() (string, error)
+		Decode(string) error
+	}
+	switch schema {
+	case SchemaIPInfo:
+		codec = &IPInfoCodec{IPInfo: new(types.IPInfo)}
+	case SchemaContainerInfo:
+		codec = &ContainerInfoCodec{Info: new(types.ContainerInfo)}
+	}
+	if version, err := storedSchemaVersion(value); err != nil || version >= LatestSchemaVersion(schema) {
+		return value, false, err
+	}
+	if err := codec.Decode(value); err != nil {
+		return value, false, err
+	}
+	migrated, err := codec.Encode()
+	return migrated, err == nil, err
+}
@@ -0,0 +1,63 @@
+package codecs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/projecteru2/barrel/types"
+)
+
+func TestSchemaVersionEmbedded(t *testing.T) {
+	codec := &IPInfoCodec{IPInfo: &types.IPInfo{PoolID: "pool-1", Address: "127.0.0.1"}}
+	value, err := codec.Encode()
+	assert.NoError(t, err)
+	version, err := storedSchemaVersion(value)
+	assert.NoError(t, err)
+	assert.Equal(t, LatestSchemaVersion(SchemaIPInfo), version)
+
+	decoder := &IPInfoCodec{IPInfo: &types.IPInfo{}}
+	assert.NoError(t, decoder.Decode(value))
+	assert.Equal(t, *codec.IPInfo, *decoder.IPInfo)
+}
+
+func TestMigrationsAppliedOnDecode(t *testing.T) {
+	const schema = "Test"
+	defer delete(migrations, schema)
+	RegisterMigration(schema, func(record map[string]interface{}) error {
+		record["Address"] = record["Addr"]
+		delete(record, "Addr")
+		return nil
+	})
+	RegisterMigration(schema, func(record map[string]interface{}) error {
+		record["PoolID"] = "pool-" + record["PoolID"].(string)
+		return nil
+	})
+
+	var ipInfo types.IPInfo
+	version, err := decodeVersioned(schema, `{"PoolID":"1","Addr":"127.0.0.1","Status":1}`, &ipInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, version)
+	assert.Equal(t, types.IPInfo{PoolID: "pool-1", Address: "127.0.0.1", Status: types.IPStatusInUse}, ipInfo)
+
+	ipInfo = types.IPInfo{}
+	version, err = decodeVersioned(schema, `{"SchemaVersion":1,"PoolID":"1","Address":"127.0.0.1"}`, &ipInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, version)
+	assert.Equal(t, types.IPInfo{PoolID: "pool-1", Address: "127.0.0.1"}, ipInfo)
+}
+
+func TestMigrateRecord(t *testing.T) {
+	key := (&IPInfoCodec{IPInfo: &types.IPInfo{PoolID: "pool-1", Address: "127.0.0.1"}}).Key()
+	value, migrated, err := MigrateRecord(key, `{"PoolID":"pool-1","Address":"127.0.0.1"}`)
+	assert.NoError(t, err)
+	assert.True(t, migrated)
+
+	_, migrated, err = MigrateRecord(key, value)
+	assert.NoError(t, err)
+	assert.False(t, migrated)
+
+	_, migrated, err = MigrateRecord((&EventCursorCodec{Cursor: &types.EventCursor{HostName: "host-01"}}).Key(), `{"TimeNano":1}`)
+	assert.NoError(t, err)
+	assert.False(t, migrated)
+}
@@ -0,0 +1,143 @@
+package vessel
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/projecteru2/barrel/events"
+	"github.com/projecteru2/barrel/metrics"
+	"github.com/projecteru2/barrel/store"
+	"github.com/projecteru2/barrel/types"
+	"github.com/projecteru2/barrel/vessel/codecs"
+)
+
+type containerVessel struct {
+	hostname string
+	store.Store
+}
+
+// NewContainerVessel .
+func NewContainerVessel(hostname string, stor store.Store) ContainerVessel {
+	return containerVessel{
+		hostname: hostname,
+		Store:    stor,
+	}
+}
+
+// ListContainers list container records of current host
+func (v containerVessel) ListContainers() ([]types.ContainerInfo, error) {
+	codec := codecs.ContainerInfoMultiGetCodec{HostName: v.hostname}
+	if err := v.GetMulti(context.Background(), &codec); err != nil {
+		return nil, err
+	}
+	if len(codec.Errors) > 0 {
+		v.logger("ListContainers").Warnf("%d container records can't be decoded, first error = %v", len(codec.Errors), codec.Errors[0])
+	}
+	infos := make([]types.ContainerInfo, 0, len(codec.Codecs))
+	for _, c := range codec.Codecs {
+		infos = append(infos, *c.Info)
+	}
+	return infos, nil
+}
+
+// UpdateContainer updates the networks of container record, create the record if not exists
+// addresses of the record is managed by proxy, so keep them untouched
+func (v containerVessel) UpdateContainer(ctx context.Context, info types.ContainerInfo) error {
+	logger := v.logger("UpdateContainer")
+
+	for cnt := 0; cnt < retryMaxCount; cnt++ {
+		var (
+			container = types.ContainerInfo{Container: v.container(info)}
+			codec     = codecs.ContainerInfoCodec{Info: &container}
+			updated   bool
+			err       error
+		)
+		if err = v.Get(ctx, &codec); store.ErrButOtherThenKVUnexistsErr(err) {
+			return err
+		}
+		created := err != nil
+		container.Networks = info.Networks
+		if updated, err = v.UpdateElseGet(ctx, &codec); store.ErrButOtherThenKVUnexistsErr(err) {
+			return err
+		}
+		if updated {
+			logger.Infof("container(%s) networks are updated", container.ID)
+			if created {
+				events.Publish(events.ContainerEvent(events.ContainerCreated, container))
+			}
+			return nil
+		}
+		metrics.ObserveCASRetry("UpdateContainer")
+	}
+	metrics.ObserveCASRetryExceeded("UpdateContainer")
+	return types.ErrMaxRetryCountExceeded
+}
+
+// DeleteContainer removes the networks of container record,
+// the record is deleted when neither networks nor addresses is left
+func (v containerVessel) DeleteContainer(ctx context.Context, info types.ContainerInfo) error {
+	logger := v.logger("DeleteContainer")
+
+	for cnt := 0; cnt < retryMaxCount; cnt++ {
+		var (
+			container = types.ContainerInfo{Container: v.container(info)}
+			codec     = codecs.ContainerInfoCodec{Info: &container}
+			networks  []types.Network
+			updated   bool
+			err       error
+		)
+		if err = v.Get(ctx, &codec); err != nil {
+			if store.IsNotExists(err) {
+				logger.Infof("the container(%s) is not exists, will do nothing", container.ID)
+				return nil
+			}
+			return err
+		}
+		for _, network := range container.Networks {
+			if !includeEndpoint(info.Networks, network) {
+				networks = append(networks, network)
+			}
+		}
+		if len(networks) == 0 && len(container.Addresses) == 0 {
+			if err = v.Delete(ctx, &codec); store.ErrButOtherThenKVUnexistsErr(err) {
+				return err
+			}
+			logger.Infof("container(%s) record is removed", container.ID)
+			events.Publish(events.ContainerEvent(events.ContainerDeleted, container))
+			return nil
+		}
+		container.Networks = networks
+		if updated, err = v.UpdateElseGet(ctx, &codec); store.ErrButOtherThenKVUnexistsErr(err) {
+			return err
+		}
+		if updated {
+			logger.Infof("container(%s) networks are updated", container.ID)
+			return nil
+		}
+		metrics.ObserveCASRetry("DeleteContainer")
+	}
+	metrics.ObserveCASRetryExceeded("DeleteContainer")
+	return types.ErrMaxRetryCountExceeded
+}
+
+func (v containerVessel) container(info types.ContainerInfo) types.Container {
+	container := info.Container
+	if container.HostName == "" {
+		container.HostName = v.hostname
+	}
+	return container
+}
+
+func (v containerVessel) logger(method string) *log.Entry {
+	return log.WithField("Receiver", "containerVessel").WithField("Method", method)
+}
+
+func includeEndpoint(networks []types.Network, network types.Network) bool {
+	for _, n := range networks {
+		if n.NetworkID == network.NetworkID && n.EndpointID == network.EndpointID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package vessel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	barrelEtcd "github.com/projecteru2/barrel/etcd"
+	"github.com/projecteru2/barrel/store"
+	etcdStore "github.com/projecteru2/barrel/store/etcd"
+	"github.com/projecteru2/barrel/types"
+	"github.com/projecteru2/barrel/vessel/codecs"
+)
+
+func TestContainerVesselUpdateAndDelete(t *testing.T) {
+	stor := etcdStore.NewEtcdStore(barrelEtcd.NewEmbedEtcd(t).Client())
+	containerVessel := NewContainerVessel("localhost", stor)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(6)*time.Second)
+	defer cancel()
+
+	network := types.Network{
+		NetworkID:  "networkID",
+		EndpointID: "endpointID",
+		Address:    types.IP{PoolID: "poolID", Address: "10.10.10.10"},
+	}
+	info := types.ContainerInfo{
+		Container: types.Container{ID: "containerID", HostName: "localhost"},
+		Networks:  []types.Network{network},
+	}
+	assert.NoError(t, containerVessel.UpdateContainer(ctx, info))
+
+	infos, err := containerVessel.ListContainers()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(infos))
+	assert.Equal(t, []types.Network{network}, infos[0].Networks)
+
+	assert.NoError(t, containerVessel.DeleteContainer(ctx, info))
+	infos, err = containerVessel.ListContainers()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(infos))
+}
+
+func TestContainerVesselKeepAddresses(t *testing.T) {
+	stor := etcdStore.NewEtcdStore(barrelEtcd.NewEmbedEtcd(t).Client())
+	containerVessel := NewContainerVessel("localhost", stor)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(6)*time.Second)
+	defer cancel()
+
+	address := types.IP{PoolID: "poolID", Address: "10.10.10.10"}
+	record := types.ContainerInfo{
+		Container: types.Container{ID: "containerID", HostName: "localhost"},
+		Addresses: []types.IP{address},
+	}
+	assert.NoError(t, stor.Put(ctx, &codecs.ContainerInfoCodec{Info: &record}))
+
+	info := types.ContainerInfo{
+		Container: record.Container,
+		Networks: []types.Network{{
+			NetworkID:  "networkID",
+			EndpointID: "endpointID",
+			Address:    address,
+		}},
+	}
+	assert.NoError(t, containerVessel.UpdateContainer(ctx, info))
+	assert.NoError(t, containerVessel.DeleteContainer(ctx, info))
+
+	container := types.ContainerInfo{Container: record.Container}
+	assert.NoError(t, stor.Get(ctx, &codecs.ContainerInfoCodec{Info: &container}))
+	assert.Equal(t, []types.IP{address}, container.Addresses)
+	assert.Equal(t, 0, len(container.Networks))
+
+	assert.NoError(t, stor.Delete(ctx, &codecs.ContainerInfoCodec{Info: &container}))
+	assert.Equal(t, store.ErrKVNotExists, stor.Get(ctx, &codecs.ContainerInfoCodec{Info: &container}))
+}
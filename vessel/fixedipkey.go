@@ -0,0 +1,121 @@
+package vessel
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/projecteru2/barrel/store"
+	"github.com/projecteru2/barrel/types"
+	"github.com/projecteru2/barrel/vessel/codecs"
+)
+
+// GetFixedIPKey returns the fixed ips bound to key on network
+func (helper Helper) GetFixedIPKey(ctx context.Context, network string, key string) (*types.FixedIPKey, error) {
+	fixedIPKey := types.FixedIPKey{Network: network, Key: key}
+	if err := helper.Get(ctx, &codecs.FixedIPKeyCodec{FixedIPKey: &fixedIPKey}); err != nil {
+		return nil, err
+	}
+	return &fixedIPKey, nil
+}
+
+// BindFixedIPKey binds fixed ips to key on network unless the key is bound already,
+// returns the stored binding, which holds other fixed ips when the key is bound by others
+func (helper Helper) BindFixedIPKey(ctx context.Context, network string, key string, addresses []types.IP) (*types.FixedIPKey, error) {
+	// the stored binding is decoded into the codec, so addresses of caller are copied
+	fixedIPKey := types.FixedIPKey{Network: network, Key: key, Addresses: append([]types.IP{}, addresses...)}
+	// version 0 creates the binding only when it's absent
+	if _, err := helper.UpdateElseGet(ctx, &codecs.FixedIPKeyCodec{FixedIPKey: &fixedIPKey}); err != nil {
+		return nil, err
+	}
+	return &fixedIPKey, nil
+}
+
+// UnbindFixedIPKey removes the binding of key on network if it still holds the fixed ips
+func (helper Helper) UnbindFixedIPKey(ctx context.Context, network string, key string, addresses []types.IP) error {
+	fixedIPKey := types.FixedIPKey{Network: network, Key: key}
+	codec := &codecs.FixedIPKeyCodec{FixedIPKey: &fixedIPKey}
+	if err := helper.Get(ctx, codec); err != nil {
+		if store.IsNotExists(err) {
+			return nil
+		}
+		return err
+	}
+	if !SameFixedIPs(fixedIPKey.Addresses, addresses) {
+		return nil
+	}
+	// the key may be bound again in the meantime, which is kept
+	if _, err := helper.DeleteElseGet(ctx, codec); store.ErrButOtherThenKVUnexistsErr(err) {
+		return err
+	}
+	return nil
+}
+
+// SameFixedIPs .
+func SameFixedIPs(a []types.IP, b []types.IP) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ListFixedIPKeys .
+func (helper Helper) ListFixedIPKeys(ctx context.Context) ([]*types.FixedIPKey, error) {
+	codec := codecs.FixedIPKeyMultiGetCodec{}
+	if err := helper.GetMulti(ctx, &codec); err != nil {
+		return nil, err
+	}
+	if len(codec.Errors) > 0 {
+		helper.logger("ListFixedIPKeys").Warnf("%d fixed-ip key records can't be decoded, first error = %v", len(codec.Errors), codec.Errors[0])
+	}
+	var keys []*types.FixedIPKey
+	for _, c := range codec.Codecs {
+		keys = append(keys, c.FixedIPKey)
+	}
+	return keys, nil
+}
+
+// ReleaseFixedIPKey .
+func (helper Helper) ReleaseFixedIPKey(ctx context.Context, network string, key string) error {
+	return ReleaseFixedIPKey(ctx, helper.Store, helper.FixedIPAllocator(), network, key)
+}
+
+// ReleaseFixedIPKey unbinds the key and unallocs the fixed ips bound to it,
+// fails when any of the fixed ips is still borrowed
+func ReleaseFixedIPKey(ctx context.Context, stor store.Store, pool FixedIPPoolManager, network string, key string) error {
+	logger := log.WithField("Method", "ReleaseFixedIPKey").WithField("Network", network).WithField("Key", key)
+
+	var (
+		fixedIPKey = types.FixedIPKey{Network: network, Key: key}
+		codec      = codecs.FixedIPKeyCodec{FixedIPKey: &fixedIPKey}
+	)
+	if err := stor.Get(ctx, &codec); err != nil {
+		return err
+	}
+	for _, address := range fixedIPKey.Addresses {
+		ipInfoCodec, err := pool.GetFixedIP(ctx, address, nil)
+		if err == types.ErrFixedIPNotAllocated {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if attrs := ipInfoCodec.IPInfo.Attrs; attrs != nil && len(attrs.Borrowers) > 0 {
+			return types.ErrFixedIPKeyInUse
+		}
+	}
+	if err := stor.GetAndDelete(ctx, &codec); err != nil {
+		return err
+	}
+	for _, address := range fixedIPKey.Addresses {
+		if err := pool.UnallocFixedIP(ctx, address, false); err != nil && err != types.ErrFixedIPNotAllocated {
+			logger.WithError(err).WithField("fixed-ip", address).Error("Unalloc fixed ip error")
+		}
+	}
+	return nil
+}
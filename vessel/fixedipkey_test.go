@@ -0,0 +1,104 @@
+package vessel
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	barrelEtcd "github.com/projecteru2/barrel/etcd"
+	"github.com/projecteru2/barrel/store"
+	etcdStore "github.com/projecteru2/barrel/store/etcd"
+	"github.com/projecteru2/barrel/types"
+	"github.com/projecteru2/barrel/vessel/mocks"
+)
+
+func TestKeyedFixedIPKeptAfterRelease(t *testing.T) {
+	stor := etcdStore.NewEtcdStore(barrelEtcd.NewEmbedEtcd(t).Client())
+
+	calicoIPAllocator := mocks.CalicoIPAllocator{}
+	calicoIPAllocator.On("AllocIP", mock.Anything, mock.Anything).Return(nil)
+	calicoIPAllocator.On("UnallocIP", mock.Anything, mock.Anything).Return(nil)
+
+	helper := newTestHelper(&calicoIPAllocator, stor)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(6)*time.Second)
+	defer cancel()
+
+	ip := types.IP{PoolID: "poolID", Address: "10.10.10.10"}
+	container := types.Container{ID: "containerID", HostName: "localhost"}
+	assert.NoError(t, helper.FixedIPAllocator().AllocFixedIP(ctx, ip))
+	assert.NoError(t, helper.InitContainerInfoRecord(ctx, types.ContainerInfo{
+		Container:  container,
+		Addresses:  []types.IP{ip},
+		FixedIPKey: "key",
+	}))
+	_, err := helper.BindFixedIPKey(ctx, "network", "key", []types.IP{ip})
+	assert.NoError(t, err)
+	assert.Equal(t, types.ErrFixedIPKeyInUse, helper.ReleaseFixedIPKey(ctx, "network", "key"))
+
+	assert.NoError(t, helper.ReleaseContainerAddresses(ctx, container.ID))
+	codec, err := helper.FixedIPAllocator().GetFixedIP(ctx, ip, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(codec.IPInfo.Attrs.Borrowers))
+
+	fixedIPKey, err := helper.GetFixedIPKey(ctx, "network", "key")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.IP{ip}, fixedIPKey.Addresses)
+
+	assert.NoError(t, helper.ReleaseFixedIPKey(ctx, "network", "key"))
+	_, err = helper.GetFixedIPKey(ctx, "network", "key")
+	assert.Equal(t, store.ErrKVNotExists, err)
+	_, err = helper.FixedIPAllocator().GetFixedIP(ctx, ip, nil)
+	assert.Equal(t, types.ErrFixedIPNotAllocated, err)
+}
+
+func TestConcurrentBindFixedIPKey(t *testing.T) {
+	stor := etcdStore.NewEtcdStore(barrelEtcd.NewEmbedEtcd(t).Client())
+	helper := NewHelper(vessel{hostname: "localhost"}, stor)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(6)*time.Second)
+	defer cancel()
+
+	var (
+		candidates = [][]types.IP{
+			{{PoolID: "poolID", Address: "10.10.10.10"}},
+			{{PoolID: "poolID", Address: "10.10.10.11"}},
+		}
+		bindings = make([]*types.FixedIPKey, len(candidates))
+		errs     = make([]error, len(candidates))
+		wg       sync.WaitGroup
+	)
+	for i := range candidates {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			bindings[i], errs[i] = helper.BindFixedIPKey(ctx, "network", "key", candidates[i])
+		}(i)
+	}
+	wg.Wait()
+
+	// only one of the binds wins, the other gets the binding of the winner
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1])
+	assert.Equal(t, bindings[0].Addresses, bindings[1].Addresses)
+	winner := 0
+	if SameFixedIPs(bindings[0].Addresses, candidates[1]) {
+		winner = 1
+	}
+	assert.Equal(t, candidates[winner], bindings[winner].Addresses)
+	fixedIPKey, err := helper.GetFixedIPKey(ctx, "network", "key")
+	assert.NoError(t, err)
+	assert.Equal(t, candidates[winner], fixedIPKey.Addresses)
+
+	// the loser can't unbind the binding of the winner
+	assert.NoError(t, helper.UnbindFixedIPKey(ctx, "network", "key", candidates[1-winner]))
+	_, err = helper.GetFixedIPKey(ctx, "network", "key")
+	assert.NoError(t, err)
+	assert.NoError(t, helper.UnbindFixedIPKey(ctx, "network", "key", candidates[winner]))
+	_, err = helper.GetFixedIPKey(ctx, "network", "key")
+	assert.Equal(t, store.ErrKVNotExists, err)
+}
@@ -3,8 +3,11 @@ package vessel
 import (
 	"context"
 
+	uuid "github.com/satori/go.uuid"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/projecteru2/barrel/events"
+	"github.com/projecteru2/barrel/metrics"
 	"github.com/projecteru2/barrel/store"
 	"github.com/projecteru2/barrel/types"
 	"github.com/projecteru2/barrel/utils"
@@ -23,6 +26,8 @@ type FixedIPPoolManager interface {
 	AssignFixedIP(context.Context, types.IP) error
 	UnassignFixedIP(context.Context, types.IP) error
 	UnallocFixedIP(context.Context, types.IP, bool) error
+	// RetireFixedIP unallocs the fixed ip unless the record is changed since the codec is read
+	RetireFixedIP(context.Context, *codecs.IPInfoCodec) error
 	GetFixedIP(context.Context, types.IP, func(context.Context, types.IP, *codecs.IPInfoCodec) error) (*codecs.IPInfoCodec, error)
 }
 
@@ -43,6 +48,7 @@ type FixedIPAllocator interface {
 type fixedIPPool struct {
 	CalicoIPPool
 	store.Store
+	journal *journal
 }
 
 // NewFixedIPPool .
@@ -72,6 +78,10 @@ func (pool fixedIPPool) AssignFixedIP(ctx context.Context, ip types.IP) error {
 		logger.WithField("fixed-ip", ip).Error(`Fixed-ip in use`)
 		return types.ErrIPInUse
 	}
+	if ipInfoCodec.IPInfo.Status.Match(types.IPStatusReserved) {
+		logger.WithField("fixed-ip", ip).Error(`Fixed-ip is reserved`)
+		return types.ErrFixedIPReserved
+	}
 
 	ipInfoCodec.IPInfo.Status.Mark(types.IPStatusInUse)
 	if ok, err = pool.UpdateElseGet(ctx, ipInfoCodec); err != nil {
@@ -81,6 +91,7 @@ func (pool fixedIPPool) AssignFixedIP(ctx context.Context, ip types.IP) error {
 		// update failed, the ip is modified by another container
 		return types.ErrIPInUse
 	}
+	events.Publish(events.FixedIPEvent(events.FixedIPAssigned, ip))
 	return nil
 }
 
@@ -118,7 +129,7 @@ func (pool fixedIPPool) UnassignFixedIP(ctx context.Context, ip types.IP) error
 	} else if !ok {
 		return types.ErrIPInUse
 	}
-
+	events.Publish(events.FixedIPEvent(events.FixedIPUnassigned, ip))
 	return nil
 }
 
@@ -141,13 +152,18 @@ func (pool fixedIPPool) BorrowFixedIP(ctx context.Context, ip types.IP, containe
 			codec.IPInfo.Attrs = attrs
 		}
 		attrs.Borrowers = append(attrs.Borrowers, container)
+		// the container creating is recorded, so the ip is no longer pending
+		codec.IPInfo.Status.Unmark(types.IPStatusPending)
 		if ok, err := pool.UpdateElseGet(ctx, codec); err != nil {
 			return err
 		} else if ok {
+			events.Publish(events.BorrowerEvent(events.FixedIPBorrowed, ip, container))
 			return nil
 		}
+		metrics.ObserveCASRetry("BorrowFixedIP")
 		cnt++
 	}
+	metrics.ObserveCASRetryExceeded("BorrowFixedIP")
 	return types.ErrMaxRetryCountExceeded
 }
 
@@ -177,15 +193,19 @@ func (pool fixedIPPool) ReturnFixedIP(ctx context.Context, ip types.IP, containe
 		if ok, err := pool.UpdateElseGet(ctx, codec); err != nil {
 			return err
 		} else if ok {
+			events.Publish(events.BorrowerEvent(events.FixedIPReturned, ip, container))
 			return nil
 		}
+		metrics.ObserveCASRetry("ReturnFixedIP")
 		cnt++
 	}
+	metrics.ObserveCASRetryExceeded("ReturnFixedIP")
 	return types.ErrMaxRetryCountExceeded
 }
 
 // UnallocFixedIP .
-func (pool fixedIPPool) UnallocFixedIP(ctx context.Context, ip types.IP, force bool) error {
+func (pool fixedIPPool) UnallocFixedIP(ctx context.Context, ip types.IP, force bool) (err error) {
+	defer func() { metrics.ObserveFixedIPOperation("release", err) }()
 	logger := pool.logger(
 		"UnallocFixedIP",
 	).WithField(
@@ -195,11 +215,7 @@ func (pool fixedIPPool) UnallocFixedIP(ctx context.Context, ip types.IP, force b
 	)
 
 	// First check whether the ip is assigned as fixed ip
-	var (
-		ipInfoCodec *codecs.IPInfoCodec
-		ok          bool
-		err         error
-	)
+	var ipInfoCodec *codecs.IPInfoCodec
 	// if ok, err = alloc.store.Get(ctx, ipInfoCodec); err != nil {
 	// 	logger.Errorf("Get IPInfo error, cause=%v", err)
 	// 	return err
@@ -225,28 +241,83 @@ func (pool fixedIPPool) UnallocFixedIP(ctx context.Context, ip types.IP, force b
 		logger.Info("IP still has borrower")
 		return types.ErrFixedIPHasBorrower
 	}
+	return pool.retireFixedIP(ctx, ipInfoCodec)
+}
 
-	// Lock the ip first
-	ipInfo.Status.Mark(types.IPStatusInUse, types.IPStatusRetired)
-	if ok, err = pool.UpdateElseGet(ctx, ipInfoCodec); err != nil {
+// RetireFixedIP unallocs the fixed ip as UnallocFixedIP does, unless the record is changed since the codec is read
+func (pool fixedIPPool) RetireFixedIP(ctx context.Context, codec *codecs.IPInfoCodec) (err error) {
+	defer func() { metrics.ObserveFixedIPOperation("release", err) }()
+	if codec.IPInfo.Status.Match(types.IPStatusInUse) {
+		return types.ErrIPInUse
+	}
+	return pool.retireFixedIP(ctx, codec)
+}
+
+// retireFixedIP locks the record at the version of codec, then deletes it and unallocs the ip
+func (pool fixedIPPool) retireFixedIP(ctx context.Context, codec *codecs.IPInfoCodec) error {
+	ip := types.IP{PoolID: codec.IPInfo.PoolID, Address: codec.IPInfo.Address}
+	logger := pool.logger(
+		"retireFixedIP",
+	).WithField(
+		"PoolID", ip.PoolID,
+	).WithField(
+		"Address", ip.Address,
+	)
+
+	// Journal the intent, so the unalloc is finished on start if we crash after the ip is locked
+	intent, err := pool.journal.begin(ctx, types.IntentUnallocFixedIP, ip)
+	if err != nil {
+		logger.WithError(err).Error("Journal intent failed")
+		return err
+	}
+
+	// Lock the ip first, the intent is kept on errors, as the lock may be taken
+	if codec.IPInfo.Attrs == nil {
+		codec.IPInfo.Attrs = &types.IPAttributes{}
+	}
+	if intent != nil {
+		codec.IPInfo.Attrs.RetiredBy = intent.Intent.ID
+	} else {
+		codec.IPInfo.Attrs.RetiredBy = uuid.NewV4().String()
+	}
+	codec.IPInfo.Status.Mark(types.IPStatusInUse, types.IPStatusRetired)
+	if ok, err := pool.UpdateElseGet(ctx, codec); err != nil {
 		logger.WithError(err).Errorf("Lock IPInfo failed")
+		return err
 	} else if !ok {
+		pool.journal.finish(ctx, intent)
 		return types.ErrIPInUse
 	}
 
+	// the step is recorded ahead of the delete, otherwise the unalloc isn't replayed on start if we crash right after,
+	// the locked record is deleted and unalloced by the replay if the step can't be recorded
+	if err = pool.journal.advance(ctx, intent, types.IntentStepRecordDeleted, ip); err != nil {
+		return err
+	}
+
 	// Now we remove the ipInfo
-	if err = pool.Delete(ctx, ipInfoCodec); err != nil {
+	if err = pool.Delete(ctx, codec); err != nil {
 		logger.WithError(err).Error("Delete IPInfo failed")
-		// The
 		return err
 	}
 
 	// Now we free the address
-	if err = pool.UnallocIP(ctx, ip); err != nil {
+	if err = unallocFixedIPAddress(ctx, pool, ip); err != nil {
 		logger.WithError(err).Error("Unalloc IP failed")
 		return err
 	}
 
+	pool.journal.finish(ctx, intent)
+	return nil
+}
+
+// unallocFixedIPAddress frees the address of a deleted fixed ip record in calico,
+// every path unallocing fixed ips goes through it, so the unallocated event is never missed
+func unallocFixedIPAddress(ctx context.Context, pool CalicoIPPool, ip types.IP) error {
+	if err := pool.UnallocIP(ctx, ip); err != nil {
+		return err
+	}
+	events.Publish(events.FixedIPEvent(events.FixedIPUnallocated, ip))
 	return nil
 }
 
@@ -294,24 +365,28 @@ type fixedIPAllocator struct {
 
 // NewFixedIPAllocator .
 func NewFixedIPAllocator(allocator CalicoIPAllocator, stor store.Store) FixedIPAllocator {
+	return newFixedIPAllocator(allocator, stor, nil)
+}
+
+// newFixedIPAllocator creates the allocator journaling multi-step operations when journal is not nil
+func newFixedIPAllocator(allocator CalicoIPAllocator, stor store.Store, journal *journal) FixedIPAllocator {
 	return fixedIPAllocator{
 		CalicoIPAllocator: allocator,
 		fixedIPPool: fixedIPPool{
 			CalicoIPPool: allocator,
 			Store:        stor,
+			journal:      journal,
 		},
 	}
 }
 
 // AllocFixedIP .
-func (alloc fixedIPAllocator) AllocFixedIP(ctx context.Context, ip types.IP) error {
+func (alloc fixedIPAllocator) AllocFixedIP(ctx context.Context, ip types.IP) (err error) {
+	defer func() { metrics.ObserveFixedIPOperation("alloc", err) }()
 	ctx = alloc.context(ctx, "AllocFixedIP")
 
 	// First check whether the ip is assigned as fixed ip
-	var (
-		ipInfoCodec *codecs.IPInfoCodec
-		err         error
-	)
+	var ipInfoCodec *codecs.IPInfoCodec
 	if ipInfoCodec, err = alloc.GetFixedIP(ctx, ip, alloc.createFixedIP); err != nil {
 		return err
 	}
@@ -325,42 +400,77 @@ func (alloc fixedIPAllocator) AllocFixedIP(ctx context.Context, ip types.IP) err
 	if ipInfoCodec.IPInfo.Status.Match(types.IPStatusInUse) {
 		return types.ErrIPInUse
 	}
+	if ipInfoCodec.IPInfo.Status.Match(types.IPStatusReserved) {
+		return types.ErrFixedIPReserved
+	}
 	return nil
 }
 
 // AllocFixedIPFromPools .
-func (alloc fixedIPAllocator) AllocFixedIPFromPools(ctx context.Context, pools []types.Pool) (types.IPAddress, error) {
+func (alloc fixedIPAllocator) AllocFixedIPFromPools(ctx context.Context, pools []types.Pool) (ip types.IPAddress, err error) {
+	defer func() { metrics.ObserveFixedIPOperation("alloc", err) }()
 	logger := alloc.logger("AllocFixedIPFromPools")
-	var (
-		ip  types.IPAddress
-		err error
-	)
-	if ip, err = alloc.AllocIPFromPools(ctx, pools); err != nil {
+	// the ip is allocated under the intent, so it's unalloced on start if we crash before it's recorded
+	var intent *codecs.IntentCodec
+	if intent, err = alloc.journal.begin(ctx, types.IntentCreateFixedIP, types.IP{}); err != nil {
+		return ip, err
+	}
+	if ip, err = alloc.AllocIPFromPools(intentContext(ctx, intent), pools); err != nil {
+		alloc.journal.finish(ctx, intent)
 		return ip, err
 	}
 	var (
 		ipInfo      = types.IPInfo{Address: ip.Address, PoolID: ip.PoolID}
 		ipInfoCodec = &codecs.IPInfoCodec{IPInfo: &ipInfo}
 	)
-	if err = alloc.Put(ctx, ipInfoCodec); err != nil {
+	// the ip must be recorded in the intent, otherwise the created fixed ip can't be told on start
+	if err = alloc.journal.advance(ctx, intent, types.IntentStepCalicoAllocated, ip.IP); err == nil {
+		err = alloc.Put(ctx, ipInfoCodec)
+	}
+	if err != nil {
 		if err := alloc.UnallocIP(ctx, ip.IP); err != nil {
 			logger.WithError(err).Errorf("UnallocIP error")
+			return ip, err
 		}
+		alloc.journal.finish(ctx, intent)
 		return ip, err
 	}
+	alloc.journal.finish(ctx, intent)
+	events.Publish(events.FixedIPEvent(events.FixedIPAllocated, ip.IP))
 	return ip, nil
 }
 
 func (alloc fixedIPAllocator) createFixedIP(ctx context.Context, ip types.IP, codec *codecs.IPInfoCodec) error {
 	logger := utils.LogEntry(ctx)
-	if err := alloc.AllocIP(ctx, ip); err != nil {
+	// the ip is allocated under the intent, so it's unalloced on start if we crash before it's recorded
+	intent, err := alloc.journal.begin(ctx, types.IntentCreateFixedIP, ip)
+	if err != nil {
+		logger.WithError(err).Error("Journal intent error")
+		return err
+	}
+	if err := alloc.AllocIP(intentContext(ctx, intent), ip); err != nil {
 		logger.WithError(err).Error("Alloc IP error")
+		alloc.journal.finish(ctx, intent)
 		return err
 	}
 	if err := alloc.Put(ctx, codec); err != nil {
 		logger.WithError(err).Error("Create FixedIPInfo error")
+		// only the ip allocated under the intent is unalloced
+		var unallocErr error
+		if intent != nil {
+			unallocErr = alloc.UnallocIPByHandle(ctx, intentHandle(intent.Intent))
+		} else {
+			unallocErr = alloc.UnallocIP(ctx, ip)
+		}
+		if unallocErr != nil {
+			logger.WithError(unallocErr).Error("Unalloc IP error")
+			return err
+		}
+		alloc.journal.finish(ctx, intent)
 		return err
 	}
+	alloc.journal.finish(ctx, intent)
+	events.Publish(events.FixedIPEvent(events.FixedIPAllocated, ip))
 	return nil
 }
 
@@ -2,9 +2,12 @@ package vessel
 
 import (
 	"context"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/projecteru2/barrel/events"
+	"github.com/projecteru2/barrel/metrics"
 	"github.com/projecteru2/barrel/store"
 	"github.com/projecteru2/barrel/types"
 	"github.com/projecteru2/barrel/vessel/codecs"
@@ -14,6 +17,8 @@ import (
 type Helper struct {
 	Vessel
 	store.Store
+	retention   time.Duration
+	reservation time.Duration
 }
 
 // NewHelper .
@@ -62,11 +67,19 @@ func (helper Helper) ReleaseContainerAddressesByIPPools(ctx context.Context, con
 		if updated, err = helper.UpdateElseGet(ctx, &codec); err != nil {
 			return err
 		}
+		if !updated {
+			metrics.ObserveCASRetry("ReleaseContainerAddressesByIPPools")
+		}
 	}
 	for _, address := range releases {
-		if err := helper.FixedIPAllocator().UnallocFixedIP(ctx, address, false); err != nil {
-			logger.Errorf("release reserved address error, cause = %v", err)
+		if err := helper.FixedIPAllocator().ReturnFixedIP(ctx, address, container.Container); err != nil {
+			logger.WithError(err).WithField("fixed-ip", address).Error("Return fixed ip error")
+		}
+		if container.FixedIPKey != "" {
+			// the address is kept for the key
+			continue
 		}
+		helper.releaseFixedIP(ctx, address, container.Name)
 	}
 	return nil
 }
@@ -85,6 +98,7 @@ func (helper Helper) ReleaseContainerAddresses(ctx context.Context, containerID
 		}
 		return err
 	}
+	events.Publish(events.ContainerEvent(events.ContainerDeleted, info))
 	if len(info.Addresses) == 0 {
 		logger.Infof("the ip of container(%s) is empty, will do nothing\n", containerID)
 		return nil
@@ -93,9 +107,11 @@ func (helper Helper) ReleaseContainerAddresses(ctx context.Context, containerID
 		if err := helper.FixedIPAllocator().ReturnFixedIP(ctx, address, container); err != nil {
 			logger.WithError(err).WithField("fixed-ip", address).WithField("container", container).Error("Return fixed ip error")
 		}
-		if err := helper.FixedIPAllocator().UnallocFixedIP(ctx, address, false); err != nil {
-			logger.Errorf("release reserved address error, cause = %v", err)
+		if info.FixedIPKey != "" {
+			// the address is kept for the key
+			continue
 		}
+		helper.releaseFixedIP(ctx, address, info.Name)
 	}
 	return nil
 }
@@ -118,7 +134,8 @@ func (helper Helper) ReserveAddressForContainer(ctx context.Context, containerID
 		if err = helper.Get(ctx, &codec); store.ErrButOtherThenKVUnexistsErr(err) {
 			return err
 		}
-		if err != nil {
+		created := err != nil
+		if created {
 			containerInfo.Addresses = []types.IP{address}
 		} else {
 			for _, addr := range containerInfo.Addresses {
@@ -131,20 +148,39 @@ func (helper Helper) ReserveAddressForContainer(ctx context.Context, containerID
 		if succeed, err := helper.UpdateElseGet(ctx, &codec); err != nil {
 			return err
 		} else if succeed {
+			if created {
+				events.Publish(events.ContainerEvent(events.ContainerCreated, containerInfo))
+			}
 			return nil
 		}
+		metrics.ObserveCASRetry("ReserveAddressForContainer")
 	}
 }
 
 // InitContainerInfoRecord .
-func (helper Helper) InitContainerInfoRecord(ctx context.Context, container types.Container, fixedIPs []types.IP) error {
-	containerInfo := types.ContainerInfo{Container: container, Addresses: fixedIPs}
-	for _, ip := range fixedIPs {
-		if err := helper.FixedIPAllocator().BorrowFixedIP(ctx, ip, container); err != nil {
-			log.WithError(err).WithField("FixedIP", ip).WithField("Container", container).Error("Borrow fixedip")
+func (helper Helper) InitContainerInfoRecord(ctx context.Context, containerInfo types.ContainerInfo) error {
+	for _, ip := range containerInfo.Addresses {
+		if err := helper.FixedIPAllocator().BorrowFixedIP(ctx, ip, containerInfo.Container); err != nil {
+			log.WithError(err).WithField("FixedIP", ip).WithField("Container", containerInfo.Container).Error("Borrow fixedip")
 		}
 	}
-	return helper.Put(ctx, &codecs.ContainerInfoCodec{Info: &containerInfo})
+	if err := helper.Put(ctx, &codecs.ContainerInfoCodec{Info: &containerInfo}); err != nil {
+		return err
+	}
+	events.Publish(events.ContainerEvent(events.ContainerCreated, containerInfo))
+	return nil
+}
+
+// ListFixedIPs lists fixed ips of the pool, lists fixed ips of all pools when poolID is blank
+func (helper Helper) ListFixedIPs(ctx context.Context, poolID string) ([]*codecs.IPInfoCodec, error) {
+	codec := codecs.IPInfoMultiGetCodec{PrefixKey: codecs.IPInfoPrefix(poolID)}
+	if err := helper.GetMulti(ctx, &codec); err != nil {
+		return nil, err
+	}
+	if len(codec.Errors) > 0 {
+		helper.logger("ListFixedIPs").Warnf("%d fixed-ip records can't be decoded, first error = %v", len(codec.Errors), codec.Errors[0])
+	}
+	return codec.Codecs, nil
 }
 
 func (helper Helper) logger(method string) *log.Entry {
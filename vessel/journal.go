@@ -0,0 +1,165 @@
+package vessel
+
+import (
+	"context"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/projecteru2/barrel/store"
+	"github.com/projecteru2/barrel/types"
+	"github.com/projecteru2/barrel/vessel/codecs"
+)
+
+// journal records intents of multi-step fixed ip operations of the host,
+// a nil journal records nothing
+type journal struct {
+	store.Store
+	hostname string
+}
+
+func newJournal(hostname string, stor store.Store) *journal {
+	return &journal{Store: stor, hostname: hostname}
+}
+
+// begin records the intent before the operation takes any effect
+func (j *journal) begin(ctx context.Context, operation types.IntentOperation, ip types.IP) (*codecs.IntentCodec, error) {
+	if j == nil {
+		return nil, nil
+	}
+	codec := &codecs.IntentCodec{Intent: &types.Intent{
+		ID:        uuid.NewV4().String(),
+		HostName:  j.hostname,
+		Operation: operation,
+		IP:        ip,
+		CreatedAt: time.Now().UnixNano(),
+	}}
+	if err := j.Put(ctx, codec); err != nil {
+		return nil, err
+	}
+	return codec, nil
+}
+
+// advance records the progress of the intent
+func (j *journal) advance(ctx context.Context, codec *codecs.IntentCodec, step types.IntentStep, ip types.IP) error {
+	if codec == nil {
+		return nil
+	}
+	codec.Intent.Step = step
+	codec.Intent.IP = ip
+	if err := j.Put(ctx, codec); err != nil {
+		j.logger("advance").WithError(err).Errorf("record step %s of intent %s error", step, codec.Intent.ID)
+		return err
+	}
+	return nil
+}
+
+// finish removes the intent after the operation is done or aborted without any effect
+func (j *journal) finish(ctx context.Context, codec *codecs.IntentCodec) {
+	if codec == nil {
+		return
+	}
+	if err := j.Delete(ctx, codec); store.ErrButOtherThenKVUnexistsErr(err) {
+		j.logger("finish").WithError(err).Errorf("remove intent %s error", codec.Intent.ID)
+	}
+}
+
+func (j *journal) logger(method string) *log.Entry {
+	return log.WithField("Receiver", "journal").WithField("Method", method)
+}
+
+// intentContext carries the ip handle of the intent, so ips allocated under the intent can be rolled back
+func intentContext(ctx context.Context, codec *codecs.IntentCodec) context.Context {
+	if codec == nil {
+		return ctx
+	}
+	return WithIPHandle(ctx, intentHandle(codec.Intent))
+}
+
+func intentHandle(intent *types.Intent) string {
+	return "barrel-intent." + intent.ID
+}
+
+// RecoverJournal replays or rolls back fixed ip operations left unfinished by the last run of the host,
+// it must be called before the host serves any request
+func (helper Helper) RecoverJournal(ctx context.Context) (int, error) {
+	logger := helper.logger("RecoverJournal")
+
+	codec := codecs.IntentMultiGetCodec{HostName: helper.Hostname()}
+	if err := helper.GetMulti(ctx, &codec); err != nil {
+		return 0, err
+	}
+	if len(codec.Errors) > 0 {
+		logger.Warnf("%d intents can't be decoded, first error = %v", len(codec.Errors), codec.Errors[0])
+	}
+	recovered := 0
+	for _, intentCodec := range codec.Codecs {
+		intent := intentCodec.Intent
+		if err := helper.recoverIntent(ctx, intent); err != nil {
+			logger.WithError(err).Errorf("recover intent %s of %s on fixed-ip(%v) error", intent.ID, intent.Operation, intent.IP)
+			continue
+		}
+		if err := helper.Delete(ctx, intentCodec); store.ErrButOtherThenKVUnexistsErr(err) {
+			logger.WithError(err).Errorf("remove intent %s error", intent.ID)
+			continue
+		}
+		logger.Infof("intent %s of %s on fixed-ip(%v) is recovered", intent.ID, intent.Operation, intent.IP)
+		recovered++
+	}
+	return recovered, nil
+}
+
+func (helper Helper) recoverIntent(ctx context.Context, intent *types.Intent) error {
+	switch intent.Operation {
+	case types.IntentCreateFixedIP:
+		return helper.rollbackCreateFixedIP(ctx, intent)
+	case types.IntentUnallocFixedIP:
+		return helper.replayUnallocFixedIP(ctx, intent)
+	default:
+		helper.logger("recoverIntent").Warnf("unknown operation %s of intent %s, discarded", intent.Operation, intent.ID)
+		return nil
+	}
+}
+
+// rollbackCreateFixedIP unallocs the ip in calico when the fixed ip record isn't created
+func (helper Helper) rollbackCreateFixedIP(ctx context.Context, intent *types.Intent) error {
+	if intent.IP.Address != "" {
+		_, err := helper.FixedIPAllocator().GetFixedIP(ctx, intent.IP, nil)
+		if err == nil {
+			// the operation is done
+			return nil
+		}
+		if err != types.ErrFixedIPNotAllocated {
+			return err
+		}
+	}
+	// only the ip allocated under the intent is unalloced
+	return helper.FixedIPAllocator().UnallocIPByHandle(ctx, intentHandle(intent))
+}
+
+// replayUnallocFixedIP finishes the unalloc once the fixed ip record is locked
+func (helper Helper) replayUnallocFixedIP(ctx context.Context, intent *types.Intent) error {
+	codec, err := helper.FixedIPAllocator().GetFixedIP(ctx, intent.IP, nil)
+	switch {
+	case err == types.ErrFixedIPNotAllocated:
+		if intent.Step != types.IntentStepRecordDeleted {
+			// the record is removed by others
+			return nil
+		}
+	case err != nil:
+		return err
+	case !codec.IPInfo.Status.Match(types.IPStatusRetired):
+		// crashed before the record is locked, the operation takes no effect
+		return nil
+	case retiredBy(codec.IPInfo) != "" && retiredBy(codec.IPInfo) != intent.ID:
+		// the record is recreated and retired by another unalloc since crashed
+		return nil
+	default:
+		if err := helper.Delete(ctx, codec); store.ErrButOtherThenKVUnexistsErr(err) {
+			return err
+		}
+	}
+	// unalloc is a no-op when the ip is unalloced before crashed
+	return unallocFixedIPAddress(ctx, helper.FixedIPAllocator(), intent.IP)
+}
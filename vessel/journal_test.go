@@ -0,0 +1,345 @@
+package vessel
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	dockerMocks "github.com/projecteru2/barrel/docker/mocks"
+	barrelEtcd "github.com/projecteru2/barrel/etcd"
+	"github.com/projecteru2/barrel/events"
+	"github.com/projecteru2/barrel/store"
+	etcdStore "github.com/projecteru2/barrel/store/etcd"
+	"github.com/projecteru2/barrel/store/memory"
+	"github.com/projecteru2/barrel/types"
+	"github.com/projecteru2/barrel/vessel/codecs"
+	"github.com/projecteru2/barrel/vessel/mocks"
+)
+
+func newJournalHelper(calicoIPAllocator *mocks.CalicoIPAllocator, stor store.Store) Helper {
+	return newHostHelper("localhost", newFixedIPAllocator(calicoIPAllocator, stor, newJournal("localhost", stor)), stor)
+}
+
+func putIntent(ctx context.Context, t *testing.T, stor store.Store, intent types.Intent) {
+	intent.HostName = "localhost"
+	assert.NoError(t, stor.Put(ctx, &codecs.IntentCodec{Intent: &intent}))
+}
+
+func countIntents(ctx context.Context, t *testing.T, stor store.Store) int {
+	codec := codecs.IntentMultiGetCodec{HostName: "localhost"}
+	assert.NoError(t, stor.GetMulti(ctx, &codec))
+	return len(codec.Codecs)
+}
+
+func TestFinishedFixedIPOperationLeavesNoIntent(t *testing.T) {
+	stor := etcdStore.NewEtcdStore(barrelEtcd.NewEmbedEtcd(t).Client())
+
+	ip := types.IPAddress{IP: types.IP{PoolID: "poolID", Address: "10.10.10.10"}}
+	calicoIPAllocator := mocks.CalicoIPAllocator{}
+	calicoIPAllocator.On("AllocIPFromPools", mock.Anything, mock.Anything).Return(ip, nil)
+	calicoIPAllocator.On("UnallocIP", mock.Anything, mock.Anything).Return(nil)
+	helper := newJournalHelper(&calicoIPAllocator, stor)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(10)*time.Second)
+	defer cancel()
+
+	_, err := helper.FixedIPAllocator().AllocFixedIPFromPools(ctx, []types.Pool{{Name: "poolID"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, countIntents(ctx, t, stor))
+
+	assert.NoError(t, helper.FixedIPAllocator().UnallocFixedIP(ctx, ip.IP, false))
+	assert.Equal(t, 0, countIntents(ctx, t, stor))
+	calicoIPAllocator.AssertCalled(t, "UnallocIP", mock.Anything, ip.IP)
+}
+
+// faultyStore fails puts and updates of codecs matched
+type faultyStore struct {
+	store.Store
+	failPut    func(store.Codec) bool
+	failUpdate func(store.Codec) bool
+}
+
+func (s faultyStore) Put(ctx context.Context, codec store.Codec) error {
+	if s.failPut != nil && s.failPut(codec) {
+		return errors.New("put error")
+	}
+	return s.Store.Put(ctx, codec)
+}
+
+func (s faultyStore) UpdateElseGet(ctx context.Context, codec store.Codec) (bool, error) {
+	if s.failUpdate != nil && s.failUpdate(codec) {
+		return false, errors.New("update error")
+	}
+	return s.Store.UpdateElseGet(ctx, codec)
+}
+
+func isIPInfo(codec store.Codec) bool {
+	return strings.HasPrefix(codec.Key(), codecs.IPInfoPrefix(""))
+}
+
+func TestCreateFixedIPRolledBackOnRecordError(t *testing.T) {
+	stor := faultyStore{Store: memory.NewMemoryStore(), failPut: isIPInfo}
+
+	calicoIPAllocator := mocks.CalicoIPAllocator{}
+	calicoIPAllocator.On("AllocIP", mock.Anything, mock.Anything).Return(nil)
+	calicoIPAllocator.On("UnallocIPByHandle", mock.Anything, mock.Anything).Return(nil)
+	helper := newJournalHelper(&calicoIPAllocator, stor)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(10)*time.Second)
+	defer cancel()
+
+	assert.Error(t, helper.FixedIPAllocator().AllocFixedIP(ctx, types.IP{PoolID: "poolID", Address: "10.10.10.10"}))
+	assert.Equal(t, 0, countIntents(ctx, t, stor))
+	calicoIPAllocator.AssertNumberOfCalls(t, "UnallocIPByHandle", 1)
+}
+
+func TestRecoverCreateFixedIPIntent(t *testing.T) {
+	stor := etcdStore.NewEtcdStore(barrelEtcd.NewEmbedEtcd(t).Client())
+
+	calicoIPAllocator := mocks.CalicoIPAllocator{}
+	calicoIPAllocator.On("AllocIP", mock.Anything, mock.Anything).Return(nil)
+	calicoIPAllocator.On("UnallocIPByHandle", mock.Anything, mock.Anything).Return(nil)
+	helper := newJournalHelper(&calicoIPAllocator, stor)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(10)*time.Second)
+	defer cancel()
+
+	created := types.IP{PoolID: "poolID", Address: "10.10.10.10"}
+	assert.NoError(t, helper.FixedIPAllocator().AllocFixedIP(ctx, created))
+	// crashed after the fixed ip is recorded
+	putIntent(ctx, t, stor, types.Intent{
+		ID: "created", Operation: types.IntentCreateFixedIP, Step: types.IntentStepCalicoAllocated, IP: created,
+	})
+	// crashed before the fixed ip is recorded
+	putIntent(ctx, t, stor, types.Intent{
+		ID: "allocated", Operation: types.IntentCreateFixedIP, Step: types.IntentStepCalicoAllocated,
+		IP: types.IP{PoolID: "poolID", Address: "10.10.10.11"},
+	})
+	// crashed before the ip is known
+	putIntent(ctx, t, stor, types.Intent{ID: "begun", Operation: types.IntentCreateFixedIP})
+
+	recovered, err := helper.RecoverJournal(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, recovered)
+	assert.Equal(t, 0, countIntents(ctx, t, stor))
+
+	calicoIPAllocator.AssertCalled(t, "UnallocIPByHandle", mock.Anything, "barrel-intent.allocated")
+	calicoIPAllocator.AssertCalled(t, "UnallocIPByHandle", mock.Anything, "barrel-intent.begun")
+	calicoIPAllocator.AssertNotCalled(t, "UnallocIPByHandle", mock.Anything, "barrel-intent.created")
+	_, err = helper.FixedIPAllocator().GetFixedIP(ctx, created, nil)
+	assert.NoError(t, err)
+}
+
+func TestRecoverUnallocFixedIPIntent(t *testing.T) {
+	stor := etcdStore.NewEtcdStore(barrelEtcd.NewEmbedEtcd(t).Client())
+
+	calicoIPAllocator := mocks.CalicoIPAllocator{}
+	calicoIPAllocator.On("AllocIP", mock.Anything, mock.Anything).Return(nil)
+	calicoIPAllocator.On("UnallocIP", mock.Anything, mock.Anything).Return(nil)
+	helper := newJournalHelper(&calicoIPAllocator, stor)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(10)*time.Second)
+	defer cancel()
+
+	retired := types.IP{PoolID: "poolID", Address: "10.10.10.10"}
+	assert.NoError(t, helper.FixedIPAllocator().AllocFixedIP(ctx, retired))
+	codec, err := helper.FixedIPAllocator().GetFixedIP(ctx, retired, nil)
+	assert.NoError(t, err)
+	codec.IPInfo.Status.Mark(types.IPStatusRetired)
+	updated, err := stor.UpdateElseGet(ctx, codec)
+	assert.NoError(t, err)
+	assert.True(t, updated)
+	// crashed after the fixed ip is locked
+	putIntent(ctx, t, stor, types.Intent{ID: "retired", Operation: types.IntentUnallocFixedIP, IP: retired})
+
+	untouched := types.IP{PoolID: "poolID", Address: "10.10.10.11"}
+	assert.NoError(t, helper.FixedIPAllocator().AllocFixedIP(ctx, untouched))
+	// crashed before the fixed ip is locked
+	putIntent(ctx, t, stor, types.Intent{ID: "untouched", Operation: types.IntentUnallocFixedIP, IP: untouched})
+
+	deleted := types.IP{PoolID: "poolID", Address: "10.10.10.12"}
+	// crashed after the fixed ip record is deleted
+	putIntent(ctx, t, stor, types.Intent{
+		ID: "deleted", Operation: types.IntentUnallocFixedIP, Step: types.IntentStepRecordDeleted, IP: deleted,
+	})
+
+	recreated := types.IP{PoolID: "poolID", Address: "10.10.10.13"}
+	assert.NoError(t, helper.FixedIPAllocator().AllocFixedIP(ctx, recreated))
+	codec, err = helper.FixedIPAllocator().GetFixedIP(ctx, recreated, nil)
+	assert.NoError(t, err)
+	codec.IPInfo.Status.Mark(types.IPStatusRetired)
+	codec.IPInfo.Attrs = &types.IPAttributes{RetiredBy: "other"}
+	updated, err = stor.UpdateElseGet(ctx, codec)
+	assert.NoError(t, err)
+	assert.True(t, updated)
+	// crashed after the fixed ip is locked, the record is recreated and retired by another unalloc since then
+	putIntent(ctx, t, stor, types.Intent{ID: "recreated", Operation: types.IntentUnallocFixedIP, IP: recreated})
+
+	recovered, err := helper.RecoverJournal(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, recovered)
+	assert.Equal(t, 0, countIntents(ctx, t, stor))
+
+	_, err = helper.FixedIPAllocator().GetFixedIP(ctx, retired, nil)
+	assert.Equal(t, types.ErrFixedIPNotAllocated, err)
+	calicoIPAllocator.AssertCalled(t, "UnallocIP", mock.Anything, retired)
+	calicoIPAllocator.AssertCalled(t, "UnallocIP", mock.Anything, deleted)
+
+	_, err = helper.FixedIPAllocator().GetFixedIP(ctx, untouched, nil)
+	assert.NoError(t, err)
+	calicoIPAllocator.AssertNotCalled(t, "UnallocIP", mock.Anything, untouched)
+
+	_, err = helper.FixedIPAllocator().GetFixedIP(ctx, recreated, nil)
+	assert.NoError(t, err)
+	calicoIPAllocator.AssertNotCalled(t, "UnallocIP", mock.Anything, recreated)
+}
+
+func TestUnallocFixedIPFailedHalfway(t *testing.T) {
+	var (
+		memoryStore = memory.NewMemoryStore()
+		stor        = &faultyStore{Store: memoryStore}
+		ip          = types.IP{PoolID: "poolID", Address: "10.10.10.10"}
+	)
+	calicoIPAllocator := mocks.CalicoIPAllocator{}
+	calicoIPAllocator.On("AllocIP", mock.Anything, mock.Anything).Return(nil)
+	calicoIPAllocator.On("UnallocIP", mock.Anything, mock.Anything).Return(nil)
+	helper := newJournalHelper(&calicoIPAllocator, stor)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(10)*time.Second)
+	defer cancel()
+
+	assert.NoError(t, helper.FixedIPAllocator().AllocFixedIP(ctx, ip))
+
+	// the record isn't deleted when the lock fails
+	stor.failUpdate = isIPInfo
+	assert.Error(t, helper.FixedIPAllocator().UnallocFixedIP(ctx, ip, false))
+	_, err := helper.FixedIPAllocator().GetFixedIP(ctx, ip, nil)
+	assert.NoError(t, err)
+	stor.failUpdate = nil
+	_, err = helper.RecoverJournal(ctx)
+	assert.NoError(t, err)
+
+	// nor when the step can't be recorded
+	stor.failPut = func(codec store.Codec) bool {
+		intent, ok := codec.(*codecs.IntentCodec)
+		return ok && intent.Intent.Step == types.IntentStepRecordDeleted
+	}
+	assert.Error(t, helper.FixedIPAllocator().UnallocFixedIP(ctx, ip, false))
+	codec, err := helper.FixedIPAllocator().GetFixedIP(ctx, ip, nil)
+	assert.NoError(t, err)
+	assert.True(t, codec.IPInfo.Status.Match(types.IPStatusRetired))
+	intents := codecs.IntentMultiGetCodec{HostName: "localhost"}
+	assert.NoError(t, stor.GetMulti(ctx, &intents))
+	assert.Len(t, intents.Codecs, 1)
+	assert.Equal(t, intents.Codecs[0].Intent.ID, codec.IPInfo.Attrs.RetiredBy)
+	calicoIPAllocator.AssertNotCalled(t, "UnallocIP", mock.Anything, ip)
+
+	// the locked record is unalloced on start
+	stor.failPut = nil
+	recovered, err := helper.RecoverJournal(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, recovered)
+	_, err = helper.FixedIPAllocator().GetFixedIP(ctx, ip, nil)
+	assert.Equal(t, types.ErrFixedIPNotAllocated, err)
+	calicoIPAllocator.AssertCalled(t, "UnallocIP", mock.Anything, ip)
+}
+
+// recordSink keeps events sent to it
+type recordSink struct {
+	mutex  sync.Mutex
+	events []events.Event
+}
+
+func (s *recordSink) Name() string {
+	return "record"
+}
+
+func (s *recordSink) Send(ctx context.Context, event events.Event) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *recordSink) Close() error {
+	return nil
+}
+
+func (s *recordSink) unallocated() []types.IP {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var ips []types.IP
+	for _, event := range s.events {
+		if event.Kind == events.FixedIPUnallocated {
+			ips = append(ips, *event.IP)
+		}
+	}
+	return ips
+}
+
+func TestFixedIPUnallocatedPublishedOnEveryPath(t *testing.T) {
+	stor := memory.NewMemoryStore()
+
+	calicoIPAllocator := mocks.CalicoIPAllocator{}
+	calicoIPAllocator.On("AllocIP", mock.Anything, mock.Anything).Return(nil)
+	calicoIPAllocator.On("UnallocIP", mock.Anything, mock.Anything).Return(nil)
+	helper := newJournalHelper(&calicoIPAllocator, stor).WithFixedIPRetention(time.Hour)
+
+	sink := &recordSink{}
+	bus := events.NewBus("localhost", 0, sink)
+	events.Init(bus)
+	defer events.Init(nil)
+	serveCtx, stop := context.WithCancel(context.Background())
+	served := make(chan struct{})
+	go func() {
+		_, err := bus.Serve(serveCtx)
+		assert.NoError(t, err)
+		close(served)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(6)*time.Second)
+	defer cancel()
+
+	// unalloced by request
+	unalloced := types.IP{PoolID: "poolID", Address: "10.10.10.10"}
+	assert.NoError(t, helper.FixedIPAllocator().AllocFixedIP(ctx, unalloced))
+	assert.NoError(t, helper.FixedIPAllocator().UnallocFixedIP(ctx, unalloced, false))
+
+	// swept after the retention expired
+	expired := types.IP{PoolID: "poolID", Address: "10.10.10.11"}
+	assert.NoError(t, helper.FixedIPAllocator().AllocFixedIP(ctx, expired))
+	assert.NoError(t, helper.RetainFixedIP(ctx, expired, "name"))
+	assert.NoError(t, stor.Delete(ctx, &codecs.FixedIPRetentionCodec{Retention: &types.FixedIPRetention{Owner: "localhost/name", IP: expired}}))
+	swept, err := helper.SweepRetainedFixedIPs(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, swept)
+
+	// replayed on start
+	replayed := types.IP{PoolID: "poolID", Address: "10.10.10.12"}
+	putIntent(ctx, t, stor, types.Intent{
+		ID: "replayed", Operation: types.IntentUnallocFixedIP, Step: types.IntentStepRecordDeleted, IP: replayed,
+	})
+	recovered, err := helper.RecoverJournal(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, recovered)
+
+	// repaired by reconciler
+	repaired := types.IP{PoolID: "poolID", Address: "10.10.10.13"}
+	retired := types.IPInfo{PoolID: repaired.PoolID, Address: repaired.Address}
+	retired.Status.Mark(types.IPStatusInUse, types.IPStatusRetired)
+	codec := &codecs.IPInfoCodec{IPInfo: &retired}
+	assert.NoError(t, stor.Put(ctx, codec))
+	r := NewReconciler(helper, &dockerMocks.Client{}, ReconcilerConfig{}).(*reconciler)
+	assert.NoError(t, r.repair(ctx, drift{kind: driftRetiredIP, version: codec.Version(), ip: repaired}))
+
+	stop()
+	<-served
+	assert.NoError(t, bus.Dispose(ctx))
+	assert.Equal(t, []types.IP{unalloced, expired, replayed, repaired}, sink.unallocated())
+}
@@ -0,0 +1,129 @@
+package vessel
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/projecteru2/barrel/service"
+	"github.com/projecteru2/barrel/store"
+	"github.com/projecteru2/barrel/types"
+	"github.com/projecteru2/barrel/vessel/codecs"
+)
+
+const (
+	defaultHostLivenessTTL = 30 * time.Second
+)
+
+// IsHostAlive checks whether barrel of the host is running
+func (helper Helper) IsHostAlive(ctx context.Context, hostname string) (bool, error) {
+	liveness := types.HostLiveness{HostName: hostname}
+	if err := helper.Get(ctx, &codecs.HostLivenessCodec{Liveness: &liveness}); err != nil {
+		if store.IsNotExists(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// IsLeader tells whether the host leads the role, the lead is taken when nobody leads or the leader isn't alive,
+// so that cluster-wide jobs of the role are done by one live host
+func (helper Helper) IsLeader(ctx context.Context, role string) (bool, error) {
+	logger := helper.logger("IsLeader").WithField("role", role)
+
+	hostname := helper.Hostname()
+	leader := types.Leader{Role: role}
+	codec := &codecs.LeaderCodec{Leader: &leader}
+	if err := helper.Get(ctx, codec); store.ErrButOtherThenKVUnexistsErr(err) {
+		return false, err
+	}
+	if leader.HostName == hostname {
+		return true, nil
+	}
+	if leader.HostName != "" {
+		alive, err := helper.IsHostAlive(ctx, leader.HostName)
+		if err != nil || alive {
+			return false, err
+		}
+	}
+	previous := leader.HostName
+	leader.HostName = hostname
+	// version 0 creates the record, others may take the lead in the meantime
+	ok, err := helper.UpdateElseGet(ctx, codec)
+	if err != nil {
+		if store.IsNotExists(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if ok {
+		logger.Infof("take the lead from %q", previous)
+	}
+	return ok, nil
+}
+
+type hostLiveness struct {
+	helper Helper
+	ttl    time.Duration
+	lease  store.LeaseID
+}
+
+// NewHostLiveness keeps the liveness key of the host alive while barrel is running,
+// the key is removed on shutdown, or expires after ttl when barrel crashes
+func NewHostLiveness(helper Helper, ttl time.Duration) service.Service {
+	if ttl <= 0 {
+		ttl = defaultHostLivenessTTL
+	}
+	return &hostLiveness{helper: helper, ttl: ttl}
+}
+
+func (l *hostLiveness) Serve(ctx context.Context) (service.Disposable, error) {
+	logger := l.logger("Serve")
+	logger.Infof("starting, ttl = %v", l.ttl)
+
+	startedAt := time.Now().UnixNano()
+	for {
+		done, err := l.keepAlive(ctx, startedAt)
+		if err != nil {
+			logger.WithError(err).Error("keep host liveness error")
+		} else {
+			<-done
+		}
+		select {
+		case <-ctx.Done():
+			logger.Info("Done")
+			return l, nil
+		case <-time.After(l.ttl / 3):
+			logger.Warn("host liveness is lost, register again")
+		}
+	}
+}
+
+func (l *hostLiveness) keepAlive(ctx context.Context, startedAt int64) (<-chan struct{}, error) {
+	lease, err := l.helper.Grant(ctx, l.ttl)
+	if err != nil {
+		return nil, err
+	}
+	liveness := types.HostLiveness{HostName: l.helper.Hostname(), StartedAt: startedAt}
+	if err = l.helper.PutWithLease(ctx, &codecs.HostLivenessCodec{Liveness: &liveness}, lease); err != nil {
+		return nil, err
+	}
+	l.lease = lease
+	return l.helper.KeepAlive(ctx, lease)
+}
+
+func (l *hostLiveness) Dispose(ctx context.Context) error {
+	if l.lease == 0 {
+		return nil
+	}
+	if err := l.helper.Revoke(ctx, l.lease); err != nil && err != store.ErrLeaseNotFound {
+		return err
+	}
+	return nil
+}
+
+func (l *hostLiveness) logger(method string) *log.Entry {
+	return log.WithField("Receiver", "hostLiveness").WithField("Method", method)
+}
@@ -149,6 +149,27 @@ func (_m *CalicoIPAllocator) GetPoolsByCIDRS(ctx context.Context, cidr []string)
 	return r0, r1
 }
 
+// IsIPAllocated provides a mock function with given fields: ctx, ip
+func (_m *CalicoIPAllocator) IsIPAllocated(ctx context.Context, ip types.IP) (bool, error) {
+	ret := _m.Called(ctx, ip)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context, types.IP) bool); ok {
+		r0 = rf(ctx, ip)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, types.IP) error); ok {
+		r1 = rf(ctx, ip)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // UnallocIP provides a mock function with given fields: ctx, ip
 func (_m *CalicoIPAllocator) UnallocIP(ctx context.Context, ip types.IP) error {
 	ret := _m.Called(ctx, ip)
@@ -162,3 +183,17 @@ func (_m *CalicoIPAllocator) UnallocIP(ctx context.Context, ip types.IP) error {
 
 	return r0
 }
+
+// UnallocIPByHandle provides a mock function with given fields: ctx, handle
+func (_m *CalicoIPAllocator) UnallocIPByHandle(ctx context.Context, handle string) error {
+	ret := _m.Called(ctx, handle)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, handle)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
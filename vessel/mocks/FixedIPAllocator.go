@@ -212,6 +212,27 @@ func (_m *FixedIPAllocator) GetPoolsByCIDRS(ctx context.Context, cidr []string)
 	return r0, r1
 }
 
+// IsIPAllocated provides a mock function with given fields: ctx, ip
+func (_m *FixedIPAllocator) IsIPAllocated(ctx context.Context, ip types.IP) (bool, error) {
+	ret := _m.Called(ctx, ip)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context, types.IP) bool); ok {
+		r0 = rf(ctx, ip)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, types.IP) error); ok {
+		r1 = rf(ctx, ip)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // ReturnFixedIP provides a mock function with given fields: _a0, _a1, _a2
 func (_m *FixedIPAllocator) ReturnFixedIP(_a0 context.Context, _a1 types.IP, _a2 types.Container) error {
 	ret := _m.Called(_a0, _a1, _a2)
@@ -254,6 +275,20 @@ func (_m *FixedIPAllocator) UnallocIP(ctx context.Context, ip types.IP) error {
 	return r0
 }
 
+// UnallocIPByHandle provides a mock function with given fields: ctx, handle
+func (_m *FixedIPAllocator) UnallocIPByHandle(ctx context.Context, handle string) error {
+	ret := _m.Called(ctx, handle)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, handle)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // UnassignFixedIP provides a mock function with given fields: _a0, _a1
 func (_m *FixedIPAllocator) UnassignFixedIP(_a0 context.Context, _a1 types.IP) error {
 	ret := _m.Called(_a0, _a1)
@@ -0,0 +1,418 @@
+package vessel
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/juju/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/projecteru2/barrel/docker"
+	"github.com/projecteru2/barrel/service"
+	"github.com/projecteru2/barrel/store"
+	"github.com/projecteru2/barrel/types"
+	"github.com/projecteru2/barrel/vessel/codecs"
+)
+
+// ReconcileMode .
+type ReconcileMode string
+
+const (
+	// ReconcileModeRepair detects and repairs drift
+	ReconcileModeRepair ReconcileMode = "repair"
+	// ReconcileModeDryRun logs the repairs that would be made, without making them
+	ReconcileModeDryRun ReconcileMode = "dry-run"
+	// ReconcileModeReportOnly only reports the detected drift
+	ReconcileModeReportOnly ReconcileMode = "report-only"
+
+	defaultReconcileInterval   = 5 * time.Minute
+	defaultReconcileTimeout    = time.Minute
+	defaultReconcileWatchDelay = 10 * time.Second
+
+	// role of the host reconciling cluster-wide drifts
+	reconcilerRole = "reconciler"
+)
+
+// ParseReconcileMode .
+func ParseReconcileMode(mode string) (ReconcileMode, error) {
+	switch m := ReconcileMode(mode); m {
+	case ReconcileModeRepair, ReconcileModeDryRun, ReconcileModeReportOnly:
+		return m, nil
+	default:
+		return "", errors.Errorf("unrecognized reconcile mode %s, support only [ repair | dry-run | report-only ]", mode)
+	}
+}
+
+// ReconcilerConfig .
+type ReconcilerConfig struct {
+	Mode     ReconcileMode
+	Interval time.Duration
+	Timeout  time.Duration
+	// WatchDelay is how long the reconciler waits after observing changes of fixed ips
+	// and container records before starting a round, so changes in progress can settle
+	WatchDelay time.Duration
+}
+
+type driftKind string
+
+// retired and unallocated ips are cluster-wide drifts, which are detected by the leader only,
+// others are drifts of the host
+const (
+	driftRetiredIP            driftKind = "retired-ip"
+	driftDanglingBorrower     driftKind = "dangling-borrower"
+	driftStaleContainerRecord driftKind = "stale-container-record"
+	driftUnallocatedIP        driftKind = "unallocated-ip"
+)
+
+type drift struct {
+	kind      driftKind
+	version   int64
+	ip        types.IP
+	container types.Container
+	// the ip is bound to a fixed-ip key, so it's kept after returned
+	keyed bool
+	// identity of the retirement of a retired ip
+	retiredBy string
+}
+
+func (d drift) id() string {
+	return fmt.Sprintf("%s:%s:%s:%s:%s", d.kind, d.ip.PoolID, d.ip.Address, d.container.ID, d.retiredBy)
+}
+
+// suspect is a drift waiting to be confirmed
+type suspect struct {
+	version    int64
+	detectedAt time.Time
+}
+
+type reconcileReport struct {
+	drifts   map[driftKind]int
+	pending  int
+	repaired int
+	failed   int
+}
+
+type reconciler struct {
+	helper       Helper
+	dockerClient docker.Client
+	mode         ReconcileMode
+	interval     time.Duration
+	timeout      time.Duration
+	watchDelay   time.Duration
+	// drifts found in former rounds, a drift is only repaired when it's found again
+	// with the same version at least an interval later, so we won't interfere with
+	// operations in progress, even when rounds are started by changes observed
+	suspects map[string]suspect
+}
+
+// NewReconciler .
+func NewReconciler(helper Helper, dockerCli docker.Client, config ReconcilerConfig) service.Service {
+	r := &reconciler{
+		helper:       helper,
+		dockerClient: dockerCli,
+		mode:         config.Mode,
+		interval:     config.Interval,
+		timeout:      config.Timeout,
+		watchDelay:   config.WatchDelay,
+		suspects:     make(map[string]suspect),
+	}
+	if r.mode == "" {
+		r.mode = ReconcileModeRepair
+	}
+	if r.interval <= 0 {
+		r.interval = defaultReconcileInterval
+	}
+	if r.timeout <= 0 {
+		r.timeout = defaultReconcileTimeout
+	}
+	if r.watchDelay <= 0 {
+		r.watchDelay = defaultReconcileWatchDelay
+	}
+	return r
+}
+
+func (r *reconciler) Serve(ctx context.Context) (service.Disposable, error) {
+	logger := r.logger("Serve")
+	logger.Infof("starting, mode = %s, interval = %v", r.mode, r.interval)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	changes := make(chan struct{}, 1)
+	go r.watch(ctx, codecs.IPInfoPrefix(""), changes)
+	go r.watch(ctx, codecs.ContainerInfoPrefix(r.helper.Hostname()), changes)
+	for {
+		r.reconcile(ctx)
+		if !r.wait(ctx, ticker.C, changes) {
+			logger.Info("Done")
+			return r, nil
+		}
+	}
+}
+
+// wait returns on next tick, or watchDelay after changes observed,
+// returns false when ctx is done
+func (r *reconciler) wait(ctx context.Context, tick <-chan time.Time, changes <-chan struct{}) bool {
+	var delay <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-tick:
+			return true
+		case <-changes:
+			if delay == nil {
+				delay = time.After(r.watchDelay)
+			}
+		case <-delay:
+			r.logger("wait").Info("changes observed, start a round")
+			return true
+		}
+	}
+}
+
+// watch signals changes of keys with the prefix, the watch is recreated when broken
+func (r *reconciler) watch(ctx context.Context, prefix string, changes chan<- struct{}) {
+	logger := r.logger("watch").WithField("prefix", prefix)
+	for {
+		for event := range r.helper.Watch(ctx, prefix) {
+			if event.Err != nil {
+				logger.WithError(event.Err).Error("watch error")
+				break
+			}
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.watchDelay):
+			logger.Info("rewatch")
+		}
+	}
+}
+
+func (r *reconciler) Dispose(ctx context.Context) error {
+	return nil
+}
+
+func (r *reconciler) reconcile(ctx context.Context) reconcileReport {
+	logger := r.logger("reconcile")
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	report := reconcileReport{drifts: make(map[driftKind]int)}
+	drifts, err := r.detect(ctx)
+	if err != nil {
+		logger.WithError(err).Error("detect drift error")
+		return report
+	}
+
+	now := time.Now()
+	suspects := make(map[string]suspect)
+	for _, d := range drifts {
+		report.drifts[d.kind]++
+		entry := logger.WithField("kind", d.kind).WithField("fixed-ip", d.ip).WithField("container", d.container.ID)
+		if r.mode == ReconcileModeReportOnly {
+			entry.Warn("drift detected")
+			continue
+		}
+		s, ok := r.suspects[d.id()]
+		if !ok || s.version != d.version {
+			entry.Info("drift detected, will be repaired an interval later if it still exists")
+			suspects[d.id()] = suspect{version: d.version, detectedAt: now}
+			report.pending++
+			continue
+		}
+		if now.Sub(s.detectedAt) < r.interval {
+			suspects[d.id()] = s
+			report.pending++
+			continue
+		}
+		if r.mode == ReconcileModeDryRun {
+			entry.Warn("dry-run, drift would be repaired")
+			continue
+		}
+		if err := r.repair(ctx, d); err != nil {
+			entry.WithError(err).Error("repair drift error")
+			report.failed++
+			continue
+		}
+		entry.Info("drift repaired")
+		report.repaired++
+	}
+	r.suspects = suspects
+
+	logger.Infof(
+		"round end, drifts = %v, pending = %d, repaired = %d, failed = %d",
+		report.drifts, report.pending, report.repaired, report.failed,
+	)
+	return report
+}
+
+func (r *reconciler) detect(ctx context.Context) ([]drift, error) {
+	var (
+		hostname   = r.helper.Hostname()
+		containers = make(map[string]struct{})
+		records    = make(map[string]struct{})
+		drifts     []drift
+	)
+
+	dockerContainers, err := r.dockerClient.ContainerList(ctx, dockerTypes.ContainerListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+	for _, container := range dockerContainers {
+		containers[container.ID] = struct{}{}
+	}
+
+	infos, err := r.helper.ContainerVessel().ListContainers()
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		records[info.ID] = struct{}{}
+		if _, ok := containers[info.ID]; !ok {
+			drifts = append(drifts, drift{kind: driftStaleContainerRecord, container: info.Container})
+		}
+	}
+
+	leader, err := r.helper.IsLeader(ctx, reconcilerRole)
+	if err != nil {
+		return nil, err
+	}
+	fixedIPs, err := r.helper.ListFixedIPs(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	keyed, err := r.keyedFixedIPs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, codec := range fixedIPs {
+		var (
+			ipInfo  = codec.IPInfo
+			ip      = types.IP{PoolID: ipInfo.PoolID, Address: ipInfo.Address}
+			version = codec.Version()
+		)
+		if ipInfo.Status.Match(types.IPStatusRetired) {
+			// crashed halfway through UnallocFixedIP
+			if leader {
+				drifts = append(drifts, drift{kind: driftRetiredIP, version: version, ip: ip, retiredBy: retiredBy(ipInfo)})
+			}
+			continue
+		}
+		if ipInfo.Attrs != nil {
+			for _, borrower := range ipInfo.Attrs.Borrowers {
+				if borrower.HostName != hostname {
+					continue
+				}
+				_, hasContainer := containers[borrower.ID]
+				_, hasRecord := records[borrower.ID]
+				// borrowers with a container record is released with the record
+				if !hasContainer && !hasRecord {
+					drifts = append(drifts, drift{
+						kind:      driftDanglingBorrower,
+						version:   version,
+						ip:        ip,
+						container: borrower,
+						keyed:     keyed[ip],
+					})
+				}
+			}
+		}
+		if !leader {
+			continue
+		}
+		allocated, err := r.helper.FixedIPAllocator().IsIPAllocated(ctx, ip)
+		if err != nil {
+			r.logger("detect").WithError(err).WithField("fixed-ip", ip).Error("check calico allocation error")
+			continue
+		}
+		if !allocated {
+			drifts = append(drifts, drift{kind: driftUnallocatedIP, version: version, ip: ip})
+		}
+	}
+	return drifts, nil
+}
+
+func (r *reconciler) keyedFixedIPs(ctx context.Context) (map[types.IP]bool, error) {
+	fixedIPKeys, err := r.helper.ListFixedIPKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keyed := make(map[types.IP]bool)
+	for _, fixedIPKey := range fixedIPKeys {
+		for _, address := range fixedIPKey.Addresses {
+			keyed[address] = true
+		}
+	}
+	return keyed, nil
+}
+
+func (r *reconciler) repair(ctx context.Context, d drift) error {
+	allocator := r.helper.FixedIPAllocator()
+	switch d.kind {
+	case driftRetiredIP:
+		// finish the unalloc, unless the record is written again since detected,
+		// the version alone can't tell as it starts over once the record is recreated
+		codec, err := allocator.GetFixedIP(ctx, d.ip, nil)
+		if err == types.ErrFixedIPNotAllocated {
+			// the unalloc is finished by others
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ipInfo := codec.IPInfo
+		if !ipInfo.Status.Match(types.IPStatusRetired) || codec.Version() != d.version || retiredBy(ipInfo) != d.retiredBy {
+			return errors.Errorf("fixed-ip is changed since detected, version = %d", codec.Version())
+		}
+		ok, err := r.helper.DeleteElseGet(ctx, codec)
+		if err == store.ErrKVNotExists {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.Errorf("fixed-ip is changed since detected, version = %d", codec.Version())
+		}
+		return unallocFixedIPAddress(ctx, allocator, d.ip)
+	case driftDanglingBorrower:
+		if err := allocator.ReturnFixedIP(ctx, d.ip, d.container); err != nil {
+			return err
+		}
+		if d.keyed {
+			return nil
+		}
+		if err := allocator.UnallocFixedIP(ctx, d.ip, false); err != nil &&
+			err != types.ErrFixedIPHasBorrower && err != types.ErrIPInUse {
+			return err
+		}
+		return nil
+	case driftStaleContainerRecord:
+		return r.helper.ReleaseContainerAddresses(ctx, d.container.ID)
+	case driftUnallocatedIP:
+		// reserve the address in calico again, so it won't be handed out to others
+		return allocator.AllocIP(ctx, d.ip)
+	default:
+		return errors.Errorf("unknown drift kind %s", d.kind)
+	}
+}
+
+// retiredBy is blank for ips retired before the identity is recorded
+func retiredBy(ipInfo *types.IPInfo) string {
+	if ipInfo.Attrs == nil {
+		return ""
+	}
+	return ipInfo.Attrs.RetiredBy
+}
+
+func (r *reconciler) logger(method string) *log.Entry {
+	return log.WithField("Receiver", "reconciler").WithField("Method", method)
+}
@@ -0,0 +1,219 @@
+package vessel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	dockerMocks "github.com/projecteru2/barrel/docker/mocks"
+	barrelEtcd "github.com/projecteru2/barrel/etcd"
+	"github.com/projecteru2/barrel/store"
+	etcdStore "github.com/projecteru2/barrel/store/etcd"
+	"github.com/projecteru2/barrel/store/memory"
+	"github.com/projecteru2/barrel/types"
+	"github.com/projecteru2/barrel/vessel/codecs"
+	"github.com/projecteru2/barrel/vessel/mocks"
+)
+
+// ageSuspects makes suspects detected an interval ago, so they are confirmed in the next round
+func ageSuspects(r *reconciler) {
+	for id, s := range r.suspects {
+		s.detectedAt = s.detectedAt.Add(-r.interval)
+		r.suspects[id] = s
+	}
+}
+
+func TestReconcileRepair(t *testing.T) {
+	stor := etcdStore.NewEtcdStore(barrelEtcd.NewEmbedEtcd(t).Client())
+
+	calicoIPAllocator := mocks.CalicoIPAllocator{}
+	calicoIPAllocator.On("IsIPAllocated", mock.Anything, mock.Anything).Return(true, nil)
+	calicoIPAllocator.On("UnallocIP", mock.Anything, mock.Anything).Return(nil)
+
+	dockerClient := dockerMocks.Client{}
+	dockerClient.On("ContainerList", mock.Anything, mock.Anything).Return([]dockerTypes.Container{}, nil)
+
+	helper := newTestHelper(&calicoIPAllocator, stor)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(6)*time.Second)
+	defer cancel()
+
+	retired := types.IPInfo{PoolID: "poolID", Address: "10.10.10.10"}
+	retired.Status.Mark(types.IPStatusInUse, types.IPStatusRetired)
+	assert.NoError(t, stor.Put(ctx, &codecs.IPInfoCodec{IPInfo: &retired}))
+
+	record := types.ContainerInfo{Container: types.Container{ID: "containerID", HostName: "localhost"}}
+	assert.NoError(t, stor.Put(ctx, &codecs.ContainerInfoCodec{Info: &record}))
+
+	r := NewReconciler(helper, &dockerClient, ReconcilerConfig{Mode: ReconcileModeRepair}).(*reconciler)
+
+	report := r.reconcile(ctx)
+	assert.Equal(t, 1, report.drifts[driftRetiredIP])
+	assert.Equal(t, 1, report.drifts[driftStaleContainerRecord])
+	assert.Equal(t, 2, report.pending)
+	assert.Equal(t, 0, report.repaired)
+
+	// drifts are confirmed no sooner than an interval
+	report = r.reconcile(ctx)
+	assert.Equal(t, 2, report.pending)
+	assert.Equal(t, 0, report.repaired)
+
+	ageSuspects(r)
+	report = r.reconcile(ctx)
+	assert.Equal(t, 2, report.repaired)
+	assert.Equal(t, 0, report.failed)
+
+	assert.Equal(t, store.ErrKVNotExists, stor.Get(ctx, &codecs.IPInfoCodec{IPInfo: &retired}))
+	assert.Equal(t, store.ErrKVNotExists, stor.Get(ctx, &codecs.ContainerInfoCodec{Info: &record}))
+	calicoIPAllocator.AssertCalled(t, "UnallocIP", mock.Anything, types.IP{PoolID: "poolID", Address: "10.10.10.10"})
+}
+
+func TestReconcileDryRun(t *testing.T) {
+	stor := etcdStore.NewEtcdStore(barrelEtcd.NewEmbedEtcd(t).Client())
+
+	calicoIPAllocator := mocks.CalicoIPAllocator{}
+	calicoIPAllocator.On("IsIPAllocated", mock.Anything, mock.Anything).Return(false, nil)
+
+	dockerClient := dockerMocks.Client{}
+	dockerClient.On("ContainerList", mock.Anything, mock.Anything).Return([]dockerTypes.Container{}, nil)
+
+	helper := newTestHelper(&calicoIPAllocator, stor)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(6)*time.Second)
+	defer cancel()
+
+	ipInfo := types.IPInfo{
+		PoolID:  "poolID",
+		Address: "10.10.10.10",
+		Attrs: &types.IPAttributes{
+			Borrowers: []types.Container{{ID: "containerID", HostName: "localhost"}},
+		},
+	}
+	assert.NoError(t, stor.Put(ctx, &codecs.IPInfoCodec{IPInfo: &ipInfo}))
+
+	r := NewReconciler(helper, &dockerClient, ReconcilerConfig{Mode: ReconcileModeDryRun}).(*reconciler)
+	r.reconcile(ctx)
+	ageSuspects(r)
+	report := r.reconcile(ctx)
+	assert.Equal(t, 1, report.drifts[driftDanglingBorrower])
+	assert.Equal(t, 1, report.drifts[driftUnallocatedIP])
+	assert.Equal(t, 0, report.repaired)
+
+	codec := codecs.IPInfoCodec{IPInfo: &types.IPInfo{PoolID: "poolID", Address: "10.10.10.10"}}
+	assert.NoError(t, stor.Get(ctx, &codec))
+	assert.Equal(t, 1, len(codec.IPInfo.Attrs.Borrowers))
+	calicoIPAllocator.AssertNotCalled(t, "AllocIP", mock.Anything, mock.Anything)
+}
+
+func TestReconcilerWakesUpOnChanges(t *testing.T) {
+	stor := memory.NewMemoryStore()
+	helper := NewHelper(vessel{
+		hostname:        "localhost",
+		containerVessel: NewContainerVessel("localhost", stor),
+	}, stor)
+	r := NewReconciler(helper, &dockerMocks.Client{}, ReconcilerConfig{WatchDelay: 100 * time.Millisecond}).(*reconciler)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(6)*time.Second)
+	defer cancel()
+
+	changes := make(chan struct{}, 1)
+	go r.watch(ctx, codecs.ContainerInfoPrefix("localhost"), changes)
+	// the watch is established asynchronously
+	time.Sleep(100 * time.Millisecond)
+
+	record := types.ContainerInfo{Container: types.Container{ID: "containerID", HostName: "localhost"}}
+	assert.NoError(t, stor.Put(ctx, &codecs.ContainerInfoCodec{Info: &record}))
+
+	start := time.Now()
+	assert.True(t, r.wait(ctx, nil, changes))
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+
+	cancel()
+	assert.False(t, r.wait(ctx, nil, changes))
+}
+
+func TestReconcileClusterWideDriftsByLeader(t *testing.T) {
+	stor := memory.NewMemoryStore()
+
+	calicoIPAllocator := mocks.CalicoIPAllocator{}
+	calicoIPAllocator.On("IsIPAllocated", mock.Anything, mock.Anything).Return(false, nil)
+
+	dockerClient := dockerMocks.Client{}
+	dockerClient.On("ContainerList", mock.Anything, mock.Anything).Return([]dockerTypes.Container{}, nil)
+
+	helper := newTestHelper(&calicoIPAllocator, stor)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(6)*time.Second)
+	defer cancel()
+
+	retired := types.IPInfo{PoolID: "poolID", Address: "10.10.10.10"}
+	retired.Status.Mark(types.IPStatusInUse, types.IPStatusRetired)
+	assert.NoError(t, stor.Put(ctx, &codecs.IPInfoCodec{IPInfo: &retired}))
+	assert.NoError(t, stor.Put(ctx, &codecs.IPInfoCodec{IPInfo: &types.IPInfo{PoolID: "poolID", Address: "10.10.10.11"}}))
+
+	// another live host leads
+	assert.NoError(t, stor.Put(ctx, &codecs.LeaderCodec{Leader: &types.Leader{Role: reconcilerRole, HostName: "other"}}))
+	liveness := &codecs.HostLivenessCodec{Liveness: &types.HostLiveness{HostName: "other"}}
+	assert.NoError(t, stor.Put(ctx, liveness))
+
+	r := NewReconciler(helper, &dockerClient, ReconcilerConfig{Mode: ReconcileModeRepair}).(*reconciler)
+	report := r.reconcile(ctx)
+	assert.Equal(t, 0, report.drifts[driftRetiredIP])
+	assert.Equal(t, 0, report.drifts[driftUnallocatedIP])
+	calicoIPAllocator.AssertNotCalled(t, "IsIPAllocated", mock.Anything, mock.Anything)
+
+	// the lead is taken after the leader is gone
+	assert.NoError(t, stor.Delete(ctx, liveness))
+	report = r.reconcile(ctx)
+	assert.Equal(t, 1, report.drifts[driftRetiredIP])
+	assert.Equal(t, 1, report.drifts[driftUnallocatedIP])
+
+	leader := types.Leader{Role: reconcilerRole}
+	assert.NoError(t, stor.Get(ctx, &codecs.LeaderCodec{Leader: &leader}))
+	assert.Equal(t, "localhost", leader.HostName)
+}
+
+func TestRepairRetiredIPChangedSinceDetected(t *testing.T) {
+	stor := memory.NewMemoryStore()
+
+	calicoIPAllocator := mocks.CalicoIPAllocator{}
+	helper := newTestHelper(&calicoIPAllocator, stor)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(6)*time.Second)
+	defer cancel()
+
+	ip := types.IP{PoolID: "poolID", Address: "10.10.10.10"}
+	retire := func(retiredBy string) int64 {
+		retired := types.IPInfo{PoolID: ip.PoolID, Address: ip.Address, Attrs: &types.IPAttributes{RetiredBy: retiredBy}}
+		retired.Status.Mark(types.IPStatusInUse, types.IPStatusRetired)
+		codec := &codecs.IPInfoCodec{IPInfo: &retired}
+		assert.NoError(t, stor.Put(ctx, codec))
+		return codec.Version()
+	}
+	r := NewReconciler(helper, &dockerMocks.Client{}, ReconcilerConfig{}).(*reconciler)
+
+	// another host allocates the ip again after detected
+	d := drift{kind: driftRetiredIP, version: retire("detected"), ip: ip, retiredBy: "detected"}
+	assert.NoError(t, stor.Delete(ctx, &codecs.IPInfoCodec{IPInfo: &types.IPInfo{PoolID: ip.PoolID, Address: ip.Address}}))
+	assert.NoError(t, stor.Put(ctx, &codecs.IPInfoCodec{IPInfo: &types.IPInfo{PoolID: ip.PoolID, Address: ip.Address}}))
+	assert.NoError(t, stor.Put(ctx, &codecs.IPInfoCodec{IPInfo: &types.IPInfo{PoolID: ip.PoolID, Address: ip.Address}}))
+	assert.Error(t, r.repair(ctx, d))
+	assert.NoError(t, stor.Get(ctx, &codecs.IPInfoCodec{IPInfo: &types.IPInfo{PoolID: ip.PoolID, Address: ip.Address}}))
+
+	// the recreated record is retired by another unalloc at the same version
+	assert.NoError(t, stor.Delete(ctx, &codecs.IPInfoCodec{IPInfo: &types.IPInfo{PoolID: ip.PoolID, Address: ip.Address}}))
+	d = drift{kind: driftRetiredIP, version: retire("detected"), ip: ip, retiredBy: "detected"}
+	assert.NoError(t, stor.Delete(ctx, &codecs.IPInfoCodec{IPInfo: &types.IPInfo{PoolID: ip.PoolID, Address: ip.Address}}))
+	assert.Equal(t, d.version, retire("other"))
+	assert.Error(t, r.repair(ctx, d))
+	assert.NoError(t, stor.Get(ctx, &codecs.IPInfoCodec{IPInfo: &types.IPInfo{PoolID: ip.PoolID, Address: ip.Address}}))
+
+	// the unalloc is finished by others
+	assert.NoError(t, stor.Delete(ctx, &codecs.IPInfoCodec{IPInfo: &types.IPInfo{PoolID: ip.PoolID, Address: ip.Address}}))
+	assert.NoError(t, r.repair(ctx, d))
+	calicoIPAllocator.AssertNotCalled(t, "UnallocIP", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,189 @@
+package vessel
+
+import (
+	"context"
+	"time"
+
+	"github.com/projecteru2/barrel/metrics"
+	"github.com/projecteru2/barrel/store"
+	"github.com/projecteru2/barrel/types"
+	"github.com/projecteru2/barrel/vessel/codecs"
+)
+
+const (
+	// claims of fixed ips bound to keys expire after this when the creation reservation is disabled
+	defaultFixedIPClaimTTL = 5 * time.Minute
+)
+
+// WithFixedIPReservation returns a helper which holds fixed ips requested by container creating
+// during ttl, fixed ips not borrowed by the created container in time are unalloced by sweeper
+func (helper Helper) WithFixedIPReservation(ttl time.Duration) Helper {
+	helper.reservation = ttl
+	return helper
+}
+
+// FixedIPReservation .
+func (helper Helper) FixedIPReservation() time.Duration {
+	return helper.reservation
+}
+
+// ReserveFixedIPForCreation marks the fixed ip pending until the creating container borrows it,
+// the reservation expires when barrel crashes in the meantime, then the fixed ip is swept
+func (helper Helper) ReserveFixedIPForCreation(ctx context.Context, ip types.IP) error {
+	if helper.reservation <= 0 {
+		return nil
+	}
+	// the reservation record must exists before the fixed ip is marked as pending,
+	// otherwise the sweeper may treat the reservation as expired
+	reservation := types.FixedIPReservation{HostName: helper.Hostname(), IP: ip}
+	if err := helper.PutWithTTL(ctx, &codecs.FixedIPReservationCodec{Reservation: &reservation}, helper.reservation); err != nil {
+		return err
+	}
+
+	cnt := 0
+	for cnt < retryMaxCount {
+		codec, err := helper.FixedIPAllocator().GetFixedIP(ctx, ip, nil)
+		if err != nil {
+			return err
+		}
+		ipInfo := codec.IPInfo
+		if ipInfo.Status.Match(types.IPStatusInUse) {
+			return types.ErrIPInUse
+		}
+		if ipInfo.Status.Match(types.IPStatusPending) {
+			return nil
+		}
+		ipInfo.Status.Mark(types.IPStatusPending)
+		if ok, err := helper.UpdateElseGet(ctx, codec); err != nil {
+			return err
+		} else if ok {
+			return nil
+		}
+		metrics.ObserveCASRetry("ReserveFixedIPForCreation")
+		cnt++
+	}
+	metrics.ObserveCASRetryExceeded("ReserveFixedIPForCreation")
+	return types.ErrMaxRetryCountExceeded
+}
+
+// ClaimFixedIPForCreation marks the fixed ip bound to a key pending, so it's reused by one creation at a time,
+// the claim is held by a reservation as well, and taken over once the reservation expired
+func (helper Helper) ClaimFixedIPForCreation(ctx context.Context, ip types.IP) error {
+	ttl := helper.reservation
+	if ttl <= 0 {
+		ttl = defaultFixedIPClaimTTL
+	}
+	reservation := types.FixedIPReservation{HostName: helper.Hostname(), IP: ip}
+
+	cnt := 0
+	for cnt < retryMaxCount {
+		codec, err := helper.FixedIPAllocator().GetFixedIP(ctx, ip, nil)
+		if err != nil {
+			return err
+		}
+		ipInfo := codec.IPInfo
+		if ipInfo.Status.Match(types.IPStatusInUse) {
+			return types.ErrIPInUse
+		}
+		if ipInfo.Attrs != nil && len(ipInfo.Attrs.Borrowers) > 0 {
+			return types.ErrFixedIPKeyInUse
+		}
+		if ipInfo.Status.Match(types.IPStatusPending) {
+			// held by another creation in progress, unless the creation is gone with barrel crashed
+			held := types.FixedIPReservation{IP: ip}
+			if err := helper.Get(ctx, &codecs.FixedIPReservationCodec{Reservation: &held}); err == nil {
+				return types.ErrFixedIPKeyInUse
+			} else if store.ErrButOtherThenKVUnexistsErr(err) {
+				return err
+			}
+		}
+		// the reservation record must exists before the fixed ip is marked as pending,
+		// otherwise the sweeper may treat the reservation as expired
+		if err := helper.PutWithTTL(ctx, &codecs.FixedIPReservationCodec{Reservation: &reservation}, ttl); err != nil {
+			return err
+		}
+		ipInfo.Status.Mark(types.IPStatusPending)
+		if ok, err := helper.UpdateElseGet(ctx, codec); err != nil {
+			return err
+		} else if ok {
+			return nil
+		}
+		metrics.ObserveCASRetry("ClaimFixedIPForCreation")
+		cnt++
+	}
+	metrics.ObserveCASRetryExceeded("ClaimFixedIPForCreation")
+	return types.ErrMaxRetryCountExceeded
+}
+
+// ReleaseFixedIPReservation removes the reservation or the claim of the fixed ip,
+// it's called when the container is recorded or the creation is rolled back
+func (helper Helper) ReleaseFixedIPReservation(ctx context.Context, ip types.IP) error {
+	cnt := 0
+	for cnt < retryMaxCount {
+		codec, err := helper.FixedIPAllocator().GetFixedIP(ctx, ip, nil)
+		if err == types.ErrFixedIPNotAllocated {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !codec.IPInfo.Status.Match(types.IPStatusPending) {
+			break
+		}
+		codec.IPInfo.Status.Unmark(types.IPStatusPending)
+		if ok, err := helper.UpdateElseGet(ctx, codec); err != nil {
+			return err
+		} else if ok {
+			break
+		}
+		metrics.ObserveCASRetry("ReleaseFixedIPReservation")
+		cnt++
+	}
+	if cnt == retryMaxCount {
+		metrics.ObserveCASRetryExceeded("ReleaseFixedIPReservation")
+		return types.ErrMaxRetryCountExceeded
+	}
+	reservation := types.FixedIPReservation{IP: ip}
+	if err := helper.Delete(ctx, &codecs.FixedIPReservationCodec{Reservation: &reservation}); store.ErrButOtherThenKVUnexistsErr(err) {
+		return err
+	}
+	return nil
+}
+
+// SweepPendingFixedIPs unallocs pending fixed ips whose reservation is expired
+func (helper Helper) SweepPendingFixedIPs(ctx context.Context) (int, error) {
+	logger := helper.logger("SweepPendingFixedIPs")
+
+	fixedIPs, err := helper.ListFixedIPs(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+	swept := 0
+	for _, codec := range fixedIPs {
+		ipInfo := codec.IPInfo
+		if !ipInfo.Status.Match(types.IPStatusPending) || ipInfo.Status.Match(types.IPStatusInUse) {
+			continue
+		}
+		if ipInfo.Attrs != nil && len(ipInfo.Attrs.Borrowers) > 0 {
+			continue
+		}
+		var (
+			ip          = types.IP{PoolID: ipInfo.PoolID, Address: ipInfo.Address}
+			reservation = types.FixedIPReservation{IP: ip}
+		)
+		if err := helper.Get(ctx, &codecs.FixedIPReservationCodec{Reservation: &reservation}); err == nil {
+			continue
+		} else if store.ErrButOtherThenKVUnexistsErr(err) {
+			logger.WithError(err).WithField("fixed-ip", ip).Error("get reservation error")
+			continue
+		}
+		// the fixed ip borrowed in the meantime is kept
+		if err := helper.FixedIPAllocator().RetireFixedIP(ctx, codec); err != nil {
+			logger.WithError(err).WithField("fixed-ip", ip).Error("unalloc expired fixed ip error")
+			continue
+		}
+		logger.Infof("reservation of fixed-ip(%v) expired before the container is created, unalloced", ip)
+		swept++
+	}
+	return swept, nil
+}
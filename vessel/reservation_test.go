@@ -0,0 +1,120 @@
+package vessel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	barrelEtcd "github.com/projecteru2/barrel/etcd"
+	etcdStore "github.com/projecteru2/barrel/store/etcd"
+	"github.com/projecteru2/barrel/store/memory"
+	"github.com/projecteru2/barrel/types"
+	"github.com/projecteru2/barrel/vessel/codecs"
+	"github.com/projecteru2/barrel/vessel/mocks"
+)
+
+func TestPendingFixedIPSweptAfterReservationExpired(t *testing.T) {
+	stor := etcdStore.NewEtcdStore(barrelEtcd.NewEmbedEtcd(t).Client())
+
+	calicoIPAllocator := mocks.CalicoIPAllocator{}
+	calicoIPAllocator.On("AllocIP", mock.Anything, mock.Anything).Return(nil)
+	calicoIPAllocator.On("UnallocIP", mock.Anything, mock.Anything).Return(nil)
+
+	helper := newTestHelper(&calicoIPAllocator, stor).WithFixedIPReservation(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(10)*time.Second)
+	defer cancel()
+
+	ip := types.IP{PoolID: "poolID", Address: "10.10.10.10"}
+	assert.NoError(t, helper.FixedIPAllocator().AllocFixedIP(ctx, ip))
+	assert.NoError(t, helper.ReserveFixedIPForCreation(ctx, ip))
+
+	codec, err := helper.FixedIPAllocator().GetFixedIP(ctx, ip, nil)
+	assert.NoError(t, err)
+	assert.True(t, codec.IPInfo.Status.Match(types.IPStatusPending))
+
+	swept, err := helper.SweepPendingFixedIPs(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, swept)
+
+	assert.Eventually(t, func() bool {
+		swept, err := helper.SweepPendingFixedIPs(ctx)
+		return err == nil && swept == 1
+	}, time.Duration(8)*time.Second, 500*time.Millisecond)
+
+	_, err = helper.FixedIPAllocator().GetFixedIP(ctx, ip, nil)
+	assert.Equal(t, types.ErrFixedIPNotAllocated, err)
+	calicoIPAllocator.AssertCalled(t, "UnallocIP", mock.Anything, ip)
+}
+
+func TestRecordedFixedIPNotSwept(t *testing.T) {
+	stor := etcdStore.NewEtcdStore(barrelEtcd.NewEmbedEtcd(t).Client())
+
+	calicoIPAllocator := mocks.CalicoIPAllocator{}
+	calicoIPAllocator.On("AllocIP", mock.Anything, mock.Anything).Return(nil)
+	calicoIPAllocator.On("UnallocIP", mock.Anything, mock.Anything).Return(nil)
+
+	helper := newTestHelper(&calicoIPAllocator, stor).WithFixedIPReservation(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(10)*time.Second)
+	defer cancel()
+
+	ip := types.IP{PoolID: "poolID", Address: "10.10.10.10"}
+	assert.NoError(t, helper.FixedIPAllocator().AllocFixedIP(ctx, ip))
+	assert.NoError(t, helper.ReserveFixedIPForCreation(ctx, ip))
+	assert.NoError(t, helper.InitContainerInfoRecord(ctx, types.ContainerInfo{
+		Container: types.Container{ID: "containerID", HostName: "localhost"},
+		Addresses: []types.IP{ip},
+	}))
+	assert.NoError(t, helper.ReleaseFixedIPReservation(ctx, ip))
+
+	codec, err := helper.FixedIPAllocator().GetFixedIP(ctx, ip, nil)
+	assert.NoError(t, err)
+	assert.False(t, codec.IPInfo.Status.Match(types.IPStatusPending))
+
+	time.Sleep(2 * time.Second)
+	swept, err := helper.SweepPendingFixedIPs(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, swept)
+	calicoIPAllocator.AssertNotCalled(t, "UnallocIP", mock.Anything, mock.Anything)
+}
+
+func TestClaimFixedIPForCreation(t *testing.T) {
+	stor := memory.NewMemoryStore()
+
+	calicoIPAllocator := mocks.CalicoIPAllocator{}
+	calicoIPAllocator.On("AllocIP", mock.Anything, mock.Anything).Return(nil)
+
+	// claims are held even when the creation reservation is disabled
+	helper := newTestHelper(&calicoIPAllocator, stor)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(6)*time.Second)
+	defer cancel()
+
+	ip := types.IP{PoolID: "poolID", Address: "10.10.10.10"}
+	assert.Equal(t, types.ErrFixedIPNotAllocated, helper.ClaimFixedIPForCreation(ctx, ip))
+	assert.NoError(t, helper.FixedIPAllocator().AllocFixedIP(ctx, ip))
+	assert.NoError(t, helper.ClaimFixedIPForCreation(ctx, ip))
+	assert.Equal(t, types.ErrFixedIPKeyInUse, helper.ClaimFixedIPForCreation(ctx, ip))
+
+	// the claim is taken over once the reservation is gone with barrel crashed
+	assert.NoError(t, stor.Delete(ctx, &codecs.FixedIPReservationCodec{Reservation: &types.FixedIPReservation{IP: ip}}))
+	assert.NoError(t, helper.ClaimFixedIPForCreation(ctx, ip))
+
+	assert.NoError(t, helper.ReleaseFixedIPReservation(ctx, ip))
+	codec, err := helper.FixedIPAllocator().GetFixedIP(ctx, ip, nil)
+	assert.NoError(t, err)
+	assert.False(t, codec.IPInfo.Status.Match(types.IPStatusPending))
+	assert.NoError(t, helper.ClaimFixedIPForCreation(ctx, ip))
+
+	// fixed ips borrowed by containers can't be claimed
+	assert.NoError(t, helper.InitContainerInfoRecord(ctx, types.ContainerInfo{
+		Container: types.Container{ID: "containerID", HostName: "localhost"},
+		Addresses: []types.IP{ip},
+	}))
+	assert.NoError(t, helper.ReleaseFixedIPReservation(ctx, ip))
+	assert.Equal(t, types.ErrFixedIPKeyInUse, helper.ClaimFixedIPForCreation(ctx, ip))
+}
@@ -0,0 +1,189 @@
+package vessel
+
+import (
+	"context"
+	"time"
+
+	"github.com/projecteru2/barrel/metrics"
+	"github.com/projecteru2/barrel/store"
+	"github.com/projecteru2/barrel/types"
+	"github.com/projecteru2/barrel/vessel/codecs"
+)
+
+// WithFixedIPRetention returns a helper which reserves released fixed ips
+// for their owners during ttl instead of unallocating them at once
+func (helper Helper) WithFixedIPRetention(ttl time.Duration) Helper {
+	helper.retention = ttl
+	return helper
+}
+
+// FixedIPRetention .
+func (helper Helper) FixedIPRetention() time.Duration {
+	return helper.retention
+}
+
+// releaseFixedIP retains the returned fixed ip for the owner when retention is enabled,
+// otherwise unallocs it
+func (helper Helper) releaseFixedIP(ctx context.Context, address types.IP, owner string) {
+	logger := helper.logger("releaseFixedIP").WithField("fixed-ip", address)
+	if helper.retention > 0 && owner != "" {
+		err := helper.RetainFixedIP(ctx, address, owner)
+		if err == nil {
+			logger.Infof("fixed-ip is reserved for %s during %v", owner, helper.retention)
+			return
+		}
+		if err == types.ErrFixedIPHasBorrower || err == types.ErrIPInUse || err == types.ErrFixedIPNotAllocated {
+			return
+		}
+		logger.WithError(err).Error("retain fixed ip error, will unalloc it")
+	}
+	if err := helper.FixedIPAllocator().UnallocFixedIP(ctx, address, false); err != nil {
+		logger.Errorf("release reserved address error, cause = %v", err)
+	}
+}
+
+// retentionOwner scopes the owner by host, as container names are unique on a host only
+func (helper Helper) retentionOwner(owner string) string {
+	return helper.Hostname() + "/" + owner
+}
+
+// RetainFixedIP reserves the fixed ip for return of the owner on the host,
+// the fixed ip is unalloced by sweeper after the retention expired
+func (helper Helper) RetainFixedIP(ctx context.Context, ip types.IP, owner string) error {
+	owner = helper.retentionOwner(owner)
+	// the retention record must exists before the fixed ip is marked as reserved,
+	// otherwise the sweeper may treat the reservation as expired
+	retention := types.FixedIPRetention{Owner: owner, IP: ip}
+	if err := helper.PutWithTTL(ctx, &codecs.FixedIPRetentionCodec{Retention: &retention}, helper.retention); err != nil {
+		return err
+	}
+
+	cnt := 0
+	for cnt < retryMaxCount {
+		codec, err := helper.FixedIPAllocator().GetFixedIP(ctx, ip, nil)
+		if err != nil {
+			return err
+		}
+		ipInfo := codec.IPInfo
+		if ipInfo.Status.Match(types.IPStatusInUse) {
+			return types.ErrIPInUse
+		}
+		if ipInfo.Attrs == nil {
+			ipInfo.Attrs = &types.IPAttributes{}
+		}
+		if len(ipInfo.Attrs.Borrowers) > 0 {
+			return types.ErrFixedIPHasBorrower
+		}
+		ipInfo.Status.Mark(types.IPStatusReserved)
+		ipInfo.Attrs.ReservedFor = owner
+		if ok, err := helper.UpdateElseGet(ctx, codec); err != nil {
+			return err
+		} else if ok {
+			return nil
+		}
+		metrics.ObserveCASRetry("RetainFixedIP")
+		cnt++
+	}
+	metrics.ObserveCASRetryExceeded("RetainFixedIP")
+	return types.ErrMaxRetryCountExceeded
+}
+
+// ReclaimFixedIP takes back a fixed ip of the pools reserved for the owner on the host
+func (helper Helper) ReclaimFixedIP(ctx context.Context, owner string, pools []types.Pool) (types.IP, bool, error) {
+	owner = helper.retentionOwner(owner)
+	logger := helper.logger("ReclaimFixedIP").WithField("owner", owner)
+
+	codec := codecs.FixedIPRetentionMultiGetCodec{Owner: owner}
+	if err := helper.GetMulti(ctx, &codec); err != nil {
+		return types.IP{}, false, err
+	}
+	for _, retentionCodec := range codec.Codecs {
+		ip := retentionCodec.Retention.IP
+		if !included(pools, ip.PoolID) {
+			continue
+		}
+		reclaimed, err := helper.unreserveFixedIP(ctx, ip, owner)
+		if err != nil {
+			return types.IP{}, false, err
+		}
+		if err := helper.Delete(ctx, retentionCodec); store.ErrButOtherThenKVUnexistsErr(err) {
+			logger.WithError(err).WithField("fixed-ip", ip).Error("delete retention error")
+		}
+		if reclaimed {
+			logger.Infof("fixed-ip(%v) is reclaimed", ip)
+			return ip, true, nil
+		}
+	}
+	return types.IP{}, false, nil
+}
+
+func (helper Helper) unreserveFixedIP(ctx context.Context, ip types.IP, owner string) (bool, error) {
+	cnt := 0
+	for cnt < retryMaxCount {
+		codec, err := helper.FixedIPAllocator().GetFixedIP(ctx, ip, nil)
+		if err == types.ErrFixedIPNotAllocated {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		ipInfo := codec.IPInfo
+		if !ipInfo.Status.Match(types.IPStatusReserved) ||
+			ipInfo.Status.Match(types.IPStatusInUse) ||
+			ipInfo.Attrs == nil ||
+			ipInfo.Attrs.ReservedFor != owner {
+			// the retention is stale
+			return false, nil
+		}
+		ipInfo.Status.Unmark(types.IPStatusReserved)
+		ipInfo.Attrs.ReservedFor = ""
+		if ok, err := helper.UpdateElseGet(ctx, codec); err != nil {
+			return false, err
+		} else if ok {
+			return true, nil
+		}
+		metrics.ObserveCASRetry("ReclaimFixedIP")
+		cnt++
+	}
+	metrics.ObserveCASRetryExceeded("ReclaimFixedIP")
+	return false, types.ErrMaxRetryCountExceeded
+}
+
+// SweepRetainedFixedIPs unallocs reserved fixed ips whose retention is expired
+func (helper Helper) SweepRetainedFixedIPs(ctx context.Context) (int, error) {
+	logger := helper.logger("SweepRetainedFixedIPs")
+
+	fixedIPs, err := helper.ListFixedIPs(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+	swept := 0
+	for _, codec := range fixedIPs {
+		ipInfo := codec.IPInfo
+		if !ipInfo.Status.Match(types.IPStatusReserved) || ipInfo.Status.Match(types.IPStatusInUse) {
+			continue
+		}
+		var (
+			ip    = types.IP{PoolID: ipInfo.PoolID, Address: ipInfo.Address}
+			owner string
+		)
+		if ipInfo.Attrs != nil {
+			owner = ipInfo.Attrs.ReservedFor
+		}
+		retention := types.FixedIPRetention{Owner: owner, IP: ip}
+		if err := helper.Get(ctx, &codecs.FixedIPRetentionCodec{Retention: &retention}); err == nil {
+			continue
+		} else if store.ErrButOtherThenKVUnexistsErr(err) {
+			logger.WithError(err).WithField("fixed-ip", ip).Error("get retention error")
+			continue
+		}
+		// the fixed ip reclaimed in the meantime is kept
+		if err := helper.FixedIPAllocator().RetireFixedIP(ctx, codec); err != nil {
+			logger.WithError(err).WithField("fixed-ip", ip).Error("unalloc expired fixed ip error")
+			continue
+		}
+		logger.Infof("retention of fixed-ip(%v) for %s expired, unalloced", ip, owner)
+		swept++
+	}
+	return swept, nil
+}
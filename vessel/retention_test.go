@@ -0,0 +1,186 @@
+package vessel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	barrelEtcd "github.com/projecteru2/barrel/etcd"
+	etcdStore "github.com/projecteru2/barrel/store/etcd"
+	"github.com/projecteru2/barrel/store/memory"
+	"github.com/projecteru2/barrel/types"
+	"github.com/projecteru2/barrel/vessel/codecs"
+	"github.com/projecteru2/barrel/vessel/mocks"
+)
+
+func TestRetainedFixedIPReclaimedByOwner(t *testing.T) {
+	stor := etcdStore.NewEtcdStore(barrelEtcd.NewEmbedEtcd(t).Client())
+
+	calicoIPAllocator := mocks.CalicoIPAllocator{}
+	calicoIPAllocator.On("AllocIP", mock.Anything, mock.Anything).Return(nil)
+	calicoIPAllocator.On("UnallocIP", mock.Anything, mock.Anything).Return(nil)
+
+	helper := newTestHelper(&calicoIPAllocator, stor).WithFixedIPRetention(time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(6)*time.Second)
+	defer cancel()
+
+	ip := types.IP{PoolID: "poolID", Address: "10.10.10.10"}
+	pools := []types.Pool{{Name: "poolID"}}
+	container := types.Container{ID: "containerID", HostName: "localhost"}
+	assert.NoError(t, helper.FixedIPAllocator().AllocFixedIP(ctx, ip))
+	assert.NoError(t, helper.InitContainerInfoRecord(ctx, types.ContainerInfo{
+		Container: container,
+		Name:      "name",
+		Addresses: []types.IP{ip},
+	}))
+	assert.NoError(t, helper.ReleaseContainerAddresses(ctx, container.ID))
+
+	codec, err := helper.FixedIPAllocator().GetFixedIP(ctx, ip, nil)
+	assert.NoError(t, err)
+	assert.True(t, codec.IPInfo.Status.Match(types.IPStatusReserved))
+	assert.Equal(t, "localhost/name", codec.IPInfo.Attrs.ReservedFor)
+	assert.Equal(t, types.ErrFixedIPReserved, helper.FixedIPAllocator().AllocFixedIP(ctx, ip))
+	calicoIPAllocator.AssertNotCalled(t, "UnallocIP", mock.Anything, mock.Anything)
+
+	swept, err := helper.SweepRetainedFixedIPs(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, swept)
+
+	_, reclaimed, err := helper.ReclaimFixedIP(ctx, "other", pools)
+	assert.NoError(t, err)
+	assert.False(t, reclaimed)
+
+	address, reclaimed, err := helper.ReclaimFixedIP(ctx, "name", pools)
+	assert.NoError(t, err)
+	assert.True(t, reclaimed)
+	assert.Equal(t, ip, address)
+	assert.NoError(t, helper.FixedIPAllocator().AllocFixedIP(ctx, ip))
+
+	_, reclaimed, err = helper.ReclaimFixedIP(ctx, "name", pools)
+	assert.NoError(t, err)
+	assert.False(t, reclaimed)
+}
+
+func TestRetainedFixedIPSweptAfterExpired(t *testing.T) {
+	stor := etcdStore.NewEtcdStore(barrelEtcd.NewEmbedEtcd(t).Client())
+
+	calicoIPAllocator := mocks.CalicoIPAllocator{}
+	calicoIPAllocator.On("AllocIP", mock.Anything, mock.Anything).Return(nil)
+	calicoIPAllocator.On("UnallocIP", mock.Anything, mock.Anything).Return(nil)
+
+	helper := newTestHelper(&calicoIPAllocator, stor).WithFixedIPRetention(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(10)*time.Second)
+	defer cancel()
+
+	ip := types.IP{PoolID: "poolID", Address: "10.10.10.10"}
+	assert.NoError(t, helper.FixedIPAllocator().AllocFixedIP(ctx, ip))
+	assert.NoError(t, helper.RetainFixedIP(ctx, ip, "name"))
+
+	assert.Eventually(t, func() bool {
+		swept, err := helper.SweepRetainedFixedIPs(ctx)
+		return err == nil && swept == 1
+	}, time.Duration(8)*time.Second, 500*time.Millisecond)
+
+	_, err := helper.FixedIPAllocator().GetFixedIP(ctx, ip, nil)
+	assert.Equal(t, types.ErrFixedIPNotAllocated, err)
+	calicoIPAllocator.AssertCalled(t, "UnallocIP", mock.Anything, ip)
+}
+
+func TestFixedIPsSweptByLeaderOnly(t *testing.T) {
+	stor := etcdStore.NewEtcdStore(barrelEtcd.NewEmbedEtcd(t).Client())
+
+	calicoIPAllocator := mocks.CalicoIPAllocator{}
+	calicoIPAllocator.On("AllocIP", mock.Anything, mock.Anything).Return(nil)
+	calicoIPAllocator.On("UnallocIP", mock.Anything, mock.Anything).Return(nil)
+
+	helper := newTestHelper(&calicoIPAllocator, stor).WithFixedIPRetention(time.Second)
+	sweeper := NewFixedIPSweeper(helper, 0, 0).(*fixedIPSweeper)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(10)*time.Second)
+	defer cancel()
+
+	// another live host leads
+	assert.NoError(t, stor.Put(ctx, &codecs.LeaderCodec{Leader: &types.Leader{Role: sweeperRole, HostName: "other"}}))
+	liveness := &codecs.HostLivenessCodec{Liveness: &types.HostLiveness{HostName: "other"}}
+	assert.NoError(t, stor.Put(ctx, liveness))
+
+	ip := types.IP{PoolID: "poolID", Address: "10.10.10.10"}
+	assert.NoError(t, helper.FixedIPAllocator().AllocFixedIP(ctx, ip))
+	assert.NoError(t, helper.RetainFixedIP(ctx, ip, "name"))
+	time.Sleep(2 * time.Second)
+	sweeper.sweep(ctx)
+	_, err := helper.FixedIPAllocator().GetFixedIP(ctx, ip, nil)
+	assert.NoError(t, err)
+
+	// the lead is taken after the leader is gone
+	assert.NoError(t, stor.Delete(ctx, liveness))
+	assert.Eventually(t, func() bool {
+		sweeper.sweep(ctx)
+		_, err := helper.FixedIPAllocator().GetFixedIP(ctx, ip, nil)
+		return err == types.ErrFixedIPNotAllocated
+	}, time.Duration(6)*time.Second, 500*time.Millisecond)
+}
+
+func TestExpiredFixedIPUnallocJournaled(t *testing.T) {
+	stor := memory.NewMemoryStore()
+
+	calicoIPAllocator := mocks.CalicoIPAllocator{}
+	calicoIPAllocator.On("AllocIP", mock.Anything, mock.Anything).Return(nil)
+	calicoIPAllocator.On("UnallocIP", mock.Anything, mock.Anything).Return(errors.New("calico error")).Once()
+	calicoIPAllocator.On("UnallocIP", mock.Anything, mock.Anything).Return(nil)
+	helper := newJournalHelper(&calicoIPAllocator, stor).WithFixedIPRetention(time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(6)*time.Second)
+	defer cancel()
+
+	ip := types.IP{PoolID: "poolID", Address: "10.10.10.10"}
+	assert.NoError(t, helper.FixedIPAllocator().AllocFixedIP(ctx, ip))
+	assert.NoError(t, helper.RetainFixedIP(ctx, ip, "name"))
+	assert.NoError(t, stor.Delete(ctx, &codecs.FixedIPRetentionCodec{Retention: &types.FixedIPRetention{Owner: "localhost/name", IP: ip}}))
+
+	// crashed before the ip is unalloced in calico
+	swept, err := helper.SweepRetainedFixedIPs(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, swept)
+	assert.Equal(t, 1, countIntents(ctx, t, stor))
+
+	recovered, err := helper.RecoverJournal(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, recovered)
+	calicoIPAllocator.AssertNumberOfCalls(t, "UnallocIP", 2)
+}
+
+func TestRetainedFixedIPNotReclaimedOnOtherHosts(t *testing.T) {
+	stor := memory.NewMemoryStore()
+
+	calicoIPAllocator := mocks.CalicoIPAllocator{}
+	calicoIPAllocator.On("AllocIP", mock.Anything, mock.Anything).Return(nil)
+	newHelper := func(hostname string) Helper {
+		return newHostHelper(hostname, NewFixedIPAllocator(&calicoIPAllocator, stor), stor).WithFixedIPRetention(time.Hour)
+	}
+	helper, other := newHelper("localhost"), newHelper("other")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(6)*time.Second)
+	defer cancel()
+
+	ip := types.IP{PoolID: "poolID", Address: "10.10.10.10"}
+	pools := []types.Pool{{Name: "poolID"}}
+	assert.NoError(t, helper.FixedIPAllocator().AllocFixedIP(ctx, ip))
+	assert.NoError(t, helper.RetainFixedIP(ctx, ip, "name"))
+
+	// container names are unique on a host only
+	_, reclaimed, err := other.ReclaimFixedIP(ctx, "name", pools)
+	assert.NoError(t, err)
+	assert.False(t, reclaimed)
+
+	address, reclaimed, err := helper.ReclaimFixedIP(ctx, "name", pools)
+	assert.NoError(t, err)
+	assert.True(t, reclaimed)
+	assert.Equal(t, ip, address)
+}
@@ -0,0 +1,92 @@
+package vessel
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/projecteru2/barrel/service"
+)
+
+const (
+	defaultFixedIPSweepInterval = 30 * time.Second
+
+	// role of the host sweeping expired fixed ips of the cluster
+	sweeperRole = "sweeper"
+)
+
+type fixedIPSweeper struct {
+	helper   Helper
+	interval time.Duration
+	timeout  time.Duration
+}
+
+// NewFixedIPSweeper unallocs fixed ips whose retention or creation reservation is expired,
+// the sweeps are cluster-wide, so they are done by the leader of live hosts only
+func NewFixedIPSweeper(helper Helper, interval time.Duration, timeout time.Duration) service.Service {
+	sweeper := &fixedIPSweeper{
+		helper:   helper,
+		interval: interval,
+		timeout:  timeout,
+	}
+	if sweeper.interval <= 0 {
+		sweeper.interval = defaultFixedIPSweepInterval
+	}
+	if sweeper.timeout <= 0 {
+		sweeper.timeout = defaultReconcileTimeout
+	}
+	return sweeper
+}
+
+func (s *fixedIPSweeper) Serve(ctx context.Context) (service.Disposable, error) {
+	logger := s.logger("Serve")
+	logger.Infof("starting, interval = %v", s.interval)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Done")
+			return s, nil
+		case <-ticker.C:
+			s.sweep(ctx)
+		}
+	}
+}
+
+func (s *fixedIPSweeper) Dispose(ctx context.Context) error {
+	return nil
+}
+
+func (s *fixedIPSweeper) sweep(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	logger := s.logger("sweep")
+	if leader, err := s.helper.IsLeader(ctx, sweeperRole); err != nil {
+		logger.WithError(err).Error("check leader error")
+		return
+	} else if !leader {
+		return
+	}
+	if s.helper.FixedIPRetention() > 0 {
+		if swept, err := s.helper.SweepRetainedFixedIPs(ctx); err != nil {
+			logger.WithError(err).Error("sweep retained fixed ips error")
+		} else if swept > 0 {
+			logger.Infof("%d fixed ips of expired retention unalloced", swept)
+		}
+	}
+	if s.helper.FixedIPReservation() > 0 {
+		if swept, err := s.helper.SweepPendingFixedIPs(ctx); err != nil {
+			logger.WithError(err).Error("sweep pending fixed ips error")
+		} else if swept > 0 {
+			logger.Infof("%d fixed ips of expired reservation unalloced", swept)
+		}
+	}
+}
+
+func (s *fixedIPSweeper) logger(method string) *log.Entry {
+	return log.WithField("Receiver", "fixedIPSweeper").WithField("Method", method)
+}
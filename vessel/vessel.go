@@ -38,7 +38,8 @@ func NewVessel(hostname string, cliv3 clientv3.Interface, dockerCli *dockerClien
 	allocator := NewCalicoIPAllocator(cliv3, hostname)
 	return vessel{
 		hostname:             hostname,
-		fixedIPAllocator:     NewFixedIPAllocator(allocator, stor),
+		containerVessel:      NewContainerVessel(hostname, stor),
+		fixedIPAllocator:     newFixedIPAllocator(allocator, stor, newJournal(hostname, stor)),
 		dockerNetworkManager: NewDockerNetworkManager(dockerCli, driverName, allocator),
 	}
 }
@@ -0,0 +1,18 @@
+package vessel
+
+import (
+	"github.com/projecteru2/barrel/store"
+)
+
+// newTestHelper builds a helper of localhost, fixed ips are allocated from calicoIPAllocator
+func newTestHelper(calicoIPAllocator CalicoIPAllocator, stor store.Store) Helper {
+	return newHostHelper("localhost", NewFixedIPAllocator(calicoIPAllocator, stor), stor)
+}
+
+func newHostHelper(hostname string, fixedIPAllocator FixedIPAllocator, stor store.Store) Helper {
+	return NewHelper(vessel{
+		hostname:         hostname,
+		containerVessel:  NewContainerVessel(hostname, stor),
+		fixedIPAllocator: fixedIPAllocator,
+	}, stor)
+}
@@ -0,0 +1,49 @@
+package vesseltest
+
+import (
+	"github.com/projecteru2/barrel/store"
+	"github.com/projecteru2/barrel/vessel"
+)
+
+// Hostname of the helper built by NewHelper
+const Hostname = "localhost"
+
+type testVessel struct {
+	containerVessel      vessel.ContainerVessel
+	fixedIPAllocator     vessel.FixedIPAllocator
+	dockerNetworkManager vessel.DockerNetworkManager
+}
+
+// NewHelper builds a helper keeping records in stor, fixed ips are allocated from calicoIPAllocator,
+// dockerNetworkManager is nil when networks aren't looked up
+func NewHelper(
+	calicoIPAllocator vessel.CalicoIPAllocator,
+	dockerNetworkManager vessel.DockerNetworkManager,
+	stor store.Store,
+) vessel.Helper {
+	return vessel.NewHelper(testVessel{
+		containerVessel:      vessel.NewContainerVessel(Hostname, stor),
+		fixedIPAllocator:     vessel.NewFixedIPAllocator(calicoIPAllocator, stor),
+		dockerNetworkManager: dockerNetworkManager,
+	}, stor)
+}
+
+func (v testVessel) Hostname() string {
+	return Hostname
+}
+
+func (v testVessel) ContainerVessel() vessel.ContainerVessel {
+	return v.containerVessel
+}
+
+func (v testVessel) CalicoIPAllocator() vessel.CalicoIPAllocator {
+	return v.fixedIPAllocator
+}
+
+func (v testVessel) DockerNetworkManager() vessel.DockerNetworkManager {
+	return v.dockerNetworkManager
+}
+
+func (v testVessel) FixedIPAllocator() vessel.FixedIPAllocator {
+	return v.fixedIPAllocator
+}